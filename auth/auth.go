@@ -0,0 +1,129 @@
+// Package auth authenticates API requests and enforces the scopes granted to
+// their credentials.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// APIKeyHeader carries the secret of an API key.
+const APIKeyHeader = "X-API-Key"
+
+// Authentication failures reported by an Authenticator.
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	// Authenticate returns the principal of the request. It returns ErrNoCredentials
+	// when the request carries none and ErrInvalidCredentials when they are rejected.
+	Authenticate(r *http.Request) (common.Principal, error)
+}
+
+// Chain tries each Authenticator in turn and uses the first one that finds
+// credentials in the request.
+type Chain []Authenticator
+
+// Authenticate returns the result of the first Authenticator that finds credentials.
+func (c Chain) Authenticate(r *http.Request) (common.Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if !errors.Is(err, ErrNoCredentials) {
+			return principal, err
+		}
+	}
+	return common.Principal{}, ErrNoCredentials
+}
+
+// APIKeyStore looks up stored API keys. common.ReceiptStore implements it.
+type APIKeyStore interface {
+	GetAPIKeyByHash(hash string) (common.APIKey, error)
+}
+
+// APIKeys authenticates requests by the API key in the X-API-Key header.
+type APIKeys struct {
+	store APIKeyStore
+}
+
+// NewAPIKeys creates an Authenticator checking API keys against store.
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{store: store}
+}
+
+// Authenticate returns the client and scopes of an active API key.
+func (a *APIKeys) Authenticate(r *http.Request) (common.Principal, error) {
+	secret := r.Header.Get(APIKeyHeader)
+	if secret == "" {
+		return common.Principal{}, ErrNoCredentials
+	}
+
+	key, err := a.store.GetAPIKeyByHash(common.HashAPIKey(secret))
+	var notFound *common.APIKeyNotFoundError
+	if errors.As(err, &notFound) {
+		return common.Principal{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return common.Principal{}, fmt.Errorf("looking up api key: %w", err)
+	}
+	if !key.Active() {
+		return common.Principal{}, fmt.Errorf("%w: api key %s was revoked", ErrInvalidCredentials, key.ID)
+	}
+	return checkPrincipal(common.Principal{ClientID: key.ClientID, Scopes: key.Scopes})
+}
+
+// checkPrincipal rejects credentials naming a system account, such as "@redeemed",
+// as their user, so no request can read or move the points of those accounts
+func checkPrincipal(principal common.Principal) (common.Principal, error) {
+	if common.IsSystemAccount(principal.UserID) {
+		return common.Principal{}, fmt.Errorf("%w: user %q is a system account", ErrInvalidCredentials, principal.UserID)
+	}
+	return principal, nil
+}
+
+// Require returns a handler that only lets requests through to next when a
+// authenticates them and their credentials grant scope. It responds with
+// 401 Unauthorized for missing or rejected credentials and 403 Forbidden for a
+// missing scope. The principal is attached to the request context and its client
+// to the log fields.
+func Require(a Authenticator, scope string, log logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLog := logger.FromContext(r.Context(), log)
+
+		principal, err := a.Authenticate(r)
+		switch {
+		case errors.Is(err, ErrNoCredentials):
+			requestLog.Info("Request without credentials")
+			common.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		case errors.Is(err, ErrInvalidCredentials):
+			requestLog.Warn("Rejected credentials", logger.Err(err))
+			common.RespondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+			return
+		case err != nil:
+			requestLog.Error("Error authenticating request", logger.Err(err))
+			common.RespondWithError(w, http.StatusInternalServerError, "Could not authenticate the request")
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			requestLog.Warn("Missing scope", logger.F(logger.KeyClientID, principal.ClientID), logger.F("scope", scope))
+			common.RespondWithError(w, http.StatusForbidden, "Credentials lack the "+scope+" scope")
+			return
+		}
+
+		ctx := common.WithPrincipal(r.Context(), principal)
+		fields := []logger.Field{logger.F(logger.KeyClientID, principal.ClientID)}
+		if principal.UserID != "" {
+			fields = append(fields, logger.F(logger.KeyUserID, principal.UserID))
+		}
+		ctx = logger.WithFields(ctx, fields...)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
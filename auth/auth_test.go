@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	store := common.NewReceiptStorage()
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	readSecret, readKey, _ := common.NewAPIKey("acme", []string{common.ScopeReceiptsRead}, now)
+	revokedSecret, revokedKey, _ := common.NewAPIKey("acme", []string{common.ScopeReceiptsRead}, now)
+	store.SaveAPIKey(readKey)
+	store.SaveAPIKey(revokedKey)
+	store.RevokeAPIKey(revokedKey.ID, now)
+
+	var seen common.Principal
+	handler := Require(NewAPIKeys(store), common.ScopeReceiptsRead, logger.New(log.New(io.Discard, "", 0)), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = common.PrincipalFromContext(r.Context())
+	}))
+	writeOnly := Require(NewAPIKeys(store), common.ScopeReceiptsWrite, logger.New(log.New(io.Discard, "", 0)), handler)
+
+	tests := []struct {
+		description string
+		handler     http.Handler
+		key         string
+		status      int
+	}{
+		{"no key", handler, "", http.StatusUnauthorized},
+		{"unknown key", handler, "rk_unknown", http.StatusUnauthorized},
+		{"revoked key", handler, revokedSecret, http.StatusUnauthorized},
+		{"missing scope", writeOnly, readSecret, http.StatusForbidden},
+		{"valid key", handler, readSecret, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/receipts", nil)
+		if tt.key != "" {
+			req.Header.Set(APIKeyHeader, tt.key)
+		}
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.description, tt.status, rr.Code)
+		}
+	}
+
+	if seen.ClientID != "acme" {
+		t.Errorf("expected the principal in the request context, got %+v", seen)
+	}
+}
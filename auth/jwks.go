@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// jsonWebKey is one key of a JSON Web Key Set (RFC 7517). Only the members
+// needed for RS256 and ES256 signature verification are read.
+type jsonWebKey struct {
+	Kty string `json:"kty"` // RSA or EC
+	Kid string `json:"kid"` // Key ID matched against the kid of a token header
+	Use string `json:"use"` // sig, or empty
+	Alg string `json:"alg"` // Optional algorithm the key is restricted to
+	N   string `json:"n"`   // RSA modulus
+	E   string `json:"e"`   // RSA public exponent
+	Crv string `json:"crv"` // EC curve, only P-256 is supported
+	X   string `json:"x"`   // EC point coordinates
+	Y   string `json:"y"`
+}
+
+// verificationKey is a parsed public key and the algorithm it verifies
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS is a JSON Web Key Set read from a local file. Reload reads it again, and
+// Watch does so whenever the file changes, so keys can be rotated without a restart.
+type JWKS struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    map[string]verificationKey
+	modTime time.Time // Modification time of the file last read, even if it was invalid
+	size    int64
+}
+
+// LoadJWKS reads the key set at path. Keys of unsupported types are skipped,
+// but a file without any usable key is an error.
+func LoadJWKS(path string) (*JWKS, error) {
+	set := &JWKS{path: path}
+	if err := set.Reload(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Reload reads the key set file again, keeping the current keys if it is invalid.
+func (s *JWKS) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("reading jwks file: %w", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("reading jwks file: %w", err)
+	}
+	keys, err := parseJWKS(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Remember the file even when it is invalid, so Watch only retries once it changes
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	if err != nil {
+		return fmt.Errorf("parsing jwks file %s: %w", s.path, err)
+	}
+	s.keys = keys
+	return nil
+}
+
+// Watch checks the key set file every interval and reloads it when it changed,
+// until ctx is cancelled. A file that fails to load is logged, and the keys
+// loaded last keep verifying tokens.
+func (s *JWKS) Watch(ctx context.Context, interval time.Duration, log logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.changed() {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			log.Error("Error reloading JWKS, keeping the previous keys", logger.Err(err))
+			continue
+		}
+		log.Info("Reloaded JWKS", logger.F("path", s.path))
+	}
+}
+
+// key returns the key with the given ID
+func (s *JWKS) key(kid string) (verificationKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[kid]
+	if !ok {
+		return verificationKey{}, fmt.Errorf("no key with kid %q", kid)
+	}
+	return key, nil
+}
+
+// changed reports whether the key set file was modified since it was read
+func (s *JWKS) changed() bool {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+// parseJWKS parses the RS256 and ES256 signature keys of a key set
+func parseJWKS(data []byte) (map[string]verificationKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]verificationKey)
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key verificationKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = parseRSAKey(jwk)
+		case "EC":
+			key, err = parseECKey(jwk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d (kid %q): %w", i, jwk.Kid, err)
+		}
+		if jwk.Alg != "" && jwk.Alg != key.alg {
+			return nil, fmt.Errorf("key %d (kid %q): alg %s does not match key type %s", i, jwk.Kid, jwk.Alg, jwk.Kty)
+		}
+		if _, exists := keys[jwk.Kid]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RS256 or ES256 signature keys")
+	}
+	return keys, nil
+}
+
+// parseRSAKey parses an RSA public key of at least 2048 bits
+func parseRSAKey(jwk jsonWebKey) (verificationKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("exponent: %w", err)
+	}
+	if n.BitLen() < 2048 {
+		return verificationKey{}, fmt.Errorf("modulus of %d bits is too short", n.BitLen())
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return verificationKey{}, errors.New("unsupported exponent")
+	}
+	return verificationKey{alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+}
+
+// parseECKey parses a P-256 public key, checking that the point is on the curve
+func parseECKey(jwk jsonWebKey) (verificationKey, error) {
+	if jwk.Crv != "P-256" {
+		return verificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("x: %w", err)
+	}
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("y: %w", err)
+	}
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return verificationKey{}, errors.New("point is not on the curve")
+	}
+	return verificationKey{alg: "ES256", key: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+}
+
+// decodeBigInt decodes an unpadded base64url big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, errors.New("missing")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// JWTOptions configures which tokens a JWT authenticator accepts.
+type JWTOptions struct {
+	Issuer    string        // Required iss claim; any issuer when empty
+	Audience  string        // Required entry of the aud claim; any audience when empty
+	UserClaim string        // Claim holding the user ID, "sub" when empty
+	Leeway    time.Duration // Clock skew allowed when checking exp and nbf
+}
+
+// JWT authenticates requests by an RS256 or ES256 signed JSON Web Token in the
+// "Authorization: Bearer" header, verified against a local key set.
+type JWT struct {
+	keys  *JWKS
+	opts  JWTOptions
+	clock common.Clock
+}
+
+// NewJWT creates an Authenticator verifying tokens with keys. The clock decides
+// whether a token has expired.
+func NewJWT(keys *JWKS, opts JWTOptions, clock common.Clock) *JWT {
+	if opts.UserClaim == "" {
+		opts.UserClaim = "sub"
+	}
+	if clock == nil {
+		clock = common.SystemClock{}
+	}
+	return &JWT{keys: keys, opts: opts, clock: clock}
+}
+
+// Authenticate returns the user, client and scopes of a valid bearer token.
+// The client is the azp or client_id claim, or the issuer when there is neither;
+// scopes come from the space-separated scope claim or the scp claim.
+func (a *JWT) Authenticate(r *http.Request) (common.Principal, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return common.Principal{}, ErrNoCredentials
+	}
+
+	claims, err := a.verify(strings.TrimSpace(token))
+	if err != nil {
+		return common.Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	userID, _ := claims[a.opts.UserClaim].(string)
+	if userID == "" {
+		return common.Principal{}, fmt.Errorf("%w: token has no %s claim", ErrInvalidCredentials, a.opts.UserClaim)
+	}
+	return checkPrincipal(common.Principal{
+		ClientID: firstString(claims, "azp", "client_id", "iss"),
+		UserID:   userID,
+		Scopes:   tokenScopes(claims),
+	})
+}
+
+// verify checks the signature and time and audience restrictions of a compact
+// JWS token and returns its claims
+func (a *JWT) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("token header: %w", err)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("unsupported critical header parameters %v", header.Crit)
+	}
+	key, err := a.keys.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != key.alg {
+		return nil, fmt.Errorf("algorithm %q does not match the %s key %q", header.Alg, key.alg, header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %w", err)
+	}
+	if !verifySignature(key, parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("invalid signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("token claims: %w", err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims checks the exp, nbf, iss and aud claims
+func (a *JWT) checkClaims(claims map[string]interface{}) error {
+	now := a.clock.Now()
+	exp, ok, err := numericDate(claims["exp"])
+	if err != nil {
+		return fmt.Errorf("exp claim: %w", err)
+	}
+	if !ok {
+		return errors.New("token has no exp claim")
+	}
+	if now.After(exp.Add(a.opts.Leeway)) {
+		return errors.New("token has expired")
+	}
+	nbf, ok, err := numericDate(claims["nbf"])
+	if err != nil {
+		return fmt.Errorf("nbf claim: %w", err)
+	}
+	if ok && now.Add(a.opts.Leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	if a.opts.Issuer != "" && claims["iss"] != a.opts.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if a.opts.Audience != "" && !containsString(claims["aud"], a.opts.Audience) {
+		return fmt.Errorf("token is not intended for audience %q", a.opts.Audience)
+	}
+	return nil
+}
+
+// verifySignature verifies an RS256 or ES256 signature of the signing input
+func verifySignature(key verificationKey, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// ES256 signatures are the 32-byte R and S values concatenated
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	default:
+		return false
+	}
+}
+
+// decodeSegment decodes a base64url JSON token segment into v, keeping numbers exact
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// maxNumericDate is the last second of year 9999, the latest date a token may carry
+const maxNumericDate = 253402300799
+
+// numericDate converts a NumericDate claim, in seconds since the epoch. It reports
+// whether the claim is present, and fails for a value that is not a date between
+// the epoch and year 9999.
+func numericDate(value interface{}) (time.Time, bool, error) {
+	if value == nil {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, true, errors.New("not a number")
+	}
+	seconds, err := number.Float64()
+	if err != nil || math.IsNaN(seconds) || seconds < 0 || seconds > maxNumericDate {
+		return time.Time{}, true, errors.New("not a date in range")
+	}
+	whole := math.Floor(seconds)
+	return time.Unix(int64(whole), int64((seconds-whole)*float64(time.Second))), true, nil
+}
+
+// containsString reports whether a string or array claim holds want
+func containsString(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, item := range v {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// firstString returns the first non-empty string claim among names
+func firstString(claims map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, _ := claims[name].(string); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// tokenScopes returns the scopes of the space-separated scope claim and the scp claim
+func tokenScopes(claims map[string]interface{}) []string {
+	var scopes []string
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		scopes = append(scopes, strings.Fields(scp)...)
+	case []interface{}:
+		for _, item := range scp {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
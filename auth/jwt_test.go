@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// signToken signs claims as a compact JWS with the RS256 or ES256 key
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writeJWKS writes the public halves of keys, by kid, as a key set file
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.Signer) {
+	t.Helper()
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "RSA", "kid": kid, "n": encode(pub.N), "e": encode(big.NewInt(int64(pub.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(pub.X), "y": encode(pub.Y)})
+		}
+	}
+	data, _ := json.Marshal(set)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey})
+
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	authenticator := NewJWT(keys, JWTOptions{Issuer: "https://id.example.com", Audience: "receipts"}, common.FixedClock{Time: now})
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://id.example.com",
+			"aud":   []string{"receipts", "other"},
+			"sub":   "user-42",
+			"azp":   "mobile-app",
+			"scope": "receipts:read receipts:write",
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		description string
+		token       string
+		err         error
+	}{
+		{"RS256 token", signToken(t, "RS256", "rsa", rsaKey, claims(nil)), nil},
+		{"ES256 token", signToken(t, "ES256", "ec", ecKey, claims(nil)), nil},
+		{"expired", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), ErrInvalidCredentials},
+		{"not yet valid", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})), ErrInvalidCredentials},
+		{"exp out of range", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": 1e19})), ErrInvalidCredentials},
+		{"exp not a number", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": "tomorrow"})), ErrInvalidCredentials},
+		{"nbf out of range", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": -1e19})), ErrInvalidCredentials},
+		{"fractional exp", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": float64(now.Unix()) + 0.5})), nil},
+		{"wrong issuer", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})), ErrInvalidCredentials},
+		{"wrong audience", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "billing"})), ErrInvalidCredentials},
+		{"no user", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"sub": ""})), ErrInvalidCredentials},
+		{"system account user", signToken(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"sub": common.AccountRedeemed})), ErrInvalidCredentials},
+		{"unknown signer", signToken(t, "ES256", "ec", otherKey, claims(nil)), ErrInvalidCredentials},
+		{"algorithm mismatch", signToken(t, "ES256", "rsa", ecKey, claims(nil)), ErrInvalidCredentials},
+		{"unknown kid", signToken(t, "RS256", "missing", rsaKey, claims(nil)), ErrInvalidCredentials},
+		{"malformed", "not-a-token", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/receipts", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		principal, err := authenticator.Authenticate(req)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected error %v, got %v", tt.description, tt.err, err)
+			continue
+		}
+		if err == nil && (principal.UserID != "user-42" || principal.ClientID != "mobile-app" || !principal.HasScope(common.ScopeReceiptsWrite)) {
+			t.Errorf("%s: unexpected principal %+v", tt.description, principal)
+		}
+	}
+
+	// Requests without a bearer token are left to other authenticators
+	req := httptest.NewRequest("GET", "/receipts", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if _, err := authenticator.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials for basic auth, got %v", err)
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"2023-11": oldKey})
+
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	authenticator := NewJWT(keys, JWTOptions{}, common.FixedClock{Time: now})
+	authenticate := func(token string) error {
+		req := httptest.NewRequest("GET", "/receipts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, err := authenticator.Authenticate(req)
+		return err
+	}
+	claims := map[string]interface{}{"sub": "user-42", "exp": now.Add(time.Hour).Unix()}
+	newToken := signToken(t, "ES256", "2023-12", newKey, claims)
+
+	if err := authenticate(newToken); err == nil {
+		t.Fatal("expected a token of an unpublished key to be rejected")
+	}
+
+	// Rotate: publish the new key next to the old one, and reload
+	writeJWKS(t, path, map[string]crypto.Signer{"2023-11": oldKey, "2023-12": newKey})
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate(newToken); err != nil {
+		t.Errorf("expected the rotated key to be picked up, got %v", err)
+	}
+
+	// A broken file keeps the keys already loaded
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Reload(); err == nil {
+		t.Error("expected an error reloading a broken file")
+	}
+	if err := authenticate(newToken); err != nil {
+		t.Errorf("expected the previous keys to be kept, got %v", err)
+	}
+}
+
+func TestJWKSWatch(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"2023-11": oldKey})
+
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		keys.Watch(ctx, 5*time.Millisecond, logger.New(log.New(&logs, "", 0)))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// A broken file is logged and keeps the old key
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !keys.changed() })
+	if _, err := keys.key("2023-11"); err != nil {
+		t.Errorf("expected the previous keys to be kept, got %v", err)
+	}
+
+	// The rotated file is picked up on a later tick
+	writeJWKS(t, path, map[string]crypto.Signer{"2023-11": oldKey, "2023-12": newKey})
+	waitFor(t, func() bool { _, err := keys.key("2023-12"); return err == nil })
+
+	cancel()
+	<-done
+	if !strings.Contains(logs.String(), "Error reloading JWKS") {
+		t.Errorf("expected the broken file to be logged, got %q", logs.String())
+	}
+}
+
+// waitFor polls condition until it holds, failing the test after a second
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
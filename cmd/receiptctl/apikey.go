@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// runAPIKey implements "receiptctl apikey create|list|revoke"
+func runAPIKey(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("apikey requires a subcommand: create, list or revoke")
+	}
+
+	fs := newFlagSet("apikey "+args[0], stderr)
+	var serverOpts serverFlags
+	serverOpts.register(fs)
+	serverOpts.registerStore(fs)
+	client := fs.String("client", "", "client the key authenticates as (create)")
+	scopes := fs.String("scopes", common.ScopeReceiptsRead+","+common.ScopeReceiptsWrite, "comma-separated scopes granted to the key (create)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := serverOpts.load()
+	if err != nil {
+		return err
+	}
+	// Keys issued into the memory store would vanish on exit, and the server could
+	// never see them, as config.Validate already enforces for the server
+	store, err := openPersistentStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "create":
+		return createAPIKey(store, *client, strings.Split(*scopes, ","), time.Now(), stdout)
+	case "list":
+		return listAPIKeys(store, stdout)
+	case "revoke":
+		if fs.NArg() != 1 {
+			return errors.New("apikey revoke requires the key ID")
+		}
+		if err := store.RevokeAPIKey(fs.Arg(0), time.Now()); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "revoked api key %s\n", fs.Arg(0))
+		return nil
+	default:
+		return fmt.Errorf("unknown apikey subcommand %q, expected create, list or revoke", args[0])
+	}
+}
+
+// createAPIKey issues and stores a key, printing its secret once
+func createAPIKey(store common.ReceiptStore, client string, scopes []string, now time.Time, stdout io.Writer) error {
+	for i := range scopes {
+		scopes[i] = strings.TrimSpace(scopes[i])
+	}
+	secret, key, err := common.NewAPIKey(client, scopes, now)
+	if err != nil {
+		return err
+	}
+	if err := store.SaveAPIKey(key); err != nil {
+		return fmt.Errorf("storing api key: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "ID:     %s\nClient: %s\nScopes: %s\nKey:    %s\n", key.ID, key.ClientID, strings.Join(key.Scopes, ","), secret)
+	fmt.Fprintln(stdout, "Store the key now: only its hash is kept.")
+	return nil
+}
+
+// listAPIKeys prints every stored key, without secrets
+func listAPIKeys(store common.ReceiptStore, stdout io.Writer) error {
+	keys, err := store.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tCLIENT\tSCOPES\tCREATED\tSTATUS")
+	for _, key := range keys {
+		status := "active"
+		if !key.Active() {
+			status = "revoked " + key.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", key.ID, key.ClientID, strings.Join(key.Scopes, ","), key.CreatedAt.Format(time.RFC3339), status)
+	}
+	return table.Flush()
+}
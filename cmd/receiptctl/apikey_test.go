@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+func TestAPIKeyCommands(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "receipts.db")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"apikey", "create", "-store", "sqlite", "-dsn", dsn, "-client", "acme", "-scopes", "receipts:read"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected create to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	match := regexp.MustCompile(`(?m)^ID:\s+(\S+)$[\s\S]*^Key:\s+(rk_\S+)$`).FindStringSubmatch(stdout.String())
+	if match == nil {
+		t.Fatalf("expected the key ID and secret, got %q", stdout.String())
+	}
+	id, secret := match[1], match[2]
+
+	store, err := common.NewSQLiteStorage(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.GetAPIKeyByHash(common.HashAPIKey(secret))
+	store.Close()
+	if err != nil || key.ID != id || key.ClientID != "acme" || strings.Join(key.Scopes, ",") != "receipts:read" {
+		t.Fatalf("expected the created key to be stored, got %+v (%v)", key, err)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"apikey", "revoke", "-store", "sqlite", "-dsn", dsn, id}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected revoke to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"apikey", "list", "-store", "sqlite", "-dsn", dsn}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected list to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), id) || !strings.Contains(stdout.String(), "revoked") || strings.Contains(stdout.String(), secret) {
+		t.Errorf("expected the revoked key without its secret, got %q", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"apikey", "create", "-store", "sqlite", "-dsn", dsn, "-client", "acme", "-scopes", "receipts:admin"}, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "unknown scope") {
+		t.Errorf("expected an unknown scope to fail, got exit code %d: %s", code, stderr.String())
+	}
+}
+
+func TestAPIKeyCommandsNeedAPersistentStore(t *testing.T) {
+	t.Setenv("RECEIPT_STORE", "")
+	t.Setenv("RECEIPT_CONFIG_FILE", "")
+
+	for _, args := range [][]string{{"apikey", "create", "-client", "acme"}, {"apikey", "list"}, {"apikey", "revoke", "key-1"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "memory store") {
+			t.Errorf("%s: expected the memory store to be refused, got exit code %d: %s", args[1], code, stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%s: expected no secret or listing, got %q", args[1], stdout.String())
+		}
+	}
+}
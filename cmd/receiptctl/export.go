@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// runExport implements "receiptctl export"
+func runExport(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", stderr)
+	var serverOpts serverFlags
+	serverOpts.register(fs)
+	serverOpts.registerStore(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := serverOpts.load()
+	if err != nil {
+		return err
+	}
+
+	store, err := openPersistentStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	output := stdout
+	if name := fs.Arg(0); name != "" && name != "-" {
+		file, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+
+	count, err := exportReceipts(store, output)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "exported %d receipts\n", count)
+	return nil
+}
+
+// exportReceipts writes every stored receipt, with its points, as one NDJSON line,
+// in insertion order. The output can be imported again.
+func exportReceipts(store common.ReceiptStore, output io.Writer) (int, error) {
+	writer := bufio.NewWriter(output)
+	encoder := json.NewEncoder(writer)
+
+	count := 0
+	filter := common.ReceiptFilter{Limit: common.MaxPageSize}
+	for {
+		page, err := store.ListReceipts(filter)
+		if err != nil {
+			return count, fmt.Errorf("listing receipts: %w", err)
+		}
+		for _, record := range page.Receipts {
+			if err := encoder.Encode(record); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	return count, writer.Flush()
+}
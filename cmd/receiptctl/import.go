@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	v1 "github.com/ethirajmudhaliar/GH-risk-api/receipt/v1"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+)
+
+// importSummary counts the outcome of an import
+type importSummary struct {
+	imported int
+	failed   int
+}
+
+// runImport implements "receiptctl import"
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("import", stderr)
+	var serverOpts serverFlags
+	serverOpts.register(fs)
+	serverOpts.registerStore(fs)
+	serverOpts.registerRules(fs)
+	serverOpts.registerConsistency(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := serverOpts.load()
+	if err != nil {
+		return err
+	}
+
+	input, closeInput, err := openInput(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	engine, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		return fmt.Errorf("loading points rules: %w", err)
+	}
+	consistency, err := cfg.ConsistencyOptions()
+	if err != nil {
+		return err
+	}
+	store, err := openPersistentStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// Receipts go through the server's own submission pipeline, so they are checked,
+	// scored and de-duplicated as if they were submitted to the API
+	server := v1.NewServer(store, engine, logger.New(log.New(io.Discard, "", 0)), nil,
+		v1.WithConsistency(consistency), v1.WithDuplicates(cfg.AllowDuplicates))
+	summary, err := importReceipts(input, server, cfg.Limits.MaxBodyBytes, stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "imported %d receipts, %d failed\n", summary.imported, summary.failed)
+	if summary.failed > 0 {
+		return fmt.Errorf("%d receipts could not be imported", summary.failed)
+	}
+	return nil
+}
+
+// importReceipts stores one receipt per non-blank NDJSON line with server.Import.
+// Receipts without an ID get a new one. Every failure, including a line longer than
+// maxLineBytes, is reported to errOut with its line number, and the import carries
+// on with the next line.
+func importReceipts(input io.Reader, server *v1.Server, maxLineBytes int64, errOut io.Writer) (importSummary, error) {
+	var summary importSummary
+	reader := bufio.NewReader(input)
+
+	for line := 1; ; line++ {
+		text, tooLong, err := common.ReadLine(reader, maxLineBytes)
+		if err != nil && err != io.EOF {
+			return summary, fmt.Errorf("reading input: %w", err)
+		}
+		text = bytes.TrimSpace(text)
+		switch {
+		case tooLong:
+			fmt.Fprintf(errOut, "line %d: receipt exceeds %d bytes\n", line, maxLineBytes)
+			summary.failed++
+		case len(text) > 0:
+			if err := importReceipt(text, server); err != nil {
+				fmt.Fprintf(errOut, "line %d: %v\n", line, err)
+				summary.failed++
+			} else {
+				summary.imported++
+			}
+		}
+		if err == io.EOF {
+			return summary, nil
+		}
+	}
+}
+
+// importReceipt stores a single NDJSON receipt
+func importReceipt(text []byte, server *v1.Server) error {
+	var receipt common.Receipt
+	if err := json.Unmarshal(text, &receipt); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// Receipts exported with a userId credit that user, as when submitted
+	if _, err := server.Import(receipt); err != nil {
+		var dupErr *common.DuplicateReceiptError
+		if errors.As(err, &dupErr) {
+			return fmt.Errorf("duplicate of receipt %s", dupErr.ExistingID)
+		}
+		return err
+	}
+	return nil
+}
+
+// openInput opens the named file, or returns stdin for an empty name or "-"
+func openInput(name string, stdin io.Reader) (io.Reader, func(), error) {
+	if name == "" || name == "-" {
+		return stdin, func() {}, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
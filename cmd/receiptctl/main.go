@@ -0,0 +1,153 @@
+// Command receiptctl manages receipts offline, against the same store and
+// points rules the server is configured with.
+//
+// Usage:
+//
+//	receiptctl import [flags] [file]   Import NDJSON receipts (stdin when no file is given)
+//	receiptctl export [flags] [file]   Export stored receipts as NDJSON (stdout when no file is given)
+//	receiptctl points [flags] [file]   Explain the points of a JSON receipt (stdin when no file is given)
+//	receiptctl apikey create|list|revoke [flags]   Manage the API keys clients authenticate with
+//
+// The store, rules and consistency checks come from the server's configuration:
+// its config file (-config or RECEIPT_CONFIG_FILE) and RECEIPT_* environment
+// variables, overridden by the flags of each command. Commands that store
+// receipts refuse the memory store, which would lose them on exit.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/config"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes a subcommand and returns the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "import":
+		err = runImport(args[1:], stdin, stdout, stderr)
+	case "export":
+		err = runExport(args[1:], stdout, stderr)
+	case "points":
+		err = runPoints(args[1:], stdin, stdout, stderr)
+	case "apikey":
+		err = runAPIKey(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "receiptctl: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "receiptctl: "+err.Error())
+		return 1
+	}
+	return 0
+}
+
+// usage prints the list of subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `Usage: receiptctl <command> [flags] [file]
+
+Commands:
+  import   Validate, score and store NDJSON receipts
+  export   Write stored receipts as NDJSON
+  points   Explain the points a receipt would get, without storing it
+  apikey   Create, list or revoke API keys ("apikey create -client acme")
+
+Run "receiptctl <command> -h" for the flags of a command.`)
+}
+
+// serverFlags load the server's configuration, so commands work against the same
+// store, rules and checks as the server: the defaults, then the config file
+// (-config or $RECEIPT_CONFIG_FILE), then the RECEIPT_* variables, then the flags
+// that are set.
+type serverFlags struct {
+	file      string
+	overrides []func(*config.Config)
+}
+
+// register adds the -config flag to a flag set
+func (f *serverFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.file, "config", "", "server YAML or JSON config file (default $"+config.FileEnv+")")
+}
+
+// registerStore adds the flags selecting the receipt store
+func (f *serverFlags) registerStore(fs *flag.FlagSet) {
+	f.override(fs, "store", "storage backend: sqlite (default from the server configuration)", func(c *config.Config, v string) { c.Store.Backend = v })
+	f.override(fs, "dsn", "database path for the sqlite backend (default from the server configuration)", func(c *config.Config, v string) { c.Store.DSN = v })
+}
+
+// registerRules adds the flag selecting the points rules
+func (f *serverFlags) registerRules(fs *flag.FlagSet) {
+	f.override(fs, "rules", "points rules file (default from the server configuration, or the standard rules)", func(c *config.Config, v string) { c.RulesFile = v })
+}
+
+// registerConsistency adds the flags configuring the receipt consistency checks
+func (f *serverFlags) registerConsistency(fs *flag.FlagSet) {
+	f.override(fs, "consistency-mode", "consistency checks: strict or lenient (default from the server configuration)", func(c *config.Config, v string) { c.Consistency.Mode = v })
+	f.override(fs, "consistency-tolerance", "allowed difference between the total and the item prices (default from the server configuration)", func(c *config.Config, v string) { c.Consistency.Tolerance = v })
+}
+
+// override adds a flag replacing one setting of the loaded configuration
+func (f *serverFlags) override(fs *flag.FlagSet, name, usage string, set func(c *config.Config, value string)) {
+	fs.Func(name, usage, func(value string) error {
+		f.overrides = append(f.overrides, func(c *config.Config) { set(c, value) })
+		return nil
+	})
+}
+
+// load returns the validated configuration, with the flags applied
+func (f *serverFlags) load() (config.Config, error) {
+	cfg, err := config.LoadEnv(f.file, os.Getenv)
+	if err != nil {
+		return config.Config{}, err
+	}
+	for _, override := range f.overrides {
+		override(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, err
+	}
+	return cfg, nil
+}
+
+// openPersistentStore opens the configured store, refusing the memory store, whose
+// receipts and API keys would be lost as soon as receiptctl exits
+func openPersistentStore(cfg config.Config) (common.ReceiptStore, error) {
+	if cfg.Store.Backend == "" || cfg.Store.Backend == common.BackendMemory {
+		return nil, errors.New("the memory store keeps nothing once receiptctl exits; select the server's store with -config, $RECEIPT_STORE or -store sqlite -dsn <path>")
+	}
+	store, err := common.OpenStore(cfg.Store.Backend, cfg.Store.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("opening receipt store: %w", err)
+	}
+	return store, nil
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors instead of exiting
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("receiptctl "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	v1 "github.com/ethirajmudhaliar/GH-risk-api/receipt/v1"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+)
+
+func TestImportReceipts(t *testing.T) {
+	store := common.NewReceiptStorage()
+
+	input := strings.Join([]string{
+		`{"id": "1", "retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}, {"shortDescription": "Emils Cheese Pizza", "price": "12.25"}, {"shortDescription": "Knorr Creamy Chicken", "price": "1.26"}, {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"}, {"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}]}`,
+		``,
+		`{"retailer": "Target"`,
+		`{"retailer": "", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.00", "items": [{"shortDescription": "Item", "price": "1.00"}]}`,
+		`{"retailer": "Walgreens", "purchaseDate": "2022-01-02", "purchaseTime": "08:13", "total": "2.65", "items": [{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}, {"shortDescription": "Dasani", "price": "1.40"}]}`,
+		`{"retailer": "` + strings.Repeat("A", 4096) + `"}`,
+		`{"id": "9", "retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}, {"shortDescription": "Emils Cheese Pizza", "price": "12.25"}, {"shortDescription": "Knorr Creamy Chicken", "price": "1.26"}, {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"}, {"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}]}`,
+	}, "\n")
+
+	var errOut bytes.Buffer
+	server := v1.NewServer(store, rules.Default(), logger.New(log.New(io.Discard, "", 0)), nil)
+	summary, err := importReceipts(strings.NewReader(input), server, 1024, &errOut)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if summary.imported != 2 || summary.failed != 4 {
+		t.Errorf("expected 2 imported and 4 failed, got: %+v", summary)
+	}
+
+	// Failures are reported with their line numbers, and a long line does not stop the import
+	report := errOut.String()
+	for _, want := range []string{"line 3: invalid JSON", "line 4: ", "line 6: receipt exceeds 1024 bytes", "line 7: duplicate of receipt 1"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the errors, got: %q", want, report)
+		}
+	}
+
+	points, err := store.GetReceiptPoints("1")
+	if err != nil || points != 28 {
+		t.Errorf("expected receipt 1 to be scored 28 points, got %d (%v)", points, err)
+	}
+}
+
+func TestImportChecksConsistency(t *testing.T) {
+	input := `{"retailer": "Target", "purchaseDate": "2022-02-30", "purchaseTime": "13:01", "total": "1.00", "items": [{"shortDescription": "Item A", "price": "1.00"}]}
+{"retailer": "Walgreens", "purchaseDate": "2022-01-02", "purchaseTime": "08:13", "total": "5.00", "items": [{"shortDescription": "Item B", "price": "2.00"}]}
+`
+
+	// Like the server, only strict mode rejects items that do not add up to the total
+	dsn := filepath.Join(t.TempDir(), "receipts.db")
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"import", "-store", "sqlite", "-dsn", dsn, "-consistency-mode", "strict"}, strings.NewReader(input), &stdout, &stderr)
+	if code != 1 || stdout.String() != "imported 0 receipts, 2 failed\n" {
+		t.Errorf("expected both receipts to fail in strict mode, got exit code %d: %q", code, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "line 1: ") || !strings.Contains(stderr.String(), "line 2: ") {
+		t.Errorf("expected errors for lines 1 and 2, got: %q", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{"import", "-store", "sqlite", "-dsn", dsn, "-consistency-mode", "lenient"}, strings.NewReader(input), &stdout, &stderr)
+	if code != 1 || stdout.String() != "imported 1 receipts, 1 failed\n" {
+		t.Errorf("expected only the invalid date to fail in lenient mode, got exit code %d: %q", code, stdout.String())
+	}
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "receipts.db")
+	input := `{"id": "1", "retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.00", "items": [{"shortDescription": "Item A", "price": "1.00"}]}
+{"id": "2", "retailer": "Walgreens", "purchaseDate": "2022-01-02", "purchaseTime": "08:13", "total": "2.00", "items": [{"shortDescription": "Item B", "price": "2.00"}]}
+`
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"import", "-store", "sqlite", "-dsn", dsn}, strings.NewReader(input), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected import to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "imported 2 receipts, 0 failed\n" {
+		t.Errorf("unexpected import summary: %q", stdout.String())
+	}
+
+	stdout.Reset()
+	code = run([]string{"export", "-store", "sqlite", "-dsn", dsn}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected export to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"id":"1","retailer":"Target"`) || !strings.Contains(lines[1], `"points":`) {
+		t.Errorf("unexpected export: %q", stdout.String())
+	}
+
+	// Importing the export again reports every receipt as already stored
+	code = run([]string{"import", "-store", "sqlite", "-dsn", dsn}, strings.NewReader(stdout.String()), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "line 1: receipt with ID 1 already exists") {
+		t.Errorf("expected the re-import to fail per line, got exit code %d: %s", code, stderr.String())
+	}
+}
+
+func TestImportExportNeedAPersistentStore(t *testing.T) {
+	t.Setenv("RECEIPT_STORE", "")
+	t.Setenv("RECEIPT_CONFIG_FILE", "")
+	input := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.00", "items": [{"shortDescription": "Item A", "price": "1.00"}]}`
+
+	for _, args := range [][]string{{"import"}, {"export"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, strings.NewReader(input), &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "memory store") {
+			t.Errorf("%s: expected the memory store to be refused, got exit code %d: %s", args[0], code, stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%s: expected no output, got %q", args[0], stdout.String())
+		}
+	}
+}
+
+func TestImportReadsServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "receipts.db")
+	file := filepath.Join(dir, "config.yaml")
+	os.WriteFile(file, []byte("store:\n  backend: sqlite\n  dsn: "+dsn+"\n"), 0o644)
+	t.Setenv("RECEIPT_CONFIG_FILE", file)
+	t.Setenv("RECEIPT_STORE", "")
+	t.Setenv("RECEIPT_STORE_DSN", "")
+
+	input := `{"id": "1", "retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "1.00", "items": [{"shortDescription": "Item A", "price": "1.00"}]}`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"import"}, strings.NewReader(input), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected import to succeed, got exit code %d: %s", code, stderr.String())
+	}
+
+	// The receipt was stored in the server's database
+	store, err := common.NewSQLiteStorage(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.GetReceiptByID("1"); err != nil {
+		t.Errorf("expected the receipt in the configured store, got: %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"frobnicate"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+	if code := run(nil, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 without a command, got %d", code)
+	}
+}
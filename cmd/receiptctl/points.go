@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	v1 "github.com/ethirajmudhaliar/GH-risk-api/receipt/v1"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+)
+
+// errInvalidReceipt is returned once the validation problems have been printed
+var errInvalidReceipt = errors.New("receipt is invalid")
+
+// runPoints implements "receiptctl points"
+func runPoints(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("points", stderr)
+	var serverOpts serverFlags
+	serverOpts.register(fs)
+	serverOpts.registerRules(fs)
+	serverOpts.registerConsistency(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := serverOpts.load()
+	if err != nil {
+		return err
+	}
+	consistency, err := cfg.ConsistencyOptions()
+	if err != nil {
+		return err
+	}
+
+	input, closeInput, err := openInput(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	engine, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		return fmt.Errorf("loading points rules: %w", err)
+	}
+
+	return explainPoints(input, engine, consistency, stdout)
+}
+
+// explainPoints validates a single JSON receipt as the server does and prints its
+// total points followed by the result of every rule, then any consistency warnings.
+// Validation problems are printed instead, one per line.
+func explainPoints(input io.Reader, calculator v1.PointsCalculator, consistency validation.ConsistencyOptions, out io.Writer) error {
+	var receipt common.Receipt
+	if err := json.NewDecoder(input).Decode(&receipt); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	evaluation, err := v1.EvaluateReceipt(receipt, calculator, consistency, time.Now())
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		for _, detail := range errs {
+			fmt.Fprintf(out, "%s: %s\n", detail.Path, detail.Message)
+		}
+		return errInvalidReceipt
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Total points: %d\n\n", evaluation.Points)
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RULE\tMATCHED\tPOINTS\tINPUT")
+	for _, result := range evaluation.Breakdown {
+		matched := "no"
+		if result.Matched {
+			matched = "yes"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", result.Rule, matched, result.Points, result.Input)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range evaluation.Warnings {
+		fmt.Fprintf(out, "warning: %s: %s\n", warning.Path, warning.Message)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPointsCommand(t *testing.T) {
+	receipt := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+	]}`
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"points"}, strings.NewReader(receipt), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	output := stdout.String()
+	if !strings.HasPrefix(output, "Total points: 28\n") {
+		t.Errorf("expected 28 points, got: %q", output)
+	}
+	if !strings.Contains(output, "retailer_alphanumeric") || !strings.Contains(output, "Target") {
+		t.Errorf("expected a line per rule, got: %q", output)
+	}
+
+	// An alternate rule configuration changes the score
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	os.WriteFile(rulesFile, []byte("version: test\nrules:\n  - type: odd_day\n    points: 100\n"), 0o644)
+	stdout.Reset()
+	if code := run([]string{"points", "--rules", rulesFile}, strings.NewReader(receipt), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Total points: 100\n") {
+		t.Errorf("expected 100 points with the alternate rules, got: %q", stdout.String())
+	}
+}
+
+func TestPointsCommandInvalidReceipt(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	receipt := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "abc", "items": []}`
+	if code := run([]string{"points"}, strings.NewReader(receipt), &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "/total: ") || !strings.Contains(stdout.String(), "/items: ") {
+		t.Errorf("expected every validation problem, got: %q", stdout.String())
+	}
+}
+
+func TestPointsCommandChecksConsistency(t *testing.T) {
+	receipt := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "5.00", "items": [{"shortDescription": "Item A", "price": "2.00"}]}`
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"points", "-consistency-mode", "strict"}, strings.NewReader(receipt), &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1 in strict mode, got %d", code)
+	}
+	if !strings.HasPrefix(stdout.String(), "/total: items sum to") {
+		t.Errorf("expected the total mismatch, got: %q", stdout.String())
+	}
+
+	// Lenient mode scores the receipt and prints the mismatch as a warning
+	stdout.Reset()
+	if code := run([]string{"points", "-consistency-mode", "lenient"}, strings.NewReader(receipt), &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0 in lenient mode, got %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Total points: ") || !strings.Contains(stdout.String(), "warning: /total: items sum to") {
+		t.Errorf("expected the points and a warning, got: %q", stdout.String())
+	}
+}
@@ -0,0 +1,288 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LedgerEntryType is the reason a ledger entry changed an account's balance.
+type LedgerEntryType string
+
+// Ledger entry types.
+const (
+	LedgerEarn    LedgerEntryType = "earn"    // Points awarded for a submitted receipt
+	LedgerRedeem  LedgerEntryType = "redeem"  // Points spent by the user
+	LedgerExpire  LedgerEntryType = "expire"  // Points that were not used in time
+	LedgerReverse LedgerEntryType = "reverse" // Points of a deleted or fraudulent receipt taken back
+	LedgerAdjust  LedgerEntryType = "adjust"  // Change to the points of an updated receipt
+)
+
+// ReasonReceiptDeleted is the reason recorded when deleting a receipt reverses its points.
+const ReasonReceiptDeleted = "receipt deleted"
+
+// System accounts on the other side of every user entry. The ledger is double-entry:
+// each transaction posts an entry to a user account and an opposite entry to one of
+// these, so the balances of all accounts always sum to zero.
+const (
+	AccountIssued   = "@issued"   // Source of earned points, and sink of reversed ones
+	AccountRedeemed = "@redeemed" // Sink of redeemed points
+	AccountExpired  = "@expired"  // Sink of expired points
+)
+
+// IsSystemAccount reports whether id names a system account rather than a user.
+// User IDs starting with "@" are reserved.
+func IsSystemAccount(id string) bool {
+	return strings.HasPrefix(id, "@")
+}
+
+// contraAccount returns the system account balancing user entries of the given type
+func contraAccount(entryType LedgerEntryType) string {
+	switch entryType {
+	case LedgerRedeem:
+		return AccountRedeemed
+	case LedgerExpire:
+		return AccountExpired
+	default:
+		return AccountIssued
+	}
+}
+
+// Account holds the loyalty points balance of a user or system account. User
+// accounts are opened by the first receipt credited to the user, and their balance
+// never goes negative.
+type Account struct {
+	UserID    string    `json:"userId"`    // User, or system account, the points belong to
+	Balance   int64     `json:"balance"`   // Sum of the points of every ledger entry
+	CreatedAt time.Time `json:"createdAt"` // When the first entry was recorded
+	UpdatedAt time.Time `json:"updatedAt"` // When the balance last changed
+}
+
+// LedgerEntry records one change to an account's balance. Entries are never
+// changed or removed, so an account's entries are its full audit trail.
+type LedgerEntry struct {
+	ID            int64           `json:"id"`                  // Increases with every entry in the store
+	TransactionID int64           `json:"transactionId"`       // Shared by the user and system entries of one transaction
+	UserID        string          `json:"userId"`              // Account the entry belongs to
+	Type          LedgerEntryType `json:"type"`                // Why the balance changed
+	Points        int64           `json:"points"`              // Change to the balance
+	Balance       int64           `json:"balance"`             // Balance after the entry
+	ReceiptID     string          `json:"receiptId,omitempty"` // Receipt that earned, adjusted or took back the points
+	Reference     string          `json:"reference,omitempty"` // Idempotency key of a redemption
+	Reason        string          `json:"reason,omitempty"`    // Why points were redeemed or reversed
+	Shortfall     int64           `json:"shortfall,omitempty"` // Points a reversal or adjustment could not take back because the user no longer held them
+	CreatedAt     time.Time       `json:"createdAt"`           // When the entry was recorded
+}
+
+// Redemption asks to spend points from a user's account. Requests with the same
+// user and Key are applied once.
+type Redemption struct {
+	UserID string
+	Points int64  // Points to spend, positive
+	Key    string // Client-chosen idempotency key
+	Reason string // What the points were spent on
+}
+
+// AccountNotFoundError is returned by a ReceiptStore for a user without an account.
+type AccountNotFoundError struct {
+	UserID string
+}
+
+func (e *AccountNotFoundError) Error() string {
+	return fmt.Sprintf("account for user %s not found", e.UserID)
+}
+
+// InsufficientPointsError is returned when a redemption exceeds the balance.
+type InsufficientPointsError struct {
+	UserID    string
+	Balance   int64 // Points available
+	Requested int64 // Points asked for
+}
+
+func (e *InsufficientPointsError) Error() string {
+	return fmt.Sprintf("user %s has %d points, %d requested", e.UserID, e.Balance, e.Requested)
+}
+
+// RedemptionConflictError is returned when a redemption key is reused for a
+// different number of points.
+type RedemptionConflictError struct {
+	Key      string
+	Existing LedgerEntry // User entry of the original redemption
+}
+
+func (e *RedemptionConflictError) Error() string {
+	return fmt.Sprintf("redemption key %s was already used for %d points", e.Key, -e.Existing.Points)
+}
+
+// CreditNotFoundError is returned when reversing a receipt that credited no user.
+type CreditNotFoundError struct {
+	ReceiptID string
+}
+
+func (e *CreditNotFoundError) Error() string {
+	return fmt.Sprintf("receipt %s credited no points", e.ReceiptID)
+}
+
+// planReversal returns the reversal to post for a receipt's credit, given the user
+// entries of the receipt, oldest first, and the user's balance. Points already spent cannot be
+// taken back, so the reversal takes what the balance allows and records the rest as
+// its shortfall; reversing the receipt again takes back the shortfall once the user
+// holds points again. When there is nothing left to take back from a reversed
+// receipt, planReversal returns its last reversal and false.
+func planReversal(receiptID string, entries []LedgerEntry, balance int64, reason string, at time.Time) (LedgerEntry, bool, error) {
+	var credit, reversal LedgerEntry
+	var held int64
+	for _, entry := range entries {
+		switch entry.Type {
+		case LedgerEarn:
+			credit = entry
+		case LedgerReverse:
+			reversal = entry
+		}
+		held += entry.Points
+	}
+	if credit.ID == 0 {
+		return LedgerEntry{}, false, &CreditNotFoundError{ReceiptID: receiptID}
+	}
+	if held < 0 {
+		held = 0
+	}
+
+	points := held
+	if points > balance {
+		points = balance
+	}
+	if points <= 0 && reversal.ID != 0 {
+		return reversal, false, nil
+	}
+	return LedgerEntry{
+		UserID:    credit.UserID,
+		Type:      LedgerReverse,
+		Points:    -points,
+		ReceiptID: receiptID,
+		Reason:    reason,
+		Shortfall: held - points,
+		CreatedAt: at,
+	}, true, nil
+}
+
+// planAdjustment returns the entry bringing the points a receipt holds in its
+// user's balance to points after the receipt is updated, given the user entries of
+// the receipt and the user's balance, and false when nothing changes. Receipts that
+// credited nobody, or were reversed, are left alone. As with reversals, points
+// already spent cannot be taken back and are recorded as the shortfall; the next
+// update of the receipt tries again.
+func planAdjustment(receiptID string, entries []LedgerEntry, balance, points int64, at time.Time) (LedgerEntry, bool) {
+	var credit LedgerEntry
+	var held int64
+	for _, entry := range entries {
+		switch entry.Type {
+		case LedgerEarn:
+			credit = entry
+		case LedgerReverse:
+			return LedgerEntry{}, false
+		}
+		held += entry.Points
+	}
+	if credit.ID == 0 || points == held {
+		return LedgerEntry{}, false
+	}
+
+	change, shortfall := points-held, int64(0)
+	if change < 0 && -change > balance {
+		change, shortfall = -balance, -change-balance
+	}
+	return LedgerEntry{
+		UserID:    credit.UserID,
+		Type:      LedgerAdjust,
+		Points:    change,
+		ReceiptID: receiptID,
+		Shortfall: shortfall,
+		CreatedAt: at,
+	}, true
+}
+
+// PointsLot is what remains in an account of the points earned by one receipt.
+type PointsLot struct {
+	EntryID   int64     `json:"entryId"`   // Earn entry of the points
+	ReceiptID string    `json:"receiptId"` // Receipt that earned them
+	Points    int64     `json:"points"`    // Points not yet redeemed, reversed or expired
+	EarnedAt  time.Time `json:"earnedAt"`  // When they were credited
+}
+
+// OpenLots returns the lots of a user's ledger entries, oldest first, that still
+// hold points. Reversals and adjustments apply to the lot of their receipt first.
+// Redemptions, expirations and whatever a reversal takes beyond its receipt's lot
+// consume the oldest points still held, first in, first out.
+func OpenLots(entries []LedgerEntry) []PointsLot {
+	var lots []PointsLot
+	lotOf := map[string]int{} // Position in lots of each receipt's lot
+	for _, entry := range entries {
+		i, hasLot := lotOf[entry.ReceiptID]
+		switch {
+		case entry.Type == LedgerEarn:
+			lotOf[entry.ReceiptID] = len(lots)
+			lots = append(lots, PointsLot{EntryID: entry.ID, ReceiptID: entry.ReceiptID, Points: entry.Points, EarnedAt: entry.CreatedAt})
+		case entry.Points > 0 && hasLot:
+			lots[i].Points += entry.Points
+		case entry.Points < 0:
+			debit := -entry.Points
+			if hasLot {
+				debit -= consumeLot(&lots[i], debit)
+			}
+			for j := range lots {
+				if debit == 0 {
+					break
+				}
+				debit -= consumeLot(&lots[j], debit)
+			}
+		}
+	}
+
+	open := []PointsLot{}
+	for _, lot := range lots {
+		if lot.Points > 0 {
+			open = append(open, lot)
+		}
+	}
+	return open
+}
+
+// consumeLot takes up to points from a lot and returns how many it took
+func consumeLot(lot *PointsLot, points int64) int64 {
+	if points > lot.Points {
+		points = lot.Points
+	}
+	if points < 0 {
+		return 0
+	}
+	lot.Points -= points
+	return points
+}
+
+// expiredPoints returns the points of the lots earned at or before cutoff
+func expiredPoints(entries []LedgerEntry, cutoff time.Time) int64 {
+	var points int64
+	for _, lot := range OpenLots(entries) {
+		if !lot.EarnedAt.After(cutoff) {
+			points += lot.Points
+		}
+	}
+	return points
+}
+
+// expirationReason describes an expiration of the points earned at or before cutoff
+func expirationReason(cutoff time.Time) string {
+	return "earned on or before " + cutoff.UTC().Format(time.RFC3339)
+}
+
+// checkRedemption rejects malformed redemption requests
+func checkRedemption(redemption Redemption) error {
+	if redemption.Points <= 0 {
+		return fmt.Errorf("redemption must be for a positive number of points")
+	}
+	if redemption.Key == "" {
+		return fmt.Errorf("redemption requires an idempotency key")
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package common
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddSubmissionCredit(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		first := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		first.UserID = "user-42"
+		second := createSampleReceipt("2", "Retailer B", "2023-11-25", "12:00", "2.00", []Item{{"Item B", "2.00"}})
+		second.UserID = "user-42"
+		anonymous := createSampleReceipt("3", "Retailer C", "2023-11-25", "12:00", "3.00", []Item{{"Item C", "3.00"}})
+
+		if err := store.AddSubmission(Submission{Receipt: first, Points: 10, At: now}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := store.AddSubmission(Submission{Receipt: second, Points: 25, At: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := store.AddSubmission(Submission{Receipt: anonymous, Points: 5, At: now}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		// A rejected receipt credits nothing
+		duplicate := first
+		duplicate.ID = "4"
+		if err := store.AddSubmission(Submission{Receipt: duplicate, Points: 10, At: now}); err == nil {
+			t.Fatalf("%s: expected the duplicate to be rejected", name)
+		}
+
+		account, err := store.GetAccount("user-42")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if account.Balance != 35 || !account.CreatedAt.Equal(now) || !account.UpdatedAt.Equal(now.Add(time.Hour)) {
+			t.Errorf("%s: unexpected account %+v", name, account)
+		}
+
+		entries, err := store.ListLedgerEntries("user-42")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("%s: expected 2 ledger entries, got %+v", name, entries)
+		}
+		if e := entries[0]; e.Type != LedgerEarn || e.ReceiptID != "1" || e.Points != 10 || e.Balance != 10 || !e.CreatedAt.Equal(now) {
+			t.Errorf("%s: unexpected first entry %+v", name, e)
+		}
+		if e := entries[1]; e.ReceiptID != "2" || e.Points != 25 || e.Balance != 35 || e.ID <= entries[0].ID {
+			t.Errorf("%s: unexpected second entry %+v", name, e)
+		}
+
+		var notFound *AccountNotFoundError
+		if _, err := store.GetAccount(""); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected receipts without a user to open no account, got %v", name, err)
+		}
+		if _, err := store.ListLedgerEntries("nobody"); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected AccountNotFoundError, got %v", name, err)
+		}
+	}
+}
+
+func TestReplaceReceiptAdjustsCredit(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		original := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		original.UserID = "user-42"
+		changed := createSampleReceipt("1", "Retailer B", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		resubmitted := original
+		resubmitted.ID = "2"
+
+		// Updating a receipt frees its old content, which can then be submitted again
+		if err := store.AddSubmission(Submission{Receipt: original, Points: 100, At: now}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if _, err := store.ReplaceReceipt("1", changed, 5, nil, AnyVersion, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := store.AddSubmission(Submission{Receipt: resubmitted, Points: 100, At: now}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		var sum int64
+		for _, id := range []string{"1", "2"} {
+			points, _ := store.GetReceiptPoints(id)
+			sum += points
+		}
+		account, _ := store.GetAccount("user-42")
+		if account.Balance != sum || sum != 105 {
+			t.Errorf("%s: expected the balance to equal the receipts' 105 points, got %d", name, account.Balance)
+		}
+		entries, _ := store.ListLedgerEntries("user-42")
+		if adjustment := entries[1]; adjustment.Type != LedgerAdjust || adjustment.ReceiptID != "1" || adjustment.Points != -95 {
+			t.Errorf("%s: unexpected adjustment %+v", name, adjustment)
+		}
+
+		// Spent points are recorded as the shortfall, and taken back by a later update
+		if _, _, err := store.RedeemPoints(Redemption{UserID: "user-42", Points: 100, Key: "order-1"}, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if _, err := store.ReplaceReceipt("2", resubmitted, 0, nil, AnyVersion, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		entries, _ = store.ListLedgerEntries("user-42")
+		if last := entries[len(entries)-1]; last.Type != LedgerAdjust || last.Points != -5 || last.Shortfall != 95 || last.Balance != 0 {
+			t.Errorf("%s: unexpected partial adjustment %+v", name, last)
+		}
+		if _, err := store.ReplaceReceipt("1", changed, 5, nil, AnyVersion, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		entries, _ = store.ListLedgerEntries("user-42")
+		if last := entries[len(entries)-1]; last.Type != LedgerAdjust || last.ReceiptID != "2" || last.Shortfall != 95 {
+			t.Errorf("%s: expected an unchanged receipt to leave the ledger alone, got %+v", name, last)
+		}
+	}
+}
+
+func TestSQLiteMigrationBalancesExistingCredits(t *testing.T) {
+	// Build a database at schema version 8, holding single-entry credits
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations[:8] {
+		if _, err := db.Exec(migration); err != nil {
+			t.Fatalf("migration %d: %v", i+1, err)
+		}
+		db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, '2023-11-26T12:00:00Z')`, i+1)
+	}
+	if _, err := db.Exec(`INSERT INTO accounts VALUES ('user-42', 35, '2023-11-26T12:00:00Z', '2023-11-26T13:00:00Z');
+		INSERT INTO ledger_entries (user_id, type, points, balance, receipt_id, created_at) VALUES
+			('user-42', 'earn', 10, 10, '1', '2023-11-26T12:00:00Z'),
+			('user-42', 'earn', 25, 35, '2', '2023-11-26T13:00:00Z');`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("could not migrate: %v", err)
+	}
+	defer store.Close()
+
+	issued, err := store.GetAccount(AccountIssued)
+	if err != nil || issued.Balance != -35 {
+		t.Fatalf("expected the issued account to balance the credits, got %+v (%v)", issued, err)
+	}
+	entries, _ := store.ListLedgerEntries(AccountIssued)
+	if len(entries) != 2 || entries[1].Points != -25 || entries[1].Balance != -35 || entries[1].ReceiptID != "2" {
+		t.Errorf("unexpected issued entries %+v", entries)
+	}
+	user, _ := store.ListLedgerEntries("user-42")
+	if len(user) != 2 || user[0].TransactionID != entries[0].TransactionID || user[1].TransactionID != entries[1].TransactionID {
+		t.Errorf("expected each credit to share a transaction with its issued entry, got %+v and %+v", user, entries)
+	}
+
+	// New transactions follow the migrated ones
+	entry, _, err := store.RedeemPoints(Redemption{UserID: "user-42", Points: 5, Key: "k"}, time.Now())
+	if err != nil || entry.TransactionID != 3 || entry.Balance != 30 {
+		t.Errorf("unexpected redemption %+v (%v)", entry, err)
+	}
+}
+
+func TestRedeemAndReversePoints(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		for i, points := range []int64{100, 40, 30} {
+			receipt := createSampleReceipt(fmt.Sprint(i+1), fmt.Sprint("Retailer ", i), "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+			receipt.UserID = "user-42"
+			if err := store.AddSubmission(Submission{Receipt: receipt, Points: points, At: now}); err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+		}
+
+		// Redemptions are applied once per key, and never overdraw the account
+		redemption := Redemption{UserID: "user-42", Points: 120, Key: "order-1", Reason: "Gift card"}
+		first, replayed, err := store.RedeemPoints(redemption, now)
+		if err != nil || replayed || first.Points != -120 || first.Balance != 50 || first.Type != LedgerRedeem {
+			t.Fatalf("%s: unexpected redemption %+v, replayed %v (%v)", name, first, replayed, err)
+		}
+		again, replayed, err := store.RedeemPoints(redemption, now.Add(time.Minute))
+		if err != nil || !replayed || again.ID != first.ID {
+			t.Errorf("%s: expected the retry to replay the redemption, got %+v, replayed %v (%v)", name, again, replayed, err)
+		}
+		var conflict *RedemptionConflictError
+		if _, _, err := store.RedeemPoints(Redemption{UserID: "user-42", Points: 10, Key: "order-1"}, now); !errors.As(err, &conflict) {
+			t.Errorf("%s: expected RedemptionConflictError, got %v", name, err)
+		}
+		var insufficient *InsufficientPointsError
+		if _, _, err := store.RedeemPoints(Redemption{UserID: "user-42", Points: 51, Key: "order-2"}, now); !errors.As(err, &insufficient) || insufficient.Balance != 50 {
+			t.Errorf("%s: expected InsufficientPointsError with balance 50, got %v", name, err)
+		}
+		var notFound *AccountNotFoundError
+		if _, _, err := store.RedeemPoints(Redemption{UserID: AccountIssued, Points: 1, Key: "k"}, now); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected system accounts not to be redeemable, got %v", name, err)
+		}
+
+		// Reversing a fraudulent receipt takes back its points, once
+		reversal, err := store.ReverseReceiptCredit("2", "fraud", now)
+		if err != nil || reversal.Points != -40 || reversal.Balance != 10 || reversal.Reason != "fraud" {
+			t.Fatalf("%s: unexpected reversal %+v (%v)", name, reversal, err)
+		}
+		if again, err := store.ReverseReceiptCredit("2", "fraud", now); err != nil || again.ID != reversal.ID {
+			t.Errorf("%s: expected the original reversal, got %+v (%v)", name, again, err)
+		}
+
+		// Deleting a receipt reverses it, but only the points still in the account;
+		// the spent rest is recorded as the shortfall
+		if err := store.DeleteReceipt("3", AnyVersion, now); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		account, _ := store.GetAccount("user-42")
+		if account.Balance != 0 {
+			t.Errorf("%s: expected the balance to stop at 0, got %d", name, account.Balance)
+		}
+		entries, _ := store.ListLedgerEntries("user-42")
+		last := entries[len(entries)-1]
+		if last.Type != LedgerReverse || last.ReceiptID != "3" || last.Points != -10 || last.Shortfall != 20 || last.Reason != ReasonReceiptDeleted {
+			t.Errorf("%s: unexpected deletion reversal %+v", name, last)
+		}
+
+		// Nothing more can be taken back while the balance is 0
+		if again, err := store.ReverseReceiptCredit("3", "fraud", now); err != nil || again.ID != last.ID {
+			t.Errorf("%s: expected the deletion reversal, got %+v (%v)", name, again, err)
+		}
+
+		// Once the user earns points again, reversing again takes back the shortfall
+		later := createSampleReceipt("5", "Retailer Y", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		later.UserID = "user-42"
+		if err := store.AddSubmission(Submission{Receipt: later, Points: 50, At: now}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		recovered, err := store.ReverseReceiptCredit("3", "fraud", now)
+		if err != nil || recovered.ID == last.ID || recovered.Points != -20 || recovered.Shortfall != 0 || recovered.Balance != 30 {
+			t.Errorf("%s: expected the shortfall of 20 to be taken back, got %+v (%v)", name, recovered, err)
+		}
+		if again, err := store.ReverseReceiptCredit("3", "fraud", now); err != nil || again.ID != recovered.ID {
+			t.Errorf("%s: expected the last reversal once fully reversed, got %+v (%v)", name, again, err)
+		}
+		account, _ = store.GetAccount("user-42")
+
+		// Every transaction balances against a system account
+		total := account.Balance
+		for _, id := range []string{AccountIssued, AccountRedeemed} {
+			system, err := store.GetAccount(id)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			total += system.Balance
+		}
+		if total != 0 {
+			t.Errorf("%s: expected all balances to sum to 0, got %d", name, total)
+		}
+		if redeemed, _ := store.GetAccount(AccountRedeemed); redeemed.Balance != 120 {
+			t.Errorf("%s: expected 120 redeemed points, got %d", name, redeemed.Balance)
+		}
+
+		var noCredit *CreditNotFoundError
+		anonymous := createSampleReceipt("4", "Retailer Z", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		store.AddSubmission(Submission{Receipt: anonymous, Points: 5, At: now})
+		if _, err := store.ReverseReceiptCredit("4", "fraud", now); !errors.As(err, &noCredit) {
+			t.Errorf("%s: expected CreditNotFoundError, got %v", name, err)
+		}
+	}
+}
+
+func TestOpenLots(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []LedgerEntry{
+		{ID: 1, Type: LedgerEarn, Points: 100, ReceiptID: "a", CreatedAt: day},
+		{ID: 2, Type: LedgerEarn, Points: 50, ReceiptID: "b", CreatedAt: day.AddDate(0, 0, 1)},
+		{ID: 3, Type: LedgerRedeem, Points: -120, CreatedAt: day.AddDate(0, 0, 2)},
+		{ID: 4, Type: LedgerEarn, Points: 20, ReceiptID: "c", CreatedAt: day.AddDate(0, 0, 3)},
+	}
+
+	// The redemption consumes the oldest points first: all of a, then 20 of b
+	lots := OpenLots(entries)
+	if len(lots) != 2 || lots[0].ReceiptID != "b" || lots[0].Points != 30 || lots[1].ReceiptID != "c" || lots[1].Points != 20 {
+		t.Errorf("unexpected lots %+v", lots)
+	}
+	if !lots[0].EarnedAt.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("expected b to be earned on day 2, got %v", lots[0].EarnedAt)
+	}
+	if points := expiredPoints(entries, day.AddDate(0, 0, 1)); points != 30 {
+		t.Errorf("expected 30 points earned by day 2 to remain, got %d", points)
+	}
+
+	// Reversals and adjustments apply to their own receipt's lot, and only what
+	// exceeds it is taken first in, first out
+	entries = append(entries,
+		LedgerEntry{ID: 5, Type: LedgerEarn, Points: 40, ReceiptID: "d", CreatedAt: day.AddDate(0, 0, 4)},
+		LedgerEntry{ID: 6, Type: LedgerReverse, Points: -20, ReceiptID: "c", CreatedAt: day.AddDate(0, 0, 5)},
+		LedgerEntry{ID: 7, Type: LedgerAdjust, Points: 10, ReceiptID: "b", CreatedAt: day.AddDate(0, 0, 5)},
+		LedgerEntry{ID: 8, Type: LedgerAdjust, Points: -50, ReceiptID: "d", CreatedAt: day.AddDate(0, 0, 6)},
+	)
+	lots = OpenLots(entries)
+	if len(lots) != 1 || lots[0].ReceiptID != "b" || lots[0].Points != 30 {
+		t.Errorf("expected only 30 points of b to remain, got %+v", lots)
+	}
+}
+
+func TestExpirePoints(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		credit := func(id, user string, points int64, at time.Time) {
+			receipt := createSampleReceipt(id, "Retailer "+id, "2022-12-31", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+			receipt.UserID = user
+			if err := store.AddSubmission(Submission{Receipt: receipt, Points: points, At: at}); err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+		}
+		credit("1", "alice", 100, day)
+		credit("2", "alice", 50, day.AddDate(0, 0, 10))
+		credit("3", "bob", 70, day.AddDate(0, 0, 1))
+		if _, _, err := store.RedeemPoints(Redemption{UserID: "alice", Points: 30, Key: "k"}, day.AddDate(0, 0, 5)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		// Expire what was earned by day 2: 70 of alice's first receipt and bob's 70
+		cutoff := day.AddDate(0, 0, 1)
+		expired, err := store.ExpirePoints(cutoff, day.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(expired) != 2 || expired[0].UserID != "alice" || expired[0].Points != -70 || expired[0].Balance != 50 ||
+			expired[1].UserID != "bob" || expired[1].Points != -70 || expired[1].Balance != 0 || expired[0].Type != LedgerExpire {
+			t.Fatalf("%s: unexpected expirations %+v", name, expired)
+		}
+
+		// Running again with the same cutoff finds nothing left to expire
+		if again, err := store.ExpirePoints(cutoff, day.AddDate(0, 1, 0)); err != nil || len(again) != 0 {
+			t.Errorf("%s: expected nothing to expire twice, got %+v (%v)", name, again, err)
+		}
+		if system, _ := store.GetAccount(AccountExpired); system.Balance != 140 {
+			t.Errorf("%s: expected 140 points in the expired account, got %d", name, system.Balance)
+		}
+		entries, _ := store.ListLedgerEntries("alice")
+		if lots := OpenLots(entries); len(lots) != 1 || lots[0].ReceiptID != "2" || lots[0].Points != 50 {
+			t.Errorf("%s: expected only the second receipt's points to remain, got %+v", name, lots)
+		}
+	}
+}
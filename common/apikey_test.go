@@ -0,0 +1,115 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	secret, key, err := NewAPIKey("acme", []string{ScopeReceiptsRead}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(secret, "rk_") || key.Hash != HashAPIKey(secret) || strings.Contains(key.Hash, secret) {
+		t.Errorf("expected the key to hold only the hash of the secret, got %+v", key)
+	}
+	if key.ClientID != "acme" || !key.CreatedAt.Equal(now) || !key.Active() {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	if _, _, err := NewAPIKey("acme", []string{"receipts:admin"}, now); err == nil {
+		t.Errorf("expected an unknown scope to be rejected")
+	}
+	if _, _, err := NewAPIKey(" ", []string{ScopeReceiptsRead}, now); err == nil {
+		t.Errorf("expected an empty client ID to be rejected")
+	}
+}
+
+func TestAPIKeyStorage(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	for name, store := range stores {
+		secret, key, _ := NewAPIKey("acme", []string{ScopeReceiptsRead, ScopeReceiptsWrite}, now)
+		if err := store.SaveAPIKey(key); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := store.SaveAPIKey(key); err == nil {
+			t.Errorf("%s: expected a second save of the same key to fail", name)
+		}
+
+		found, err := store.GetAPIKeyByHash(HashAPIKey(secret))
+		if err != nil || found.ID != key.ID || found.ClientID != "acme" || len(found.Scopes) != 2 || !found.Active() {
+			t.Errorf("%s: expected the stored key, got %+v (%v)", name, found, err)
+		}
+		var notFound *APIKeyNotFoundError
+		if _, err := store.GetAPIKeyByHash(HashAPIKey("rk_unknown")); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected a not found error, got %v", name, err)
+		}
+
+		if err := store.RevokeAPIKey(key.ID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if found, _ := store.GetAPIKeyByHash(key.Hash); found.Active() || !found.RevokedAt.Equal(now.Add(time.Hour)) {
+			t.Errorf("%s: expected the key to be revoked, got %+v", name, found)
+		}
+		if err := store.RevokeAPIKey("missing", now); !errors.As(err, &notFound) {
+			t.Errorf("%s: expected a not found error, got %v", name, err)
+		}
+
+		keys, err := store.ListAPIKeys()
+		if err != nil || len(keys) != 1 || keys[0].ID != key.ID {
+			t.Errorf("%s: expected one listed key, got %+v (%v)", name, keys, err)
+		}
+	}
+}
+
+func TestReceiptsAreTaggedWithClient(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+
+	for name, store := range stores {
+		first := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		first.ClientID = "acme"
+		first.UserID = "user-42"
+		second := first
+		second.ID = "2"
+		second.ClientID = "globex"
+		second.UserID = ""
+
+		// The same content from different clients is not a duplicate
+		if err := store.AddSubmission(Submission{Receipt: first, Points: 10}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if err := store.AddSubmission(Submission{Receipt: second, Points: 10}); err != nil {
+			t.Fatalf("%s: expected another client's identical receipt to be stored, got %v", name, err)
+		}
+
+		if stored, _ := store.GetReceiptByID("1"); stored.ClientID != "acme" || stored.UserID != "user-42" {
+			t.Errorf("%s: expected client acme and user user-42, got %q and %q", name, stored.ClientID, stored.UserID)
+		}
+		page, err := store.ListReceipts(ReceiptFilter{ClientID: "globex"})
+		if err != nil || len(page.Receipts) != 1 || page.Receipts[0].ID != "2" {
+			t.Errorf("%s: expected only globex's receipt, got %+v (%v)", name, page.Receipts, err)
+		}
+
+		// Replacing a receipt keeps its client and user
+		replacement := createSampleReceipt("1", "Retailer B", "2023-11-25", "12:00", "2.00", []Item{{"Item B", "2.00"}})
+		if _, err := store.ReplaceReceipt("1", replacement, 20, nil, AnyVersion, time.Now()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if stored, _ := store.GetReceiptByID("1"); stored.ClientID != "acme" || stored.UserID != "user-42" {
+			t.Errorf("%s: expected the replaced receipt to keep client acme and user user-42, got %q and %q", name, stored.ClientID, stored.UserID)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package common
+
+import "time"
+
+// Clock provides the current time, allowing tests to control it.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock backed by the system time.
+type SystemClock struct{}
+
+// Now returns the current system time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock that always returns the same time.
+type FixedClock struct {
+	Time time.Time
+}
+
+// Now returns the fixed time.
+func (c FixedClock) Now() time.Time {
+	return c.Time
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedClock(t *testing.T) {
+	fixed := time.Date(2023, 11, 25, 12, 0, 0, 0, time.UTC)
+	var clock Clock = FixedClock{Time: fixed}
+
+	if !clock.Now().Equal(fixed) {
+		t.Errorf("expected %v, got %v", fixed, clock.Now())
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	before := time.Now()
+	now := SystemClock{}.Now()
+
+	if now.Before(before) {
+		t.Errorf("expected system clock to return the current time, got %v", now)
+	}
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DuplicateReceiptError is returned by a ReceiptStore when a receipt has the same
+// content fingerprint as one that is already stored.
+type DuplicateReceiptError struct {
+	ExistingID string // ID of the receipt that was stored first
+}
+
+func (e *DuplicateReceiptError) Error() string {
+	return fmt.Sprintf("receipt duplicates existing receipt %s", e.ExistingID)
+}
+
+// Fingerprint returns a stable hash of the receipt content, ignoring its ID.
+// The retailer and item descriptions are compared case-insensitively with collapsed
+// whitespace, amounts by their value in cents, and items regardless of their order.
+// Receipts of different clients, or of different users, never share a fingerprint.
+func Fingerprint(receipt Receipt) string {
+	items := make([]string, len(receipt.Items))
+	for i, item := range receipt.Items {
+		items[i] = canonicalText(item.ShortDescription) + "\x1f" + canonicalAmount(item.Price)
+	}
+	sort.Strings(items)
+
+	parts := []string{
+		canonicalText(receipt.Retailer),
+		strings.TrimSpace(receipt.PurchaseDate),
+		strings.TrimSpace(receipt.PurchaseTime),
+		canonicalAmount(receipt.Total),
+	}
+	parts = append(parts, items...)
+	if receipt.ClientID != "" {
+		parts = append(parts, "client:"+receipt.ClientID)
+	}
+	if receipt.UserID != "" {
+		parts = append(parts, "user:"+receipt.UserID)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1e")))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalText lowercases text and collapses runs of whitespace.
+func canonicalText(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+// canonicalAmount formats an amount in cents, falling back to the trimmed text if it cannot be parsed.
+func canonicalAmount(value string) string {
+	amount, err := ParseMoney(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return amount.String()
+}
@@ -0,0 +1,24 @@
+package common
+
+import "testing"
+
+func TestFingerprintCanonicalizes(t *testing.T) {
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{
+		{"Item A", "50.00"},
+		{"Item B", "50.00"},
+	})
+	variant := createSampleReceipt("2", "  retailer   a ", "2023-11-25", "12:00", "100.0", []Item{
+		{"item b", "50.00"},
+		{"ITEM A", "50"},
+	})
+
+	if Fingerprint(receipt) != Fingerprint(variant) {
+		t.Errorf("expected receipts differing only in formatting, ID and item order to share a fingerprint")
+	}
+
+	changed := receipt
+	changed.Total = "100.01"
+	if Fingerprint(receipt) == Fingerprint(changed) {
+		t.Errorf("expected a different total to change the fingerprint")
+	}
+}
@@ -0,0 +1,25 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// ReadLine reads the next line of an NDJSON stream, keeping at most limit bytes of
+// it besides the line ending. The rest of a longer line is skipped and reported with
+// tooLong, so one oversized record does not stop the stream. At the end of the
+// stream it returns the last line, possibly empty, with io.EOF.
+func ReadLine(reader *bufio.Reader, limit int64) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if int64(len(bytes.TrimRight(line, "\r\n"))) > limit {
+				line, tooLong = nil, true
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
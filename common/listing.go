@@ -0,0 +1,108 @@
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Page size limits for ListReceipts.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ReceiptRecord is a stored receipt together with the points it was awarded.
+type ReceiptRecord struct {
+	Receipt
+	Points int64 `json:"points"` // Points awarded to the receipt
+}
+
+// ReceiptFilter selects and paginates receipts for ListReceipts.
+// Zero values (and nil pointers) leave a criterion unrestricted.
+type ReceiptFilter struct {
+	Retailer  string // Case-insensitive substring of the retailer name
+	DateFrom  string // Earliest purchase date, YYYY-MM-DD inclusive
+	DateTo    string // Latest purchase date, YYYY-MM-DD inclusive
+	MinTotal  *Money // Smallest total, inclusive
+	MaxTotal  *Money // Largest total, inclusive
+	MinPoints *int64 // Fewest points, inclusive
+	MaxPoints *int64 // Most points, inclusive
+	ClientID  string // Client that submitted the receipts
+	UserID    string // User the receipts were credited to
+	Cursor    string // Opaque cursor from a previous page's NextCursor
+	Limit     int    // Page size, DefaultPageSize if zero
+}
+
+// ReceiptPage is one page of ListReceipts results, in insertion order.
+type ReceiptPage struct {
+	Receipts   []ReceiptRecord `json:"receipts"`             // Receipts on this page
+	NextCursor string          `json:"nextCursor,omitempty"` // Cursor for the next page, empty on the last page
+}
+
+// pageSize returns the effective page size of the filter.
+func (f ReceiptFilter) pageSize() int {
+	switch {
+	case f.Limit <= 0:
+		return DefaultPageSize
+	case f.Limit > MaxPageSize:
+		return MaxPageSize
+	default:
+		return f.Limit
+	}
+}
+
+// matches reports whether a record satisfies every criterion of the filter.
+func (f ReceiptFilter) matches(record ReceiptRecord, total Money) bool {
+	if f.ClientID != "" && record.ClientID != f.ClientID {
+		return false
+	}
+	if f.UserID != "" && record.UserID != f.UserID {
+		return false
+	}
+	if f.Retailer != "" && !strings.Contains(strings.ToLower(record.Retailer), strings.ToLower(f.Retailer)) {
+		return false
+	}
+	if f.DateFrom != "" && record.PurchaseDate < f.DateFrom {
+		return false
+	}
+	if f.DateTo != "" && record.PurchaseDate > f.DateTo {
+		return false
+	}
+	if f.MinTotal != nil && total < *f.MinTotal {
+		return false
+	}
+	if f.MaxTotal != nil && total > *f.MaxTotal {
+		return false
+	}
+	if f.MinPoints != nil && record.Points < *f.MinPoints {
+		return false
+	}
+	if f.MaxPoints != nil && record.Points > *f.MaxPoints {
+		return false
+	}
+	return true
+}
+
+// EncodeCursor turns the insertion sequence number of the last receipt on a page
+// into an opaque cursor; the next page starts after that receipt.
+func EncodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(seq, 10)))
+}
+
+// DecodeCursor returns the insertion sequence number of a cursor; an empty cursor is 0.
+func DecodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	seq, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return seq, nil
+}
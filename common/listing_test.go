@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Helper function to fill a store with ten receipts: totals 1.00..10.00, points 10..100,
+// purchase dates 2023-11-01..2023-11-10, alternating between two retailers
+func seedListingStore(t *testing.T, store ReceiptStore) {
+	t.Helper()
+	for i := 1; i <= 10; i++ {
+		retailer := "Target"
+		if i%2 == 0 {
+			retailer = "Walgreens"
+		}
+		total := fmt.Sprintf("%d.00", i)
+		receipt := createSampleReceipt(fmt.Sprint(i), retailer, fmt.Sprintf("2023-11-%02d", i), "12:00", total, []Item{{"Item", total}})
+		if err := store.AddSubmission(Submission{Receipt: receipt, Points: int64(i * 10)}); err != nil {
+			t.Fatalf("could not add receipt %d: %v", i, err)
+		}
+	}
+}
+
+// Helper function to follow cursors until the last page and return the IDs seen
+func listAllIDs(t *testing.T, store ReceiptStore, filter ReceiptFilter) []string {
+	t.Helper()
+	var ids []string
+	for {
+		page, err := store.ListReceipts(filter)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		for _, record := range page.Receipts {
+			ids = append(ids, record.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		filter.Cursor = page.NextCursor
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+
+	minTotal, maxTotal := Money(300), Money(800)
+	minPoints, maxPoints := int64(50), int64(90)
+
+	tests := []struct {
+		description string
+		filter      ReceiptFilter
+		expected    string
+	}{
+		{"all receipts in pages of three", ReceiptFilter{Limit: 3}, "[1 2 3 4 5 6 7 8 9 10]"},
+		{"retailer", ReceiptFilter{Retailer: "target", Limit: 2}, "[1 3 5 7 9]"},
+		{"date range", ReceiptFilter{DateFrom: "2023-11-04", DateTo: "2023-11-06"}, "[4 5 6]"},
+		{"total range", ReceiptFilter{MinTotal: &minTotal, MaxTotal: &maxTotal, Limit: 4}, "[3 4 5 6 7 8]"},
+		{"points range with retailer", ReceiptFilter{Retailer: "walgreens", MinPoints: &minPoints, MaxPoints: &maxPoints}, "[6 8]"},
+	}
+
+	cursors := map[string]string{}
+	for name, store := range stores {
+		seedListingStore(t, store)
+		for _, tt := range tests {
+			ids := fmt.Sprint(listAllIDs(t, store, tt.filter))
+			if ids != tt.expected {
+				t.Errorf("%s, %s: expected %s, got %s", name, tt.description, tt.expected, ids)
+			}
+		}
+
+		page, _ := store.ListReceipts(ReceiptFilter{Limit: 1})
+		if len(page.Receipts) != 1 || page.Receipts[0].Points != 10 || len(page.Receipts[0].Items) != 1 {
+			t.Errorf("%s: expected the first receipt with its points and items, got %+v", name, page.Receipts)
+		}
+
+		// A cursor points after the last receipt of its page, whatever the backend
+		page, _ = store.ListReceipts(ReceiptFilter{Retailer: "walgreens", Limit: 2})
+		cursors[name] = page.NextCursor
+		page, _ = store.ListReceipts(ReceiptFilter{Cursor: page.NextCursor, Limit: 1})
+		if len(page.Receipts) != 1 || page.Receipts[0].ID != "5" {
+			t.Errorf("%s: expected the page after receipt 4 to start at receipt 5, got %+v", name, page.Receipts)
+		}
+
+		if _, err := store.ListReceipts(ReceiptFilter{Cursor: "not-a-cursor!"}); err == nil {
+			t.Errorf("%s: expected error for an invalid cursor", name)
+		}
+	}
+	if cursors["memory"] != cursors["sqlite"] {
+		t.Errorf("expected both stores to encode the same position, got %q and %q", cursors["memory"], cursors["sqlite"])
+	}
+}
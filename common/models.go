@@ -1,14 +1,18 @@
 // store common structs
 package common
 
+import "time"
+
 // Receipt represents the structure of a receipt.
 type Receipt struct {
-	ID           string `json:"id"`           // Unique identifier for the receipt
-	Retailer     string `json:"retailer"`     // Retailer's name
-	PurchaseDate string `json:"purchaseDate"` // Date of purchase
-	PurchaseTime string `json:"purchaseTime"` // Time of purchase
-	Items        []Item `json:"items"`        // List of purchased items
-	Total        string `json:"total"`        // Total purchase amount
+	ID           string `json:"id"`                 // Unique identifier for the receipt
+	Retailer     string `json:"retailer"`           // Retailer's name
+	PurchaseDate string `json:"purchaseDate"`       // Date of purchase
+	PurchaseTime string `json:"purchaseTime"`       // Time of purchase
+	Items        []Item `json:"items"`              // List of purchased items
+	Total        string `json:"total"`              // Total purchase amount
+	ClientID     string `json:"clientId,omitempty"` // API client that submitted the receipt, empty without authentication
+	UserID       string `json:"userId,omitempty"`   // End user the receipt's points are attributed to, from a bearer token
 }
 
 // Item represents an item within a receipt.
@@ -16,3 +20,29 @@ type Item struct {
 	ShortDescription string `json:"shortDescription"` // Item description
 	Price            string `json:"price"`            // Price of the item
 }
+
+// RuleResult records how a single points rule scored a receipt.
+type RuleResult struct {
+	Rule    string `json:"rule"`    // Name of the rule
+	Matched bool   `json:"matched"` // Whether the rule awarded points
+	Input   string `json:"input"`   // Receipt value(s) the rule looked at
+	Points  int64  `json:"points"`  // Points contributed by the rule
+}
+
+// SumPoints returns the total points of a rule breakdown.
+func SumPoints(breakdown []RuleResult) int64 {
+	points := int64(0)
+	for _, result := range breakdown {
+		points += result.Points
+	}
+	return points
+}
+
+// IdempotencyRecord remembers the outcome of a request made with an Idempotency-Key header.
+type IdempotencyRecord struct {
+	Key                string    // Client-supplied idempotency key
+	ReceiptID          string    // ID of the receipt created by the original request
+	Status             int       // HTTP status of the original response
+	RequestFingerprint string    // Fingerprint of the original receipt, to detect key reuse with different content
+	CreatedAt          time.Time // When the original request was processed
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount in integer cents.
+type Money int64
+
+// ParseMoney parses a decimal amount such as "12", "12.3" or "12.34" into cents.
+// More than two decimal places, malformed input and overflow are reported as errors.
+func ParseMoney(value string) (Money, error) {
+	s := strings.TrimSpace(value)
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+
+	whole, fraction, hasPoint := strings.Cut(s, ".")
+	if whole == "" || !isDigits(whole) || (hasPoint && (fraction == "" || !isDigits(fraction))) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("invalid amount %q: more than two decimal places", value)
+	}
+
+	dollars, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || dollars > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid amount %q: out of range", value)
+	}
+	cents := int64(0)
+	if fraction != "" {
+		cents, _ = strconv.ParseInt(fraction, 10, 64)
+		if len(fraction) == 1 {
+			cents *= 10
+		}
+	}
+
+	amount := Money(dollars*100 + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// Cents returns the amount in cents.
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// IsWholeDollar reports whether the amount has no cents.
+func (m Money) IsWholeDollar() bool {
+	return m%100 == 0
+}
+
+// IsMultipleOf reports whether the amount is an exact multiple of factor.
+// A non-positive factor never matches.
+func (m Money) IsMultipleOf(factor Money) bool {
+	return factor > 0 && m%factor == 0
+}
+
+// String formats the amount with two decimal places, e.g. "12.34".
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// isDigits reports whether s consists only of ASCII digits.
+func isDigits(s string) bool {
+	for _, char := range s {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
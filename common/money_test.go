@@ -0,0 +1,55 @@
+package common
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value string
+		cents int64
+	}{
+		{"0.00", 0},
+		{"12", 1200},
+		{"12.3", 1230},
+		{"12.34", 1234},
+		{"14.00", 1400},
+		{"-1.05", -105},
+	}
+
+	for _, tt := range tests {
+		amount, err := ParseMoney(tt.value)
+		if err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.value, err)
+			continue
+		}
+		if amount.Cents() != tt.cents {
+			t.Errorf("%s: expected %d cents, got %d", tt.value, tt.cents, amount.Cents())
+		}
+	}
+}
+
+func TestParseMoneyInvalid(t *testing.T) {
+	for _, value := range []string{"", "abc", "1.", ".50", "1.234", "1,00", "1e3", "99999999999999999999.00"} {
+		if _, err := ParseMoney(value); err == nil {
+			t.Errorf("%q: expected an error, got none", value)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	total, _ := ParseMoney("9.00")
+	quarter, _ := ParseMoney("0.25")
+	odd, _ := ParseMoney("35.35")
+
+	if !total.IsWholeDollar() || odd.IsWholeDollar() {
+		t.Errorf("unexpected whole dollar result for %s or %s", total, odd)
+	}
+	if !total.IsMultipleOf(quarter) || odd.IsMultipleOf(quarter) {
+		t.Errorf("unexpected multiple of 0.25 result for %s or %s", total, odd)
+	}
+	if total.IsMultipleOf(0) {
+		t.Errorf("expected a zero factor never to match")
+	}
+	if odd.String() != "35.35" || Money(-5).String() != "-0.05" {
+		t.Errorf("unexpected formatting: %s, %s", odd, Money(-5))
+	}
+}
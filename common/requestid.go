@@ -0,0 +1,37 @@
+package common
+
+import "context"
+
+// RequestIDHeader carries the ID correlating a request with its logs and response.
+const RequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the longest client-supplied request ID that is accepted.
+const MaxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ValidRequestID reports whether a client-supplied request ID may be reused:
+// non-empty, at most MaxRequestIDLength characters and printable ASCII without spaces.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
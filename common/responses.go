@@ -8,14 +8,27 @@ import (
 
 // JSONResponse represents a standard API response format.
 type JSONResponse struct {
-	Success bool        `json:"success"`           // Indicates if the operation was successful
-	Data    interface{} `json:"data,omitempty"`    // Data payload, optional
-	Error   string      `json:"error,omitempty"`   // Error message, optional
-	Message string      `json:"message,omitempty"` // Additional message, optional
+	Success   bool          `json:"success"`             // Indicates if the operation was successful
+	Data      interface{}   `json:"data,omitempty"`      // Data payload, optional
+	Error     string        `json:"error,omitempty"`     // Error message, optional
+	Errors    []ErrorDetail `json:"errors,omitempty"`    // Individual problems behind Error, optional
+	Message   string        `json:"message,omitempty"`   // Additional message, optional
+	RequestID string        `json:"requestId,omitempty"` // ID of the failed request, for correlation with the logs
 }
 
-// RespondWithJSON sends a JSON response.
+// ErrorDetail describes a single problem with a request field.
+type ErrorDetail struct {
+	Path    string `json:"path"`    // JSON pointer to the field, e.g. /items/3/price
+	Code    string `json:"code"`    // Machine-readable error code, e.g. invalid_format
+	Message string `json:"message"` // Human-readable description
+}
+
+// RespondWithJSON sends a JSON response. Error responses carry the request ID
+// already set in the RequestIDHeader response header.
 func RespondWithJSON(w http.ResponseWriter, status int, payload JSONResponse) {
+	if !payload.Success && payload.RequestID == "" {
+		payload.RequestID = w.Header().Get(RequestIDHeader)
+	}
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -30,6 +43,15 @@ func RespondWithError(w http.ResponseWriter, status int, errorMessage string) {
 	})
 }
 
+// RespondWithErrors sends an error response listing each individual problem.
+func RespondWithErrors(w http.ResponseWriter, status int, errorMessage string, details []ErrorDetail) {
+	RespondWithJSON(w, status, JSONResponse{
+		Success: false,
+		Error:   errorMessage,
+		Errors:  details,
+	})
+}
+
 // RespondWithSuccess sends a success response.
 func RespondWithSuccess(w http.ResponseWriter, status int, data interface{}, message string) {
 	RespondWithJSON(w, status, JSONResponse{
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -69,3 +70,67 @@ func TestRespondWithError(t *testing.T) {
 		t.Errorf("expected error message '%s', got '%s'", errorMessage, response.Error)
 	}
 }
+
+func TestRespondWithErrors(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	details := []ErrorDetail{
+		{Path: "/retailer", Code: "required", Message: "retailer is required"},
+		{Path: "/items/3/price", Code: "invalid_format", Message: "invalid price for an item, expected a decimal with two places"},
+	}
+	RespondWithErrors(rr, http.StatusBadRequest, "Validation failed", details)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	var response JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+
+	if response.Success || response.Error != "Validation failed" {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if len(response.Errors) != 2 || response.Errors[1] != details[1] {
+		t.Errorf("expected errors %+v, got %+v", details, response.Errors)
+	}
+}
+
+func TestRespondWithErrorCarriesRequestID(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set(RequestIDHeader, "req-123")
+
+	RespondWithError(rr, http.StatusNotFound, "Receipt not found")
+
+	var response JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+	if response.RequestID != "req-123" {
+		t.Errorf("expected request ID req-123, got %q", response.RequestID)
+	}
+
+	rr = httptest.NewRecorder()
+	rr.Header().Set(RequestIDHeader, "req-123")
+	RespondWithSuccess(rr, http.StatusOK, nil, "ok")
+	var success JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &success); err != nil || success.RequestID != "" {
+		t.Errorf("expected no request ID on success, got %q (%v)", success.RequestID, err)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"abc-123":                true,
+		"":                       false,
+		"has space":              false,
+		"line\nbreak":            false,
+		strings.Repeat("x", 129): false,
+		strings.Repeat("x", 128): true,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
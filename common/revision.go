@@ -0,0 +1,40 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// AnyVersion disables the version check of a conditional update or delete.
+const AnyVersion int64 = 0
+
+// VersionConflictError is returned by a ReceiptStore when a conditional update or
+// delete expected a different version than the one currently stored.
+type VersionConflictError struct {
+	ID      string // ID of the receipt
+	Current int64  // Version currently stored
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("receipt %s is at version %d", e.ID, e.Current)
+}
+
+// ReceiptNotFoundError is returned by a ReceiptStore for an ID that was never stored.
+type ReceiptNotFoundError struct {
+	ID string
+}
+
+func (e *ReceiptNotFoundError) Error() string {
+	return fmt.Sprintf("receipt with ID %s not found", e.ID)
+}
+
+// ReceiptDeletedError is returned by a ReceiptStore when a receipt has been
+// soft-deleted. The receipt is kept as a tombstone so its ID is never reused.
+type ReceiptDeletedError struct {
+	ID        string    // ID of the deleted receipt
+	DeletedAt time.Time // When the receipt was deleted
+}
+
+func (e *ReceiptDeletedError) Error() string {
+	return fmt.Sprintf("receipt with ID %s was deleted", e.ID)
+}
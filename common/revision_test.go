@@ -0,0 +1,87 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReplaceAndDeleteReceipt(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+
+	deletedAt := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	for name, store := range stores {
+		receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		store.AddSubmission(Submission{Receipt: receipt, Points: 10, Breakdown: []RuleResult{{Rule: "old", Matched: true, Points: 10}}})
+		var notFound *ReceiptNotFoundError
+		if _, err := store.GetReceiptByID("2"); !errors.As(err, &notFound) || notFound.ID != "2" {
+			t.Errorf("%s: expected a not found error, got: %v", name, err)
+		}
+
+		if version, err := store.GetReceiptVersion("1"); err != nil || version != 1 {
+			t.Errorf("%s: expected version 1, got %d (%v)", name, version, err)
+		}
+
+		// A stale version is rejected without changing the receipt
+		updated := createSampleReceipt("1", "Retailer B", "2023-11-25", "12:00", "2.00", []Item{{"Item B", "2.00"}})
+		breakdown := []RuleResult{{Rule: "new", Matched: true, Points: 20}}
+		var conflict *VersionConflictError
+		if _, err := store.ReplaceReceipt("1", updated, 20, breakdown, 5, time.Now()); !errors.As(err, &conflict) || conflict.Current != 1 {
+			t.Errorf("%s: expected a version conflict at 1, got: %v", name, err)
+		}
+
+		version, err := store.ReplaceReceipt("1", updated, 20, breakdown, 1, time.Now())
+		if err != nil || version != 2 {
+			t.Fatalf("%s: expected version 2, got %d (%v)", name, version, err)
+		}
+		stored, _ := store.GetReceiptBreakdown("1")
+		if len(stored) != 1 || stored[0].Rule != "new" {
+			t.Errorf("%s: expected the breakdown to be replaced, got: %+v", name, stored)
+		}
+		record, version, err := store.GetReceiptRecord("1")
+		if err != nil || version != 2 || record.Retailer != "Retailer B" || record.Points != 20 || len(record.Items) != 1 {
+			t.Errorf("%s: expected the replaced receipt at version 2, got %+v at %d (%v)", name, record, version, err)
+		}
+
+		if err := store.DeleteReceipt("1", 1, deletedAt); !errors.As(err, &conflict) {
+			t.Errorf("%s: expected a version conflict on delete, got: %v", name, err)
+		}
+		if err := store.DeleteReceipt("1", 2, deletedAt); err != nil {
+			t.Fatalf("%s: expected no error, but got: %v", name, err)
+		}
+
+		// The tombstone hides the receipt but keeps its ID reserved
+		var deleted *ReceiptDeletedError
+		if _, err := store.GetReceiptByID("1"); !errors.As(err, &deleted) || !deleted.DeletedAt.Equal(deletedAt) {
+			t.Errorf("%s: expected a deleted error, got: %v", name, err)
+		}
+		if _, _, err := store.GetReceiptRecord("1"); !errors.As(err, &deleted) {
+			t.Errorf("%s: expected a deleted error for the record, got: %v", name, err)
+		}
+		if _, err := store.GetReceiptPoints("1"); !errors.As(err, &deleted) {
+			t.Errorf("%s: expected a deleted error for points, got: %v", name, err)
+		}
+		if err := store.DeleteReceipt("1", AnyVersion, deletedAt); !errors.As(err, &deleted) {
+			t.Errorf("%s: expected a deleted error on a second delete, got: %v", name, err)
+		}
+		if _, err := store.GetAllReceipts(); err == nil {
+			t.Errorf("%s: expected deleted receipts to be excluded", name)
+		}
+		if page, _ := store.ListReceipts(ReceiptFilter{}); len(page.Receipts) != 0 {
+			t.Errorf("%s: expected an empty listing, got: %+v", name, page.Receipts)
+		}
+		if err := store.AddSubmission(Submission{Receipt: updated, Points: 20}); err == nil {
+			t.Errorf("%s: expected the ID of a deleted receipt not to be reused", name)
+		}
+
+		// The same content can be submitted again under a new ID
+		updated.ID = "2"
+		if err := store.AddSubmission(Submission{Receipt: updated, Points: 20}); err != nil {
+			t.Errorf("%s: expected no duplicate of a deleted receipt, got: %v", name, err)
+		}
+	}
+}
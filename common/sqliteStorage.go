@@ -0,0 +1,1121 @@
+package common
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver
+)
+
+// migrations holds the schema changes for the SQLite storage, applied in order.
+// Each entry is recorded in schema_migrations once applied; never edit an
+// existing entry, append a new one instead.
+var migrations = []string{
+	// 1: receipts, their items and the points awarded to them
+	`CREATE TABLE receipts (
+		seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+		id            TEXT NOT NULL UNIQUE,
+		retailer      TEXT NOT NULL,
+		purchase_date TEXT NOT NULL,
+		purchase_time TEXT NOT NULL,
+		total         TEXT NOT NULL
+	);
+	CREATE TABLE items (
+		receipt_id        TEXT NOT NULL REFERENCES receipts(id) ON DELETE CASCADE,
+		position          INTEGER NOT NULL,
+		short_description TEXT NOT NULL,
+		price             TEXT NOT NULL,
+		PRIMARY KEY (receipt_id, position)
+	);
+	CREATE TABLE points (
+		receipt_id TEXT PRIMARY KEY REFERENCES receipts(id) ON DELETE CASCADE,
+		points     INTEGER NOT NULL
+	);`,
+	// 2: per-rule points breakdown recorded at submission time
+	`CREATE TABLE point_breakdowns (
+		receipt_id TEXT NOT NULL REFERENCES receipts(id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		rule       TEXT NOT NULL,
+		matched    INTEGER NOT NULL,
+		input      TEXT NOT NULL,
+		points     INTEGER NOT NULL,
+		PRIMARY KEY (receipt_id, position)
+	);`,
+	// 3: exact integer cents alongside the submitted amount strings
+	`ALTER TABLE receipts ADD COLUMN total_cents INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE items ADD COLUMN price_cents INTEGER NOT NULL DEFAULT 0;
+	UPDATE receipts SET total_cents = CAST(ROUND(CAST(total AS REAL) * 100) AS INTEGER);
+	UPDATE items SET price_cents = CAST(ROUND(CAST(price AS REAL) * 100) AS INTEGER);`,
+	// 4: content fingerprints for duplicate detection, and idempotency keys
+	`ALTER TABLE receipts ADD COLUMN fingerprint TEXT;
+	CREATE INDEX receipts_fingerprint ON receipts (fingerprint);
+	CREATE TABLE idempotency_keys (
+		key                 TEXT PRIMARY KEY,
+		receipt_id          TEXT NOT NULL,
+		status              INTEGER NOT NULL,
+		request_fingerprint TEXT NOT NULL,
+		created_at          TEXT NOT NULL
+	);`,
+	// 5: optimistic concurrency versions and soft-delete tombstones
+	`ALTER TABLE receipts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE receipts ADD COLUMN deleted_at TEXT;`,
+	// 6: submitting client of each receipt, and hashed API keys
+	`ALTER TABLE receipts ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX receipts_client ON receipts (client_id);
+	CREATE TABLE api_keys (
+		id         TEXT PRIMARY KEY,
+		client_id  TEXT NOT NULL,
+		key_hash   TEXT NOT NULL UNIQUE,
+		scopes     TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		revoked_at TEXT
+	);`,
+	// 7: end user the points of each receipt are attributed to
+	`ALTER TABLE receipts ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX receipts_user ON receipts (user_id);`,
+	// 8: user points accounts and the ledger of changes to their balances
+	`CREATE TABLE accounts (
+		user_id    TEXT PRIMARY KEY,
+		balance    INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE TABLE ledger_entries (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    TEXT NOT NULL REFERENCES accounts(user_id),
+		type       TEXT NOT NULL,
+		points     INTEGER NOT NULL,
+		balance    INTEGER NOT NULL,
+		receipt_id TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX ledger_entries_user ON ledger_entries (user_id, id);`,
+	// 9: double-entry transactions, balancing existing credits against the issued account
+	`ALTER TABLE ledger_entries ADD COLUMN transaction_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE ledger_entries ADD COLUMN reference TEXT NOT NULL DEFAULT '';
+	ALTER TABLE ledger_entries ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+	UPDATE ledger_entries SET transaction_id = id;
+	INSERT INTO accounts (user_id, balance, created_at, updated_at)
+		SELECT '@issued', -SUM(points), MIN(created_at), MAX(created_at) FROM ledger_entries HAVING COUNT(*) > 0;
+	INSERT INTO ledger_entries (user_id, type, points, balance, receipt_id, created_at, transaction_id)
+		SELECT '@issued', type, -points, -SUM(points) OVER (ORDER BY id), receipt_id, created_at, id FROM ledger_entries ORDER BY id;
+	CREATE INDEX ledger_entries_receipt ON ledger_entries (receipt_id);`,
+	// 10: points a reversal could not take back
+	`ALTER TABLE ledger_entries ADD COLUMN shortfall INTEGER NOT NULL DEFAULT 0;`,
+	// 11: fingerprints now include the user; clear them to be backfilled
+	`UPDATE receipts SET fingerprint = NULL WHERE user_id != '';`,
+}
+
+// SQLiteStorage persists receipts in an embedded SQLite database.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage opens (or creates) the SQLite database at dsn and applies
+// any pending schema migrations.
+func NewSQLiteStorage(dsn string) (*SQLiteStorage, error) {
+	if dsn == "" {
+		return nil, errors.New("sqlite storage requires a database path")
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer; one connection also keeps ":memory:" databases shared.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON; PRAGMA busy_timeout = 5000;`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("configuring sqlite database: %w", err)
+	}
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.backfillFingerprints(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies every migration that has not been recorded yet.
+func (s *SQLiteStorage) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// AddSubmission adds a new receipt, credits its points to its user, if any, and
+// records its idempotency key, if any, in the same transaction.
+func (s *SQLiteStorage) AddSubmission(submission Submission) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	key := submission.Idempotency.Key
+	if key != "" {
+		record, err := scanIdempotencyRecord(tx.QueryRow(`SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE key = ?`, key))
+		if err == nil && idempotencyKeyUsed(record, submission) {
+			return &IdempotencyKeyUsedError{Record: record}
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	receipt := submission.Receipt
+	if err := addReceipt(tx, receipt, submission.Points, submission.Breakdown, submission.AllowDuplicates); err != nil {
+		return err
+	}
+	if receipt.UserID != "" {
+		if _, err := postTransaction(tx, LedgerEntry{UserID: receipt.UserID, Type: LedgerEarn, Points: submission.Points, ReceiptID: receipt.ID, CreatedAt: submission.At}); err != nil {
+			return err
+		}
+	}
+	if key != "" {
+		if err := saveIdempotencyRecord(tx, submission.Idempotency); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addReceipt inserts a new receipt with its items, points and breakdown, refusing
+// duplicates unless allowDuplicates is set.
+func addReceipt(tx *sql.Tx, receipt Receipt, points int64, breakdown []RuleResult, allowDuplicates bool) error {
+	if IsSystemAccount(receipt.UserID) {
+		return fmt.Errorf("user ID %s is reserved", receipt.UserID)
+	}
+	exists, err := receiptExists(tx, receipt.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("receipt with ID %s already exists", receipt.ID)
+	}
+	total, prices, err := parseReceiptAmounts(receipt)
+	if err != nil {
+		return err
+	}
+	fingerprint := Fingerprint(receipt)
+	if !allowDuplicates {
+		if err := checkDuplicate(tx, fingerprint, receipt.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO receipts (id, retailer, purchase_date, purchase_time, total, total_cents, fingerprint, client_id, user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		receipt.ID, receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total, total.Cents(), fingerprint, receipt.ClientID, receipt.UserID); err != nil {
+		return err
+	}
+	if err := insertItems(tx, receipt.ID, receipt.Items, prices); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO points (receipt_id, points) VALUES (?, ?)`, receipt.ID, points); err != nil {
+		return err
+	}
+	return insertBreakdown(tx, receipt.ID, breakdown)
+}
+
+// GetAllReceipts returns all receipts in insertion order.
+func (s *SQLiteStorage) GetAllReceipts() ([]Receipt, error) {
+	rows, err := s.db.Query(`SELECT id, retailer, purchase_date, purchase_time, total, client_id, user_id FROM receipts WHERE deleted_at IS NULL ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receiptList []Receipt
+	for rows.Next() {
+		var receipt Receipt
+		if err := rows.Scan(&receipt.ID, &receipt.Retailer, &receipt.PurchaseDate, &receipt.PurchaseTime, &receipt.Total, &receipt.ClientID, &receipt.UserID); err != nil {
+			return nil, err
+		}
+		receiptList = append(receiptList, receipt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(receiptList) == 0 {
+		return nil, fmt.Errorf("no receipts found")
+	}
+
+	for i := range receiptList {
+		items, err := loadItems(s.db, receiptList[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		receiptList[i].Items = items
+	}
+	return receiptList, nil
+}
+
+// ListReceipts returns one page of receipts matching the filter, in insertion order.
+// The cursor is the seq of the last receipt on the previous page.
+func (s *SQLiteStorage) ListReceipts(filter ReceiptFilter) (ReceiptPage, error) {
+	after, err := DecodeCursor(filter.Cursor)
+	if err != nil {
+		return ReceiptPage{}, err
+	}
+
+	conditions := []string{"r.seq > ?", "r.deleted_at IS NULL"}
+	args := []interface{}{after}
+	if filter.ClientID != "" {
+		conditions = append(conditions, "r.client_id = ?")
+		args = append(args, filter.ClientID)
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "r.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Retailer != "" {
+		conditions = append(conditions, "instr(lower(r.retailer), lower(?)) > 0")
+		args = append(args, filter.Retailer)
+	}
+	if filter.DateFrom != "" {
+		conditions = append(conditions, "r.purchase_date >= ?")
+		args = append(args, filter.DateFrom)
+	}
+	if filter.DateTo != "" {
+		conditions = append(conditions, "r.purchase_date <= ?")
+		args = append(args, filter.DateTo)
+	}
+	if filter.MinTotal != nil {
+		conditions = append(conditions, "r.total_cents >= ?")
+		args = append(args, filter.MinTotal.Cents())
+	}
+	if filter.MaxTotal != nil {
+		conditions = append(conditions, "r.total_cents <= ?")
+		args = append(args, filter.MaxTotal.Cents())
+	}
+	if filter.MinPoints != nil {
+		conditions = append(conditions, "p.points >= ?")
+		args = append(args, *filter.MinPoints)
+	}
+	if filter.MaxPoints != nil {
+		conditions = append(conditions, "p.points <= ?")
+		args = append(args, *filter.MaxPoints)
+	}
+
+	// Fetch one extra row to know whether another page follows
+	limit := filter.pageSize()
+	args = append(args, limit+1)
+	rows, err := s.db.Query(`SELECT r.seq, r.id, r.retailer, r.purchase_date, r.purchase_time, r.total, r.client_id, r.user_id, p.points
+		FROM receipts r JOIN points p ON p.receipt_id = r.id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY r.seq LIMIT ?`, args...)
+	if err != nil {
+		return ReceiptPage{}, err
+	}
+	defer rows.Close()
+
+	page := ReceiptPage{Receipts: []ReceiptRecord{}}
+	var seqs []int64
+	for rows.Next() {
+		var seq int64
+		var record ReceiptRecord
+		if err := rows.Scan(&seq, &record.ID, &record.Retailer, &record.PurchaseDate, &record.PurchaseTime, &record.Total, &record.ClientID, &record.UserID, &record.Points); err != nil {
+			return ReceiptPage{}, err
+		}
+		page.Receipts = append(page.Receipts, record)
+		seqs = append(seqs, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return ReceiptPage{}, err
+	}
+	rows.Close()
+
+	if len(page.Receipts) > limit {
+		page.Receipts = page.Receipts[:limit]
+		page.NextCursor = EncodeCursor(seqs[limit-1])
+	}
+	for i := range page.Receipts {
+		items, err := loadItems(s.db, page.Receipts[i].ID)
+		if err != nil {
+			return ReceiptPage{}, err
+		}
+		page.Receipts[i].Items = items
+	}
+	return page, nil
+}
+
+// GetReceiptByID retrieves a specific receipt by ID.
+func (s *SQLiteStorage) GetReceiptByID(id string) (Receipt, error) {
+	var receipt Receipt
+	var deletedAt sql.NullString
+	err := s.db.QueryRow(`SELECT id, retailer, purchase_date, purchase_time, total, client_id, user_id, deleted_at FROM receipts WHERE id = ?`, id).
+		Scan(&receipt.ID, &receipt.Retailer, &receipt.PurchaseDate, &receipt.PurchaseTime, &receipt.Total, &receipt.ClientID, &receipt.UserID, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Receipt{}, &ReceiptNotFoundError{ID: id}
+	}
+	if err != nil {
+		return Receipt{}, err
+	}
+	if deletedAt.Valid {
+		return Receipt{}, deletedError(id, deletedAt.String)
+	}
+
+	receipt.Items, err = loadItems(s.db, id)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return receipt, nil
+}
+
+// GetReceiptRecord retrieves a receipt, its points and its version in one
+// transaction, so they describe the same revision.
+func (s *SQLiteStorage) GetReceiptRecord(id string) (ReceiptRecord, int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return ReceiptRecord{}, 0, err
+	}
+	defer tx.Rollback()
+
+	var record ReceiptRecord
+	var version int64
+	var points sql.NullInt64
+	var deletedAt sql.NullString
+	err = tx.QueryRow(`SELECT r.id, r.retailer, r.purchase_date, r.purchase_time, r.total, r.client_id, r.user_id, r.version, r.deleted_at, p.points
+		FROM receipts r LEFT JOIN points p ON p.receipt_id = r.id WHERE r.id = ?`, id).
+		Scan(&record.ID, &record.Retailer, &record.PurchaseDate, &record.PurchaseTime, &record.Total, &record.ClientID, &record.UserID, &version, &deletedAt, &points)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReceiptRecord{}, 0, &ReceiptNotFoundError{ID: id}
+	}
+	if err != nil {
+		return ReceiptRecord{}, 0, err
+	}
+	if deletedAt.Valid {
+		return ReceiptRecord{}, 0, deletedError(id, deletedAt.String)
+	}
+	if !points.Valid {
+		return ReceiptRecord{}, 0, fmt.Errorf("points for receipt with ID %s not found", id)
+	}
+	record.Points = points.Int64
+
+	if record.Items, err = loadItems(tx, id); err != nil {
+		return ReceiptRecord{}, 0, err
+	}
+	return record, version, nil
+}
+
+// GetReceiptPoints retrieves points for a specific receipt by ID.
+func (s *SQLiteStorage) GetReceiptPoints(id string) (int64, error) {
+	var points int64
+	var deletedAt sql.NullString
+	err := s.db.QueryRow(`SELECT p.points, r.deleted_at FROM points p JOIN receipts r ON r.id = p.receipt_id WHERE p.receipt_id = ?`, id).
+		Scan(&points, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("points for receipt with ID %s not found", id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if deletedAt.Valid {
+		return 0, deletedError(id, deletedAt.String)
+	}
+	return points, nil
+}
+
+// GetReceiptBreakdown retrieves the per-rule points breakdown for a specific receipt by ID.
+func (s *SQLiteStorage) GetReceiptBreakdown(id string) ([]RuleResult, error) {
+	if _, err := s.GetReceiptPoints(id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT rule, matched, input, points FROM point_breakdowns WHERE receipt_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breakdown []RuleResult
+	for rows.Next() {
+		var result RuleResult
+		if err := rows.Scan(&result.Rule, &result.Matched, &result.Input, &result.Points); err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, result)
+	}
+	return breakdown, rows.Err()
+}
+
+// ReplaceReceipt replaces the content, points and breakdown of an existing receipt
+// and returns its new version. Unless expectedVersion is AnyVersion, the receipt
+// must still be at that version. If the receipt credited a user, their balance is
+// adjusted to the new points in the same transaction.
+func (s *SQLiteStorage) ReplaceReceipt(id string, receipt Receipt, points int64, breakdown []RuleResult, expectedVersion int64, updatedAt time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	current, err := liveVersion(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return 0, &VersionConflictError{ID: id, Current: current}
+	}
+	total, prices, err := parseReceiptAmounts(receipt)
+	if err != nil {
+		return 0, err
+	}
+	// A receipt stays with the client and user that submitted it
+	if err := tx.QueryRow(`SELECT client_id, user_id FROM receipts WHERE id = ?`, id).Scan(&receipt.ClientID, &receipt.UserID); err != nil {
+		return 0, err
+	}
+	fingerprint := Fingerprint(receipt)
+	if err := checkDuplicate(tx, fingerprint, id); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE receipts SET retailer = ?, purchase_date = ?, purchase_time = ?, total = ?, total_cents = ?, fingerprint = ?, version = ? WHERE id = ?`,
+		receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total, total.Cents(), fingerprint, current+1, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM items WHERE receipt_id = ?`, id); err != nil {
+		return 0, err
+	}
+	if err := insertItems(tx, id, receipt.Items, prices); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE points SET points = ? WHERE receipt_id = ?`, points, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM point_breakdowns WHERE receipt_id = ?`, id); err != nil {
+		return 0, err
+	}
+	if err := insertBreakdown(tx, id, breakdown); err != nil {
+		return 0, err
+	}
+	if err := adjustCredit(tx, id, points, updatedAt); err != nil {
+		return 0, err
+	}
+
+	return current + 1, tx.Commit()
+}
+
+// DeleteReceipt soft-deletes a receipt, leaving a tombstone. Unless expectedVersion
+// is AnyVersion, the receipt must still be at that version.
+func (s *SQLiteStorage) DeleteReceipt(id string, expectedVersion int64, deletedAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := liveVersion(tx, id)
+	if err != nil {
+		return err
+	}
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return &VersionConflictError{ID: id, Current: current}
+	}
+
+	if _, err := tx.Exec(`UPDATE receipts SET deleted_at = ?, version = ? WHERE id = ?`,
+		deletedAt.UTC().Format(time.RFC3339Nano), current+1, id); err != nil {
+		return err
+	}
+
+	// Take back the receipt's points; a receipt that credited nobody has none to take
+	var noCredit *CreditNotFoundError
+	if _, err := reverseCredit(tx, id, ReasonReceiptDeleted, deletedAt); err != nil && !errors.As(err, &noCredit) {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetReceiptVersion retrieves the current version of a specific receipt by ID.
+func (s *SQLiteStorage) GetReceiptVersion(id string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	return liveVersion(tx, id)
+}
+
+// idempotencyColumns are the columns scanIdempotencyRecord reads, in order
+const idempotencyColumns = `key, receipt_id, status, request_fingerprint, created_at`
+
+// GetIdempotencyRecord retrieves the outcome recorded for an idempotency key.
+func (s *SQLiteStorage) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	record, err := scanIdempotencyRecord(s.db.QueryRow(`SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE key = ?`, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return IdempotencyRecord{}, fmt.Errorf("idempotency key %s not found", key)
+	}
+	return record, err
+}
+
+// SaveIdempotencyRecord records the outcome of a request, replacing any earlier record for its key.
+func (s *SQLiteStorage) SaveIdempotencyRecord(record IdempotencyRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveIdempotencyRecord(tx, record); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveIdempotencyRecord records the outcome of a request, replacing any earlier record for its key.
+func saveIdempotencyRecord(tx *sql.Tx, record IdempotencyRecord) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO idempotency_keys (`+idempotencyColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		record.Key, record.ReceiptID, record.Status, record.RequestFingerprint, record.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// SaveAPIKey stores a new API key.
+func (s *SQLiteStorage) SaveAPIKey(key APIKey) error {
+	_, err := s.db.Exec(`INSERT INTO api_keys (id, client_id, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ID, key.ClientID, key.Hash, strings.Join(key.Scopes, " "), key.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret has the given hash.
+func (s *SQLiteStorage) GetAPIKeyByHash(hash string) (APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(`SELECT id, client_id, key_hash, scopes, created_at, revoked_at FROM api_keys WHERE key_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, &APIKeyNotFoundError{Key: hash}
+	}
+	return key, err
+}
+
+// ListAPIKeys returns every API key, revoked ones included, oldest first.
+func (s *SQLiteStorage) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT id, client_id, key_hash, scopes, created_at, revoked_at FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an API key so it no longer authenticates.
+func (s *SQLiteStorage) RevokeAPIKey(id string, revokedAt time.Time) error {
+	result, err := s.db.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`,
+		revokedAt.UTC().Format(time.RFC3339Nano), id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return &APIKeyNotFoundError{Key: id}
+	}
+	return nil
+}
+
+// GetAccount retrieves the points account of a user.
+func (s *SQLiteStorage) GetAccount(userID string) (Account, error) {
+	account, err := scanAccount(s.db.QueryRow(`SELECT user_id, balance, created_at, updated_at FROM accounts WHERE user_id = ?`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Account{}, &AccountNotFoundError{UserID: userID}
+	}
+	return account, err
+}
+
+// ListLedgerEntries returns every ledger entry of a user's account, oldest first.
+func (s *SQLiteStorage) ListLedgerEntries(userID string) ([]LedgerEntry, error) {
+	if _, err := s.GetAccount(userID); err != nil {
+		return nil, err
+	}
+	return ledgerEntries(s.db, userID)
+}
+
+// ledgerEntries returns every ledger entry of an account, oldest first
+func ledgerEntries(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, userID string) ([]LedgerEntry, error) {
+	rows, err := q.Query(`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RedeemPoints spends points from a user's account. A redemption repeating the key
+// of an earlier one for the same points returns the original entry and true, without
+// spending again. The balance never goes negative: a redemption exceeding it fails
+// with an InsufficientPointsError.
+func (s *SQLiteStorage) RedeemPoints(redemption Redemption, at time.Time) (LedgerEntry, bool, error) {
+	if err := checkRedemption(redemption); err != nil {
+		return LedgerEntry{}, false, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return LedgerEntry{}, false, err
+	}
+	defer tx.Rollback()
+
+	account, err := scanAccount(tx.QueryRow(`SELECT user_id, balance, created_at, updated_at FROM accounts WHERE user_id = ?`, redemption.UserID))
+	if errors.Is(err, sql.ErrNoRows) || IsSystemAccount(redemption.UserID) {
+		return LedgerEntry{}, false, &AccountNotFoundError{UserID: redemption.UserID}
+	} else if err != nil {
+		return LedgerEntry{}, false, err
+	}
+
+	existing, err := scanLedgerEntry(tx.QueryRow(`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE user_id = ? AND type = ? AND reference = ?`,
+		redemption.UserID, LedgerRedeem, redemption.Key))
+	switch {
+	case err == nil && -existing.Points != redemption.Points:
+		return LedgerEntry{}, false, &RedemptionConflictError{Key: redemption.Key, Existing: existing}
+	case err == nil:
+		return existing, true, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return LedgerEntry{}, false, err
+	}
+	if account.Balance < redemption.Points {
+		return LedgerEntry{}, false, &InsufficientPointsError{UserID: redemption.UserID, Balance: account.Balance, Requested: redemption.Points}
+	}
+
+	entry, err := postTransaction(tx, LedgerEntry{
+		UserID:    redemption.UserID,
+		Type:      LedgerRedeem,
+		Points:    -redemption.Points,
+		Reference: redemption.Key,
+		Reason:    redemption.Reason,
+		CreatedAt: at,
+	})
+	if err != nil {
+		return LedgerEntry{}, false, err
+	}
+	return entry, false, tx.Commit()
+}
+
+// ReverseReceiptCredit takes back the points a receipt credited to its user, for
+// example when it turns out to be fraudulent. Points already spent cannot be taken
+// back: at most the current balance is, and the rest is recorded as the reversal's
+// shortfall. Reversing a receipt again takes back what it can of the shortfall, or
+// returns the last reversal when there is nothing left to take.
+func (s *SQLiteStorage) ReverseReceiptCredit(receiptID, reason string, at time.Time) (LedgerEntry, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	defer tx.Rollback()
+
+	exists, err := receiptExists(tx, receiptID)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	if !exists {
+		return LedgerEntry{}, &ReceiptNotFoundError{ID: receiptID}
+	}
+	entry, err := reverseCredit(tx, receiptID, reason, at)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	return entry, tx.Commit()
+}
+
+// ExpirePoints expires, in every user account, the points earned at or before
+// cutoff that are still held. It returns the expiration entries it recorded.
+func (s *SQLiteStorage) ExpirePoints(cutoff, at time.Time) ([]LedgerEntry, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only users who still hold points can have any to expire
+	rows, err := tx.Query(`SELECT user_id FROM accounts WHERE balance > 0 AND user_id NOT LIKE '@%' ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	expired := []LedgerEntry{}
+	for _, userID := range userIDs {
+		entries, err := ledgerEntries(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if points := expiredPoints(entries, cutoff); points > 0 {
+			entry, err := postTransaction(tx, LedgerEntry{UserID: userID, Type: LedgerExpire, Points: -points, Reason: expirationReason(cutoff), CreatedAt: at})
+			if err != nil {
+				return nil, err
+			}
+			expired = append(expired, entry)
+		}
+	}
+	return expired, tx.Commit()
+}
+
+// Ping reports whether the database can still be queried.
+func (s *SQLiteStorage) Ping() error {
+	var one int
+	return s.db.QueryRow(`SELECT 1`).Scan(&one)
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// loadItems reads the items of a receipt in their original order.
+func loadItems(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, receiptID string) ([]Item, error) {
+	rows, err := q.Query(`SELECT short_description, price FROM items WHERE receipt_id = ? ORDER BY position`, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ShortDescription, &item.Price); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// backfillFingerprints computes fingerprints for receipts stored before duplicate detection existed.
+func (s *SQLiteStorage) backfillFingerprints() error {
+	rows, err := s.db.Query(`SELECT id FROM receipts WHERE fingerprint IS NULL`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		receipt, err := s.GetReceiptByID(id)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(`UPDATE receipts SET fingerprint = ? WHERE id = ?`, Fingerprint(receipt), id); err != nil {
+			return fmt.Errorf("backfilling fingerprint for receipt %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// scanAPIKey reads an api_keys row selected as id, client_id, key_hash, scopes, created_at, revoked_at.
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (APIKey, error) {
+	var key APIKey
+	var scopes, createdAt string
+	var revokedAt sql.NullString
+	if err := row.Scan(&key.ID, &key.ClientID, &key.Hash, &scopes, &createdAt, &revokedAt); err != nil {
+		return APIKey{}, err
+	}
+
+	var err error
+	key.Scopes = strings.Fields(scopes)
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return APIKey{}, fmt.Errorf("parsing api key timestamp: %w", err)
+	}
+	if revokedAt.Valid {
+		if key.RevokedAt, err = time.Parse(time.RFC3339Nano, revokedAt.String); err != nil {
+			return APIKey{}, fmt.Errorf("parsing api key timestamp: %w", err)
+		}
+	}
+	return key, nil
+}
+
+// ledgerEntryColumns are the ledger_entries columns read by scanLedgerEntry
+const ledgerEntryColumns = `id, transaction_id, user_id, type, points, balance, receipt_id, reference, reason, shortfall, created_at`
+
+// postTransaction records a transaction of two entries: entry on the user account,
+// and its opposite on the system account of its type. It returns the user entry.
+func postTransaction(tx *sql.Tx, entry LedgerEntry) (LedgerEntry, error) {
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(transaction_id), 0) + 1 FROM ledger_entries`).Scan(&entry.TransactionID); err != nil {
+		return LedgerEntry{}, err
+	}
+	contra := entry
+	contra.UserID = contraAccount(entry.Type)
+	contra.Points = -entry.Points
+
+	entry, err := insertLedgerEntry(tx, entry)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	if _, err := insertLedgerEntry(tx, contra); err != nil {
+		return LedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// reverseCredit posts the reversal of a receipt's credit, as planned by planReversal
+func reverseCredit(tx *sql.Tx, receiptID, reason string, at time.Time) (LedgerEntry, error) {
+	entries, err := receiptEntries(tx, receiptID)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	var balance int64
+	if len(entries) > 0 {
+		if err := tx.QueryRow(`SELECT balance FROM accounts WHERE user_id = ?`, entries[0].UserID).Scan(&balance); err != nil {
+			return LedgerEntry{}, err
+		}
+	}
+	reversal, post, err := planReversal(receiptID, entries, balance, reason, at)
+	if err != nil || !post {
+		return reversal, err
+	}
+	return postTransaction(tx, reversal)
+}
+
+// adjustCredit posts the adjustment of a receipt's credit to its new points, as
+// planned by planAdjustment
+func adjustCredit(tx *sql.Tx, receiptID string, points int64, at time.Time) error {
+	entries, err := receiptEntries(tx, receiptID)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	var balance int64
+	if err := tx.QueryRow(`SELECT balance FROM accounts WHERE user_id = ?`, entries[0].UserID).Scan(&balance); err != nil {
+		return err
+	}
+	if adjustment, post := planAdjustment(receiptID, entries, balance, points, at); post {
+		_, err = postTransaction(tx, adjustment)
+	}
+	return err
+}
+
+// receiptEntries returns the user entries of a receipt, oldest first
+func receiptEntries(tx *sql.Tx, receiptID string) ([]LedgerEntry, error) {
+	rows, err := tx.Query(`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE receipt_id = ? AND user_id NOT LIKE '@%' ORDER BY id`, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LedgerEntry
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// insertLedgerEntry records an entry, opening the account if needed, and applies
+// it to the balance. It returns the entry with its ID and resulting balance.
+func insertLedgerEntry(tx *sql.Tx, entry LedgerEntry) (LedgerEntry, error) {
+	at := entry.CreatedAt.UTC().Format(time.RFC3339Nano)
+	if _, err := tx.Exec(`INSERT INTO accounts (user_id, balance, created_at, updated_at) VALUES (?, 0, ?, ?) ON CONFLICT (user_id) DO NOTHING`,
+		entry.UserID, at, at); err != nil {
+		return LedgerEntry{}, err
+	}
+	if err := tx.QueryRow(`UPDATE accounts SET balance = balance + ?, updated_at = ? WHERE user_id = ? RETURNING balance`,
+		entry.Points, at, entry.UserID).Scan(&entry.Balance); err != nil {
+		return LedgerEntry{}, err
+	}
+	result, err := tx.Exec(`INSERT INTO ledger_entries (transaction_id, user_id, type, points, balance, receipt_id, reference, reason, shortfall, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.TransactionID, entry.UserID, entry.Type, entry.Points, entry.Balance, entry.ReceiptID, entry.Reference, entry.Reason, entry.Shortfall, at)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return LedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// scanLedgerEntry reads a ledger_entries row selected as ledgerEntryColumns.
+func scanLedgerEntry(row interface{ Scan(...interface{}) error }) (LedgerEntry, error) {
+	var entry LedgerEntry
+	var createdAt string
+	if err := row.Scan(&entry.ID, &entry.TransactionID, &entry.UserID, &entry.Type, &entry.Points, &entry.Balance,
+		&entry.ReceiptID, &entry.Reference, &entry.Reason, &entry.Shortfall, &createdAt); err != nil {
+		return LedgerEntry{}, err
+	}
+
+	var err error
+	if entry.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return LedgerEntry{}, fmt.Errorf("parsing ledger timestamp: %w", err)
+	}
+	return entry, nil
+}
+
+// scanIdempotencyRecord reads an idempotency_keys row selected as idempotencyColumns.
+func scanIdempotencyRecord(row interface{ Scan(...interface{}) error }) (IdempotencyRecord, error) {
+	var record IdempotencyRecord
+	var createdAt string
+	if err := row.Scan(&record.Key, &record.ReceiptID, &record.Status, &record.RequestFingerprint, &createdAt); err != nil {
+		return IdempotencyRecord{}, err
+	}
+	var err error
+	if record.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return IdempotencyRecord{}, fmt.Errorf("parsing idempotency key timestamp: %w", err)
+	}
+	return record, nil
+}
+
+// scanAccount reads an accounts row selected as user_id, balance, created_at, updated_at.
+func scanAccount(row interface{ Scan(...interface{}) error }) (Account, error) {
+	var account Account
+	var createdAt, updatedAt string
+	if err := row.Scan(&account.UserID, &account.Balance, &createdAt, &updatedAt); err != nil {
+		return Account{}, err
+	}
+
+	var err error
+	if account.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Account{}, fmt.Errorf("parsing account timestamp: %w", err)
+	}
+	if account.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return Account{}, fmt.Errorf("parsing account timestamp: %w", err)
+	}
+	return account, nil
+}
+
+// checkDuplicate returns a DuplicateReceiptError if another receipt has the same fingerprint.
+func checkDuplicate(tx *sql.Tx, fingerprint, id string) error {
+	var existingID string
+	err := tx.QueryRow(`SELECT id FROM receipts WHERE fingerprint = ? AND id != ? AND deleted_at IS NULL ORDER BY seq LIMIT 1`, fingerprint, id).Scan(&existingID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &DuplicateReceiptError{ExistingID: existingID}
+}
+
+// liveVersion returns the version of a receipt, or an error if it is missing or deleted.
+func liveVersion(tx *sql.Tx, id string) (int64, error) {
+	var version int64
+	var deletedAt sql.NullString
+	err := tx.QueryRow(`SELECT version, deleted_at FROM receipts WHERE id = ?`, id).Scan(&version, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &ReceiptNotFoundError{ID: id}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if deletedAt.Valid {
+		return 0, deletedError(id, deletedAt.String)
+	}
+	return version, nil
+}
+
+// deletedError builds the error for a tombstoned receipt from its stored deletion time.
+func deletedError(id, deletedAt string) error {
+	at, _ := time.Parse(time.RFC3339Nano, deletedAt)
+	return &ReceiptDeletedError{ID: id, DeletedAt: at}
+}
+
+// receiptExists reports whether a receipt with the given ID is stored.
+func receiptExists(tx *sql.Tx, id string) (bool, error) {
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM receipts WHERE id = ?`, id).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// insertItems writes the items of a receipt and their parsed prices, preserving their order.
+func insertItems(tx *sql.Tx, receiptID string, items []Item, prices []Money) error {
+	for i, item := range items {
+		if _, err := tx.Exec(`INSERT INTO items (receipt_id, position, short_description, price, price_cents) VALUES (?, ?, ?, ?, ?)`,
+			receiptID, i, item.ShortDescription, item.Price, prices[i].Cents()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertBreakdown writes the per-rule points breakdown of a receipt, preserving rule order.
+func insertBreakdown(tx *sql.Tx, receiptID string, breakdown []RuleResult) error {
+	for i, result := range breakdown {
+		if _, err := tx.Exec(`INSERT INTO point_breakdowns (receipt_id, position, rule, matched, input, points) VALUES (?, ?, ?, ?, ?, ?)`,
+			receiptID, i, result.Rule, result.Matched, result.Input, result.Points); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package common
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Helper function to open a fresh SQLite storage in a temporary directory
+func newTestSQLiteStorage(t *testing.T) (*SQLiteStorage, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	s, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("could not open sqlite storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestSQLiteAddAndGetReceipt(t *testing.T) {
+	s, _ := newTestSQLiteStorage(t)
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{
+		{"Item A", "50.00"},
+		{"Item B", "50.00"},
+	})
+
+	if err := s.AddSubmission(Submission{Receipt: receipt, Points: 100}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	// Attempt to add the same receipt again
+	err := s.AddSubmission(Submission{Receipt: receipt, Points: 100})
+	if err == nil || err.Error() != "receipt with ID 1 already exists" {
+		t.Errorf("expected error 'receipt with ID 1 already exists', but got: %v", err)
+	}
+
+	retrievedReceipt, err := s.GetReceiptByID("1")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if retrievedReceipt.Retailer != "Retailer A" || len(retrievedReceipt.Items) != 2 {
+		t.Errorf("unexpected receipt: %+v", retrievedReceipt)
+	}
+	if retrievedReceipt.Items[1].ShortDescription != "Item B" {
+		t.Errorf("expected items in insertion order, got: %+v", retrievedReceipt.Items)
+	}
+
+	points, err := s.GetReceiptPoints("1")
+	if err != nil || points != 100 {
+		t.Errorf("expected points 100, but got: %d (%v)", points, err)
+	}
+}
+
+func TestSQLiteNotFound(t *testing.T) {
+	s, _ := newTestSQLiteStorage(t)
+
+	_, err := s.GetAllReceipts()
+	if err == nil || err.Error() != "no receipts found" {
+		t.Errorf("expected error 'no receipts found', but got: %v", err)
+	}
+
+	_, err = s.GetReceiptByID("1")
+	if err == nil || err.Error() != "receipt with ID 1 not found" {
+		t.Errorf("expected error 'receipt with ID 1 not found', but got: %v", err)
+	}
+
+	_, err = s.GetReceiptPoints("1")
+	if err == nil || err.Error() != "points for receipt with ID 1 not found" {
+		t.Errorf("expected error 'points for receipt with ID 1 not found', but got: %v", err)
+	}
+
+	_, err = s.ReplaceReceipt("1", Receipt{ID: "1"}, 0, nil, AnyVersion, time.Now())
+	if err == nil || err.Error() != "receipt with ID 1 not found" {
+		t.Errorf("expected error 'receipt with ID 1 not found', but got: %v", err)
+	}
+}
+
+func TestSQLiteReplaceReceipt(t *testing.T) {
+	s, _ := newTestSQLiteStorage(t)
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{
+		{"Item A", "50.00"},
+		{"Item B", "50.00"},
+	})
+	s.AddSubmission(Submission{Receipt: receipt, Points: 100})
+
+	updatedReceipt := createSampleReceipt("1", "Retailer B", "2023-11-26", "13:00", "200.00", []Item{
+		{"Item C", "200.00"},
+	})
+	if _, err := s.ReplaceReceipt("1", updatedReceipt, 200, nil, AnyVersion, time.Now()); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	retrievedReceipt, _ := s.GetReceiptByID("1")
+	if retrievedReceipt.Retailer != "Retailer B" || len(retrievedReceipt.Items) != 1 {
+		t.Errorf("unexpected receipt after update: %+v", retrievedReceipt)
+	}
+	points, _ := s.GetReceiptPoints("1")
+	if points != 200 {
+		t.Errorf("expected points 200, but got: %d", points)
+	}
+}
+
+func TestSQLitePersistsAcrossReopen(t *testing.T) {
+	s, path := newTestSQLiteStorage(t)
+
+	s.AddSubmission(Submission{Receipt: createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}}), Points: 10})
+	s.AddSubmission(Submission{Receipt: createSampleReceipt("2", "Retailer B", "2023-11-25", "12:00", "2.00", []Item{{"Item B", "2.00"}}), Points: 20})
+	s.Close()
+
+	// Reopening runs the migrations again, which must be a no-op
+	reopened, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("could not reopen sqlite storage: %v", err)
+	}
+	defer reopened.Close()
+
+	receipts, err := reopened.GetAllReceipts()
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(receipts) != 2 || receipts[0].ID != "1" || receipts[1].ID != "2" {
+		t.Errorf("expected receipts 1 and 2 in insertion order, got: %+v", receipts)
+	}
+}
+
+func TestSQLiteReceiptBreakdown(t *testing.T) {
+	s, _ := newTestSQLiteStorage(t)
+
+	breakdown := []RuleResult{
+		{Rule: "retailer_alphanumeric", Matched: true, Input: "Retailer A", Points: 9},
+		{Rule: "odd_day", Matched: false, Input: "2023-11-26", Points: 0},
+	}
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-26", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+	if err := s.AddSubmission(Submission{Receipt: receipt, Points: 9, Breakdown: breakdown}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	stored, err := s.GetReceiptBreakdown("1")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(stored) != 2 || stored[0] != breakdown[0] || stored[1] != breakdown[1] {
+		t.Errorf("expected breakdown %+v, got %+v", breakdown, stored)
+	}
+
+	if _, err := s.GetReceiptBreakdown("2"); err == nil {
+		t.Errorf("expected error for unknown receipt")
+	}
+}
+
+func TestSQLiteStoresExactCents(t *testing.T) {
+	s, _ := newTestSQLiteStorage(t)
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "14.10", []Item{{"Item A", "14.10"}})
+	if err := s.AddSubmission(Submission{Receipt: receipt, Points: 0}); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	var totalCents, priceCents int64
+	s.db.QueryRow(`SELECT total_cents FROM receipts WHERE id = ?`, "1").Scan(&totalCents)
+	s.db.QueryRow(`SELECT price_cents FROM items WHERE receipt_id = ?`, "1").Scan(&priceCents)
+	if totalCents != 1410 || priceCents != 1410 {
+		t.Errorf("expected 1410 cents, got total %d and price %d", totalCents, priceCents)
+	}
+
+	// Malformed amounts are rejected instead of being stored
+	bad := createSampleReceipt("2", "Retailer A", "2023-11-25", "12:00", "abc", nil)
+	if err := s.AddSubmission(Submission{Receipt: bad, Points: 0}); err == nil {
+		t.Errorf("expected error for malformed total")
+	}
+}
+
+func TestSQLiteDuplicatesAndIdempotency(t *testing.T) {
+	s, path := newTestSQLiteStorage(t)
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{{"Item A", "100.00"}})
+	s.AddSubmission(Submission{Receipt: receipt, Points: 100})
+
+	duplicate := createSampleReceipt("2", "retailer a", "2023-11-25", "12:00", "100.00", []Item{{"ITEM A", "100.00"}})
+	var dupErr *DuplicateReceiptError
+	if err := s.AddSubmission(Submission{Receipt: duplicate, Points: 100}); !errors.As(err, &dupErr) || dupErr.ExistingID != "1" {
+		t.Errorf("expected duplicate of receipt 1, but got: %v", err)
+	}
+
+	createdAt := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	record := IdempotencyRecord{Key: "key-1", ReceiptID: "1", Status: 201, RequestFingerprint: Fingerprint(receipt), CreatedAt: createdAt}
+	if err := s.SaveIdempotencyRecord(record); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	s.Close()
+
+	reopened, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("could not reopen sqlite storage: %v", err)
+	}
+	defer reopened.Close()
+
+	stored, err := reopened.GetIdempotencyRecord("key-1")
+	if err != nil || stored != record {
+		t.Errorf("expected stored record %+v, but got: %+v (%v)", record, stored, err)
+	}
+	if _, err := reopened.GetIdempotencyRecord("key-2"); err == nil {
+		t.Errorf("expected error for unknown idempotency key")
+	}
+}
@@ -2,36 +2,229 @@ package common
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
+// Supported storage backends.
+const (
+	BackendMemory = "memory" // In-memory maps, lost on restart
+	BackendSQLite = "sqlite" // Embedded SQLite database file
+)
+
+// ReceiptStore defines the operations the API needs from a receipt storage backend.
+type ReceiptStore interface {
+	AddSubmission(submission Submission) error
+	GetAllReceipts() ([]Receipt, error)
+	ListReceipts(filter ReceiptFilter) (ReceiptPage, error)
+	GetReceiptByID(id string) (Receipt, error)
+	GetReceiptRecord(id string) (ReceiptRecord, int64, error)
+	GetReceiptPoints(id string) (int64, error)
+	GetReceiptBreakdown(id string) ([]RuleResult, error)
+	ReplaceReceipt(id string, receipt Receipt, points int64, breakdown []RuleResult, expectedVersion int64, updatedAt time.Time) (int64, error)
+	DeleteReceipt(id string, expectedVersion int64, deletedAt time.Time) error
+	GetReceiptVersion(id string) (int64, error)
+	GetIdempotencyRecord(key string) (IdempotencyRecord, error)
+	SaveIdempotencyRecord(record IdempotencyRecord) error
+	SaveAPIKey(key APIKey) error
+	GetAPIKeyByHash(hash string) (APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id string, revokedAt time.Time) error
+	GetAccount(userID string) (Account, error)
+	ListLedgerEntries(userID string) ([]LedgerEntry, error)
+	RedeemPoints(redemption Redemption, at time.Time) (LedgerEntry, bool, error)
+	ReverseReceiptCredit(receiptID, reason string, at time.Time) (LedgerEntry, error)
+	ExpirePoints(cutoff, at time.Time) ([]LedgerEntry, error)
+	Ping() error
+	Close() error
+}
+
 // ReceiptStorage holds receipts in memory with fast lookup and insertion order tracking.
 type ReceiptStorage struct {
-	Receipts map[string]Receipt // Map for fast lookups
-	Points   map[string]int64   // Map for storing points associated with receipts
-	Order    []string           // Slice to store receipt IDs in order of insertion
-	mu       sync.Mutex         // Mutex to handle concurrent access
+	Receipts   map[string]Receipt      // Map for fast lookups
+	Points     map[string]int64        // Map for storing points associated with receipts
+	Breakdowns map[string][]RuleResult // Map for storing the per-rule points breakdown
+	Order      []string                // Slice to store receipt IDs in order of insertion
+	mu         sync.Mutex              // Mutex to handle concurrent access
+
+	fingerprints map[string][]string          // Content fingerprint to the IDs of live receipts with it, in insertion order
+	positions    map[string]int               // Receipt ID to its index in Order
+	idempotency  map[string]IdempotencyRecord // Idempotency key to the outcome of its original request
+	versions     map[string]int64             // Receipt ID to its version, incremented on every change
+	deleted      map[string]time.Time         // Tombstones: receipt ID to when it was soft-deleted
+	apiKeys      map[string]APIKey            // API key ID to the key, holding only the secret's hash
+	accounts     map[string]Account           // User ID to the user's points account
+	ledger       []LedgerEntry                // Every ledger entry, oldest first
+}
+
+// NewReceiptStorage creates an empty in-memory receipt storage.
+func NewReceiptStorage() *ReceiptStorage {
+	return &ReceiptStorage{
+		Receipts:   make(map[string]Receipt),
+		Points:     make(map[string]int64),
+		Breakdowns: make(map[string][]RuleResult),
+		Order:      []string{},
+
+		fingerprints: make(map[string][]string),
+		positions:    make(map[string]int),
+		idempotency:  make(map[string]IdempotencyRecord),
+		versions:     make(map[string]int64),
+		deleted:      make(map[string]time.Time),
+		apiKeys:      make(map[string]APIKey),
+		accounts:     make(map[string]Account),
+	}
+}
+
+// ensureMaps initializes maps that are nil when the storage is built as a literal.
+// Callers must hold rs.mu.
+func (rs *ReceiptStorage) ensureMaps() {
+	if rs.Breakdowns == nil {
+		rs.Breakdowns = make(map[string][]RuleResult)
+	}
+	if rs.fingerprints == nil {
+		rs.fingerprints = make(map[string][]string)
+	}
+	if rs.positions == nil {
+		rs.positions = make(map[string]int)
+	}
+	if rs.idempotency == nil {
+		rs.idempotency = make(map[string]IdempotencyRecord)
+	}
+	if rs.versions == nil {
+		rs.versions = make(map[string]int64)
+	}
+	if rs.deleted == nil {
+		rs.deleted = make(map[string]time.Time)
+	}
+	if rs.apiKeys == nil {
+		rs.apiKeys = make(map[string]APIKey)
+	}
+	if rs.accounts == nil {
+		rs.accounts = make(map[string]Account)
+	}
 }
 
-// Global instance of the in-memory receipt storage.
-var Storage = ReceiptStorage{
-	Receipts: make(map[string]Receipt),
-	Points:   make(map[string]int64),
-	Order:    []string{},
+// lookup returns an error unless the receipt is stored and not deleted.
+// Callers must hold rs.mu.
+func (rs *ReceiptStorage) lookup(id string) error {
+	if _, exists := rs.Receipts[id]; !exists {
+		return &ReceiptNotFoundError{ID: id}
+	}
+	if deletedAt, deleted := rs.deleted[id]; deleted {
+		return &ReceiptDeletedError{ID: id, DeletedAt: deletedAt}
+	}
+	return nil
+}
+
+// version returns the current version of a stored receipt. Receipts stored
+// without a recorded version are at version 1. Callers must hold rs.mu.
+func (rs *ReceiptStorage) version(id string) int64 {
+	if version, exists := rs.versions[id]; exists {
+		return version
+	}
+	return 1
 }
 
-// AddReceipt adds a new receipt to the storage.
-func (rs *ReceiptStorage) AddReceipt(receipt Receipt, points int64) error {
+// duplicateOf returns the first live receipt, in insertion order, other than id
+// with the given fingerprint. It reports the same receipt as the SQLite store,
+// whichever of several allowed duplicates was changed or deleted since.
+// Callers must hold rs.mu.
+func (rs *ReceiptStorage) duplicateOf(fingerprint, id string) (string, bool) {
+	for _, existingID := range rs.fingerprints[fingerprint] {
+		if existingID != id {
+			return existingID, true
+		}
+	}
+	return "", false
+}
+
+// indexFingerprint records that the receipt id has the given fingerprint, keeping
+// the receipts of each fingerprint in insertion order. Callers must hold rs.mu.
+func (rs *ReceiptStorage) indexFingerprint(fingerprint, id string) {
+	ids := append(rs.fingerprints[fingerprint], id)
+	sort.SliceStable(ids, func(i, j int) bool { return rs.positions[ids[i]] < rs.positions[ids[j]] })
+	rs.fingerprints[fingerprint] = ids
+}
+
+// unindexFingerprint removes the receipt id from the receipts with the given
+// fingerprint. Callers must hold rs.mu.
+func (rs *ReceiptStorage) unindexFingerprint(fingerprint, id string) {
+	ids := rs.fingerprints[fingerprint]
+	for i, existingID := range ids {
+		if existingID == id {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(rs.fingerprints, fingerprint)
+		return
+	}
+	rs.fingerprints[fingerprint] = ids
+}
+
+// OpenStore creates the receipt store for the given backend.
+// The dsn is ignored by the memory backend and is the database file path for SQLite.
+func OpenStore(backend, dsn string) (ReceiptStore, error) {
+	switch backend {
+	case "", BackendMemory:
+		return NewReceiptStorage(), nil
+	case BackendSQLite:
+		return NewSQLiteStorage(dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// AddSubmission adds a new receipt, credits its points to its user, if any, and
+// records its idempotency key, if any, in the same step.
+func (rs *ReceiptStorage) AddSubmission(submission Submission) error {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
+	rs.ensureMaps()
 
+	key := submission.Idempotency.Key
+	if record, exists := rs.idempotency[key]; key != "" && exists && idempotencyKeyUsed(record, submission) {
+		return &IdempotencyKeyUsedError{Record: record}
+	}
+	receipt := submission.Receipt
+	if err := rs.addReceipt(receipt, submission.Points, submission.Breakdown, submission.AllowDuplicates); err != nil {
+		return err
+	}
+	if receipt.UserID != "" {
+		rs.post(LedgerEntry{UserID: receipt.UserID, Type: LedgerEarn, Points: submission.Points, ReceiptID: receipt.ID, CreatedAt: submission.At})
+	}
+	if key != "" {
+		rs.idempotency[key] = submission.Idempotency
+	}
+	return nil
+}
+
+// addReceipt stores a new receipt, refusing duplicates unless allowDuplicates is
+// set. Callers must hold rs.mu.
+func (rs *ReceiptStorage) addReceipt(receipt Receipt, points int64, breakdown []RuleResult, allowDuplicates bool) error {
+	if IsSystemAccount(receipt.UserID) {
+		return fmt.Errorf("user ID %s is reserved", receipt.UserID)
+	}
 	if _, exists := rs.Receipts[receipt.ID]; exists {
 		return fmt.Errorf("receipt with ID %s already exists", receipt.ID)
 	}
+	if _, _, err := parseReceiptAmounts(receipt); err != nil {
+		return err
+	}
+	fingerprint := Fingerprint(receipt)
+	if existingID, exists := rs.duplicateOf(fingerprint, receipt.ID); exists && !allowDuplicates {
+		return &DuplicateReceiptError{ExistingID: existingID}
+	}
 
 	rs.Receipts[receipt.ID] = receipt
 	rs.Points[receipt.ID] = points
+	rs.positions[receipt.ID] = len(rs.Order)
 	rs.Order = append(rs.Order, receipt.ID)
+	rs.Breakdowns[receipt.ID] = breakdown
+	rs.indexFingerprint(fingerprint, receipt.ID)
+	rs.versions[receipt.ID] = 1
 
 	return nil
 }
@@ -41,27 +234,80 @@ func (rs *ReceiptStorage) GetAllReceipts() ([]Receipt, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 
-	if len(rs.Receipts) == 0 {
-		return nil, fmt.Errorf("no receipts found")
-	}
-
 	receiptList := make([]Receipt, 0, len(rs.Receipts))
 	for _, receiptID := range rs.Order {
+		if _, deleted := rs.deleted[receiptID]; deleted {
+			continue
+		}
 		receiptList = append(receiptList, rs.Receipts[receiptID])
 	}
+	if len(receiptList) == 0 {
+		return nil, fmt.Errorf("no receipts found")
+	}
 	return receiptList, nil
 }
 
+// ListReceipts returns one page of receipts matching the filter, in insertion order.
+// As in the SQLite store, the cursor is the sequence number of the last receipt on
+// the previous page; the receipt at index i in Order has sequence number i+1.
+func (rs *ReceiptStorage) ListReceipts(filter ReceiptFilter) (ReceiptPage, error) {
+	after, err := DecodeCursor(filter.Cursor)
+	if err != nil {
+		return ReceiptPage{}, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	limit := filter.pageSize()
+	page := ReceiptPage{Receipts: []ReceiptRecord{}}
+	var last int64 // Index in Order of the last receipt on the page
+	for i := int(after); i < len(rs.Order); i++ {
+		id := rs.Order[i]
+		receipt, exists := rs.Receipts[id]
+		if _, deleted := rs.deleted[id]; !exists || deleted {
+			continue
+		}
+		total, _ := ParseMoney(receipt.Total)
+		record := ReceiptRecord{Receipt: receipt, Points: rs.Points[id]}
+		if !filter.matches(record, total) {
+			continue
+		}
+		if len(page.Receipts) == limit {
+			page.NextCursor = EncodeCursor(last + 1)
+			break
+		}
+		page.Receipts = append(page.Receipts, record)
+		last = int64(i)
+	}
+	return page, nil
+}
+
 // GetReceiptByID retrieves a specific receipt by ID.
 func (rs *ReceiptStorage) GetReceiptByID(id string) (Receipt, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 
-	receipt, exists := rs.Receipts[id]
+	if err := rs.lookup(id); err != nil {
+		return Receipt{}, err
+	}
+	return rs.Receipts[id], nil
+}
+
+// GetReceiptRecord retrieves a receipt, its points and its version in one read,
+// so they describe the same revision.
+func (rs *ReceiptStorage) GetReceiptRecord(id string) (ReceiptRecord, int64, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.lookup(id); err != nil {
+		return ReceiptRecord{}, 0, err
+	}
+	points, exists := rs.Points[id]
 	if !exists {
-		return Receipt{}, fmt.Errorf("receipt with ID %s not found", id)
+		return ReceiptRecord{}, 0, fmt.Errorf("points for receipt with ID %s not found", id)
 	}
-	return receipt, nil
+	return ReceiptRecord{Receipt: rs.Receipts[id], Points: points}, rs.version(id), nil
 }
 
 // GetReceiptPoints retrieves points for a specific receipt by ID.
@@ -73,20 +319,388 @@ func (rs *ReceiptStorage) GetReceiptPoints(id string) (int64, error) {
 	if !exists {
 		return 0, fmt.Errorf("points for receipt with ID %s not found", id)
 	}
+	if deletedAt, deleted := rs.deleted[id]; deleted {
+		return 0, &ReceiptDeletedError{ID: id, DeletedAt: deletedAt}
+	}
 	return points, nil
 }
 
-// UpdateReceipt updates an existing receipt in the storage.
-func (rs *ReceiptStorage) UpdateReceipt(id string, receipt Receipt, points int64) error {
+// GetReceiptBreakdown retrieves the per-rule points breakdown for a specific receipt by ID.
+func (rs *ReceiptStorage) GetReceiptBreakdown(id string) ([]RuleResult, error) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 
-	_, exists := rs.Receipts[id]
-	if !exists {
-		return fmt.Errorf("receipt with ID %s not found", id)
+	if _, exists := rs.Points[id]; !exists {
+		return nil, fmt.Errorf("points for receipt with ID %s not found", id)
+	}
+	if deletedAt, deleted := rs.deleted[id]; deleted {
+		return nil, &ReceiptDeletedError{ID: id, DeletedAt: deletedAt}
 	}
+	return rs.Breakdowns[id], nil
+}
+
+// ReplaceReceipt replaces the content, points and breakdown of an existing receipt
+// and returns its new version. Unless expectedVersion is AnyVersion, the receipt
+// must still be at that version. If the receipt credited a user, their balance is
+// adjusted to the new points in the same step.
+func (rs *ReceiptStorage) ReplaceReceipt(id string, receipt Receipt, points int64, breakdown []RuleResult, expectedVersion int64, updatedAt time.Time) (int64, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
 
+	if err := rs.lookup(id); err != nil {
+		return 0, err
+	}
+	current := rs.version(id)
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return 0, &VersionConflictError{ID: id, Current: current}
+	}
+	if _, _, err := parseReceiptAmounts(receipt); err != nil {
+		return 0, err
+	}
+	// A receipt stays with the client and user that submitted it
+	receipt.ClientID = rs.Receipts[id].ClientID
+	receipt.UserID = rs.Receipts[id].UserID
+	fingerprint := Fingerprint(receipt)
+	if existingID, exists := rs.duplicateOf(fingerprint, id); exists {
+		return 0, &DuplicateReceiptError{ExistingID: existingID}
+	}
+
+	rs.unindexFingerprint(Fingerprint(rs.Receipts[id]), id)
 	rs.Receipts[id] = receipt
 	rs.Points[id] = points
+	rs.Breakdowns[id] = breakdown
+	rs.indexFingerprint(fingerprint, id)
+	rs.versions[id] = current + 1
+
+	if entries := rs.receiptEntries(id); len(entries) > 0 {
+		balance := rs.accounts[entries[0].UserID].Balance
+		if adjustment, post := planAdjustment(id, entries, balance, points, updatedAt); post {
+			rs.post(adjustment)
+		}
+	}
+	return current + 1, nil
+}
+
+// DeleteReceipt soft-deletes a receipt, leaving a tombstone. Unless expectedVersion
+// is AnyVersion, the receipt must still be at that version.
+func (rs *ReceiptStorage) DeleteReceipt(id string, expectedVersion int64, deletedAt time.Time) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	if err := rs.lookup(id); err != nil {
+		return err
+	}
+	current := rs.version(id)
+	if expectedVersion != AnyVersion && expectedVersion != current {
+		return &VersionConflictError{ID: id, Current: current}
+	}
+
+	// A deleted receipt no longer blocks resubmitting the same content
+	rs.unindexFingerprint(Fingerprint(rs.Receipts[id]), id)
+	rs.deleted[id] = deletedAt
+	rs.versions[id] = current + 1
+
+	// Take back the receipt's points; a receipt that credited nobody has none to take
+	rs.reverseCredit(id, ReasonReceiptDeleted, deletedAt)
 	return nil
 }
+
+// GetReceiptVersion retrieves the current version of a specific receipt by ID.
+func (rs *ReceiptStorage) GetReceiptVersion(id string) (int64, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.lookup(id); err != nil {
+		return 0, err
+	}
+	return rs.version(id), nil
+}
+
+// GetIdempotencyRecord retrieves the outcome recorded for an idempotency key.
+func (rs *ReceiptStorage) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	record, exists := rs.idempotency[key]
+	if !exists {
+		return IdempotencyRecord{}, fmt.Errorf("idempotency key %s not found", key)
+	}
+	return record, nil
+}
+
+// SaveIdempotencyRecord records the outcome of a request, replacing any earlier record for its key.
+func (rs *ReceiptStorage) SaveIdempotencyRecord(record IdempotencyRecord) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	rs.idempotency[record.Key] = record
+	return nil
+}
+
+// SaveAPIKey stores a new API key.
+func (rs *ReceiptStorage) SaveAPIKey(key APIKey) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	for _, existing := range rs.apiKeys {
+		if existing.ID == key.ID || existing.Hash == key.Hash {
+			return fmt.Errorf("api key %s already exists", key.ID)
+		}
+	}
+	rs.apiKeys[key.ID] = key
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret has the given hash.
+func (rs *ReceiptStorage) GetAPIKeyByHash(hash string) (APIKey, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, key := range rs.apiKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return APIKey{}, &APIKeyNotFoundError{Key: hash}
+}
+
+// ListAPIKeys returns every API key, revoked ones included, oldest first.
+func (rs *ReceiptStorage) ListAPIKeys() ([]APIKey, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(rs.apiKeys))
+	for _, key := range rs.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key so it no longer authenticates.
+func (rs *ReceiptStorage) RevokeAPIKey(id string, revokedAt time.Time) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	key, exists := rs.apiKeys[id]
+	if !exists {
+		return &APIKeyNotFoundError{Key: id}
+	}
+	if key.Active() {
+		key.RevokedAt = revokedAt
+		rs.apiKeys[id] = key
+	}
+	return nil
+}
+
+// post records a transaction of two entries: entry on the user account, and its
+// opposite on the system account of its type. It returns the user entry.
+// Callers must hold rs.mu.
+func (rs *ReceiptStorage) post(entry LedgerEntry) LedgerEntry {
+	entry.TransactionID = 1
+	if len(rs.ledger) > 0 {
+		entry.TransactionID = rs.ledger[len(rs.ledger)-1].TransactionID + 1
+	}
+	contra := entry
+	contra.UserID = contraAccount(entry.Type)
+	contra.Points = -entry.Points
+
+	entry = rs.appendLedgerEntry(entry)
+	rs.appendLedgerEntry(contra)
+	return entry
+}
+
+// appendLedgerEntry records an entry, opening the account if needed, and
+// applies it to the balance. Callers must hold rs.mu.
+func (rs *ReceiptStorage) appendLedgerEntry(entry LedgerEntry) LedgerEntry {
+	account, exists := rs.accounts[entry.UserID]
+	if !exists {
+		account = Account{UserID: entry.UserID, CreatedAt: entry.CreatedAt}
+	}
+	account.Balance += entry.Points
+	account.UpdatedAt = entry.CreatedAt
+	rs.accounts[entry.UserID] = account
+
+	entry.ID = int64(len(rs.ledger)) + 1
+	entry.Balance = account.Balance
+	rs.ledger = append(rs.ledger, entry)
+	return entry
+}
+
+// RedeemPoints spends points from a user's account. A redemption repeating the key
+// of an earlier one for the same points returns the original entry and true, without
+// spending again. The balance never goes negative: a redemption exceeding it fails
+// with an InsufficientPointsError.
+func (rs *ReceiptStorage) RedeemPoints(redemption Redemption, at time.Time) (LedgerEntry, bool, error) {
+	if err := checkRedemption(redemption); err != nil {
+		return LedgerEntry{}, false, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	account, exists := rs.accounts[redemption.UserID]
+	if !exists || IsSystemAccount(redemption.UserID) {
+		return LedgerEntry{}, false, &AccountNotFoundError{UserID: redemption.UserID}
+	}
+	for _, entry := range rs.ledger {
+		if entry.UserID == redemption.UserID && entry.Type == LedgerRedeem && entry.Reference == redemption.Key {
+			if -entry.Points != redemption.Points {
+				return LedgerEntry{}, false, &RedemptionConflictError{Key: redemption.Key, Existing: entry}
+			}
+			return entry, true, nil
+		}
+	}
+	if account.Balance < redemption.Points {
+		return LedgerEntry{}, false, &InsufficientPointsError{UserID: redemption.UserID, Balance: account.Balance, Requested: redemption.Points}
+	}
+
+	entry := rs.post(LedgerEntry{
+		UserID:    redemption.UserID,
+		Type:      LedgerRedeem,
+		Points:    -redemption.Points,
+		Reference: redemption.Key,
+		Reason:    redemption.Reason,
+		CreatedAt: at,
+	})
+	return entry, false, nil
+}
+
+// ReverseReceiptCredit takes back the points a receipt credited to its user, for
+// example when it turns out to be fraudulent. Points already spent cannot be taken
+// back: at most the current balance is, and the rest is recorded as the reversal's
+// shortfall. Reversing a receipt again takes back what it can of the shortfall, or
+// returns the last reversal when there is nothing left to take.
+func (rs *ReceiptStorage) ReverseReceiptCredit(receiptID, reason string, at time.Time) (LedgerEntry, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	if _, exists := rs.Receipts[receiptID]; !exists {
+		return LedgerEntry{}, &ReceiptNotFoundError{ID: receiptID}
+	}
+	return rs.reverseCredit(receiptID, reason, at)
+}
+
+// reverseCredit posts the reversal of a receipt's credit, as planned by
+// planReversal. Callers must hold rs.mu.
+func (rs *ReceiptStorage) reverseCredit(receiptID, reason string, at time.Time) (LedgerEntry, error) {
+	entries := rs.receiptEntries(receiptID)
+	var balance int64
+	if len(entries) > 0 {
+		balance = rs.accounts[entries[0].UserID].Balance
+	}
+	reversal, post, err := planReversal(receiptID, entries, balance, reason, at)
+	if err != nil || !post {
+		return reversal, err
+	}
+	return rs.post(reversal), nil
+}
+
+// receiptEntries returns the user entries of a receipt, oldest first. Callers
+// must hold rs.mu.
+func (rs *ReceiptStorage) receiptEntries(receiptID string) []LedgerEntry {
+	var entries []LedgerEntry
+	for _, entry := range rs.ledger {
+		if entry.ReceiptID == receiptID && !IsSystemAccount(entry.UserID) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ExpirePoints expires, in every user account, the points earned at or before
+// cutoff that are still held. It returns the expiration entries it recorded.
+func (rs *ReceiptStorage) ExpirePoints(cutoff, at time.Time) ([]LedgerEntry, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ensureMaps()
+
+	userIDs := make([]string, 0, len(rs.accounts))
+	for userID := range rs.accounts {
+		if !IsSystemAccount(userID) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+
+	expired := []LedgerEntry{}
+	for _, userID := range userIDs {
+		var entries []LedgerEntry
+		for _, entry := range rs.ledger {
+			if entry.UserID == userID {
+				entries = append(entries, entry)
+			}
+		}
+		if points := expiredPoints(entries, cutoff); points > 0 {
+			expired = append(expired, rs.post(LedgerEntry{UserID: userID, Type: LedgerExpire, Points: -points, Reason: expirationReason(cutoff), CreatedAt: at}))
+		}
+	}
+	return expired, nil
+}
+
+// GetAccount retrieves the points account of a user.
+func (rs *ReceiptStorage) GetAccount(userID string) (Account, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	account, exists := rs.accounts[userID]
+	if !exists {
+		return Account{}, &AccountNotFoundError{UserID: userID}
+	}
+	return account, nil
+}
+
+// ListLedgerEntries returns every ledger entry of a user's account, oldest first.
+func (rs *ReceiptStorage) ListLedgerEntries(userID string) ([]LedgerEntry, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, exists := rs.accounts[userID]; !exists {
+		return nil, &AccountNotFoundError{UserID: userID}
+	}
+	entries := []LedgerEntry{}
+	for _, entry := range rs.ledger {
+		if entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Ping reports whether the storage is usable. The in-memory storage always is.
+func (rs *ReceiptStorage) Ping() error {
+	return nil
+}
+
+// Close releases the storage. The in-memory storage holds no resources.
+func (rs *ReceiptStorage) Close() error {
+	return nil
+}
+
+// parseReceiptAmounts parses the total and item prices of a receipt, so that
+// malformed amounts are rejected rather than stored.
+func parseReceiptAmounts(receipt Receipt) (Money, []Money, error) {
+	total, err := ParseMoney(receipt.Total)
+	if err != nil {
+		return 0, nil, fmt.Errorf("receipt %s total: %w", receipt.ID, err)
+	}
+	prices := make([]Money, len(receipt.Items))
+	for i, item := range receipt.Items {
+		prices[i], err = ParseMoney(item.Price)
+		if err != nil {
+			return 0, nil, fmt.Errorf("receipt %s item %d price: %w", receipt.ID, i, err)
+		}
+	}
+	return total, prices, nil
+}
@@ -1,7 +1,9 @@
 package common
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 // Helper function to create sample receipts
@@ -29,13 +31,13 @@ func TestAddReceipt(t *testing.T) {
 	})
 
 	// Add receipt
-	err := rs.AddReceipt(receipt, 100)
+	err := rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 	if err != nil {
 		t.Errorf("expected no error, but got: %v", err)
 	}
 
 	// Attempt to add the same receipt again
-	err = rs.AddReceipt(receipt, 100)
+	err = rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 	if err == nil || err.Error() != "receipt with ID 1 already exists" {
 		t.Errorf("expected error 'receipt with ID 1 already exists', but got: %v", err)
 	}
@@ -59,7 +61,7 @@ func TestGetAllReceipts(t *testing.T) {
 		{"Item A", "50.00"},
 		{"Item B", "50.00"},
 	})
-	rs.AddReceipt(receipt, 100)
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 
 	receipts, err := rs.GetAllReceipts()
 	if err != nil {
@@ -91,7 +93,7 @@ func TestGetReceiptByID(t *testing.T) {
 		{"Item A", "50.00"},
 		{"Item B", "50.00"},
 	})
-	rs.AddReceipt(receipt, 100)
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 
 	retrievedReceipt, err := rs.GetReceiptByID("1")
 	if err != nil {
@@ -120,7 +122,7 @@ func TestGetReceiptPoints(t *testing.T) {
 		{"Item A", "50.00"},
 		{"Item B", "50.00"},
 	})
-	rs.AddReceipt(receipt, 100)
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 
 	points, err := rs.GetReceiptPoints("1")
 	if err != nil {
@@ -131,7 +133,7 @@ func TestGetReceiptPoints(t *testing.T) {
 	}
 }
 
-func TestUpdateReceipt(t *testing.T) {
+func TestReplaceReceipt(t *testing.T) {
 	rs := &ReceiptStorage{
 		Receipts: make(map[string]Receipt),
 		Points:   make(map[string]int64),
@@ -143,13 +145,13 @@ func TestUpdateReceipt(t *testing.T) {
 		{"Item A", "50.00"},
 		{"Item B", "50.00"},
 	})
-	rs.AddReceipt(receipt, 100)
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
 
 	// Update the receipt
 	updatedReceipt := createSampleReceipt("1", "Retailer B", "2023-11-26", "13:00", "200.00", []Item{
 		{"Item C", "200.00"},
 	})
-	err := rs.UpdateReceipt("1", updatedReceipt, 200)
+	_, err := rs.ReplaceReceipt("1", updatedReceipt, 200, nil, AnyVersion, time.Now())
 	if err != nil {
 		t.Errorf("expected no error, but got: %v", err)
 	}
@@ -166,3 +168,220 @@ func TestUpdateReceipt(t *testing.T) {
 		t.Errorf("expected total '200.00', but got: %s", retrievedReceipt.Total)
 	}
 }
+
+func TestOpenStore(t *testing.T) {
+	store, err := OpenStore(BackendMemory, "")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if _, ok := store.(*ReceiptStorage); !ok {
+		t.Errorf("expected in-memory storage, got %T", store)
+	}
+
+	if _, err := OpenStore(BackendSQLite, ""); err == nil {
+		t.Errorf("expected error for sqlite backend without a database path")
+	}
+
+	if _, err := OpenStore("postgres", ""); err == nil {
+		t.Errorf("expected error for unknown backend")
+	}
+}
+
+func TestGetReceiptBreakdown(t *testing.T) {
+	rs := NewReceiptStorage()
+
+	breakdown := []RuleResult{{Rule: "round_dollar", Matched: true, Input: "100.00", Points: 50}}
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{{"Item A", "100.00"}})
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 50, Breakdown: breakdown})
+
+	stored, err := rs.GetReceiptBreakdown("1")
+	if err != nil {
+		t.Errorf("expected no error, but got: %v", err)
+	}
+	if len(stored) != 1 || stored[0] != breakdown[0] {
+		t.Errorf("expected breakdown %+v, got %+v", breakdown, stored)
+	}
+
+	_, err = rs.GetReceiptBreakdown("2")
+	if err == nil || err.Error() != "points for receipt with ID 2 not found" {
+		t.Errorf("expected error 'points for receipt with ID 2 not found', but got: %v", err)
+	}
+}
+
+func TestAddReceiptRejectsMalformedAmounts(t *testing.T) {
+	rs := NewReceiptStorage()
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{{"Item A", "1O.00"}})
+	if err := rs.AddSubmission(Submission{Receipt: receipt, Points: 0}); err == nil {
+		t.Errorf("expected error for malformed item price")
+	}
+	if _, err := rs.GetReceiptByID("1"); err == nil {
+		t.Errorf("expected the receipt not to be stored")
+	}
+}
+
+func TestAddSubmissionDetectsDuplicates(t *testing.T) {
+	rs := NewReceiptStorage()
+
+	receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "100.00", []Item{{"Item A", "100.00"}})
+	rs.AddSubmission(Submission{Receipt: receipt, Points: 100})
+
+	duplicate := receipt
+	duplicate.ID = "2"
+	err := rs.AddSubmission(Submission{Receipt: duplicate, Points: 100})
+
+	var dupErr *DuplicateReceiptError
+	if !errors.As(err, &dupErr) || dupErr.ExistingID != "1" {
+		t.Errorf("expected duplicate of receipt 1, but got: %v", err)
+	}
+	if _, err := rs.GetReceiptByID("2"); err == nil {
+		t.Errorf("expected the duplicate not to be stored")
+	}
+}
+
+// TestDuplicatesAndTombstones checks that both stores report the same duplicate as
+// allowed copies of a receipt are changed and deleted
+func TestDuplicatesAndTombstones(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	receipt := func(id, retailer string) Receipt {
+		return createSampleReceipt(id, retailer, "2023-11-25", "12:00", "10.00", []Item{{"Item A", "10.00"}})
+	}
+	// duplicateOf returns the ID reported by a duplicate error, or "" for no error
+	duplicateOf := func(err error) string {
+		var dupErr *DuplicateReceiptError
+		if errors.As(err, &dupErr) {
+			return dupErr.ExistingID
+		}
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	for name, store := range stores {
+		for _, id := range []string{"1", "2", "3"} {
+			if err := store.AddSubmission(Submission{Receipt: receipt(id, "Target"), At: now, AllowDuplicates: true}); err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+		}
+
+		steps := []struct {
+			description string
+			change      func() error
+			expected    string // ID reported as the duplicate, "" when the change succeeds
+		}{
+			{"copy of three receipts", func() error { return store.AddSubmission(Submission{Receipt: receipt("4", "Target")}) }, "1"},
+			{"oldest copy deleted", func() error {
+				if err := store.DeleteReceipt("1", AnyVersion, now); err != nil {
+					return err
+				}
+				return store.AddSubmission(Submission{Receipt: receipt("4", "Target")})
+			}, "2"},
+			{"next copy changed", func() error {
+				if _, err := store.ReplaceReceipt("2", receipt("2", "Walmart"), 0, nil, AnyVersion, now); err != nil {
+					return err
+				}
+				return store.AddSubmission(Submission{Receipt: receipt("4", "Target")})
+			}, "3"},
+			{"changed back to a copy", func() error {
+				_, err := store.ReplaceReceipt("2", receipt("2", "Target"), 0, nil, AnyVersion, now)
+				return err
+			}, "3"},
+			{"last copy deleted", func() error {
+				if err := store.DeleteReceipt("3", AnyVersion, now); err != nil {
+					return err
+				}
+				return store.AddSubmission(Submission{Receipt: receipt("4", "Target")})
+			}, ""},
+			{"changed into the resubmitted copy", func() error {
+				_, err := store.ReplaceReceipt("2", receipt("2", "Target"), 0, nil, AnyVersion, now)
+				return err
+			}, "4"},
+		}
+		for _, step := range steps {
+			if got := duplicateOf(step.change()); got != step.expected {
+				t.Errorf("%s: %s: expected duplicate %q, got %q", name, step.description, step.expected, got)
+			}
+		}
+	}
+}
+
+func TestIdempotencyRecords(t *testing.T) {
+	rs := NewReceiptStorage()
+
+	_, err := rs.GetIdempotencyRecord("key-1")
+	if err == nil || err.Error() != "idempotency key key-1 not found" {
+		t.Errorf("expected error 'idempotency key key-1 not found', but got: %v", err)
+	}
+
+	record := IdempotencyRecord{Key: "key-1", ReceiptID: "1", Status: 201, RequestFingerprint: "abc", CreatedAt: time.Now()}
+	if err := rs.SaveIdempotencyRecord(record); err != nil {
+		t.Errorf("expected no error, but got: %v", err)
+	}
+
+	stored, err := rs.GetIdempotencyRecord("key-1")
+	if err != nil || stored.ReceiptID != "1" || stored.Status != 201 {
+		t.Errorf("expected stored record %+v, but got: %+v (%v)", record, stored, err)
+	}
+}
+
+func TestAddSubmission(t *testing.T) {
+	sqlite, _ := newTestSQLiteStorage(t)
+	stores := map[string]ReceiptStore{
+		"memory": NewReceiptStorage(),
+		"sqlite": sqlite,
+	}
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		receipt := createSampleReceipt("1", "Retailer A", "2023-11-25", "12:00", "1.00", []Item{{"Item A", "1.00"}})
+		submission := func(id string, at time.Time) Submission {
+			receipt := receipt
+			receipt.ID = id
+			return Submission{
+				Receipt:          receipt,
+				Points:           10,
+				At:               at,
+				Idempotency:      IdempotencyRecord{Key: "key-1", ReceiptID: id, Status: 201, RequestFingerprint: Fingerprint(receipt), CreatedAt: at},
+				IdempotencySince: at.Add(-time.Hour),
+			}
+		}
+
+		if err := store.AddSubmission(submission("1", now)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if record, err := store.GetIdempotencyRecord("key-1"); err != nil || record.ReceiptID != "1" {
+			t.Errorf("%s: expected the key to be recorded with the receipt, got %+v (%v)", name, record, err)
+		}
+
+		// A retry within the window gets the original outcome and stores nothing
+		var usedErr *IdempotencyKeyUsedError
+		retry := submission("2", now.Add(time.Minute))
+		retry.AllowDuplicates = true
+		if err := store.AddSubmission(retry); !errors.As(err, &usedErr) || usedErr.Record.ReceiptID != "1" {
+			t.Errorf("%s: expected the key to be in use by receipt 1, got %v", name, err)
+		}
+		if _, err := store.GetReceiptByID("2"); err == nil {
+			t.Errorf("%s: expected the retry not to be stored", name)
+		}
+
+		// Once the key expired, the same content is a duplicate unless duplicates are allowed
+		late := submission("3", now.Add(2*time.Hour))
+		var dupErr *DuplicateReceiptError
+		if err := store.AddSubmission(late); !errors.As(err, &dupErr) || dupErr.ExistingID != "1" {
+			t.Errorf("%s: expected a duplicate of receipt 1, got %v", name, err)
+		}
+		late.AllowDuplicates = true
+		if err := store.AddSubmission(late); err != nil {
+			t.Fatalf("%s: expected the duplicate to be allowed, got %v", name, err)
+		}
+		if record, err := store.GetIdempotencyRecord("key-1"); err != nil || record.ReceiptID != "3" {
+			t.Errorf("%s: expected the expired key to be replaced, got %+v (%v)", name, record, err)
+		}
+	}
+}
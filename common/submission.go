@@ -0,0 +1,40 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Submission is a new receipt to store with its points. Storing it credits the
+// points to the receipt's user, if any, and records its idempotency key in the
+// same step, so a retry racing the original request cannot store a second copy.
+type Submission struct {
+	Receipt   Receipt
+	Points    int64
+	Breakdown []RuleResult
+	At        time.Time // When the receipt is stored and its points credited
+
+	// Idempotency is recorded with the receipt when its Key is set. A record of the
+	// key created at or after IdempotencySince fails the submission with an
+	// IdempotencyKeyUsedError; older records have expired and are replaced.
+	Idempotency      IdempotencyRecord
+	IdempotencySince time.Time
+
+	AllowDuplicates bool // Store the receipt even when a stored receipt has the same fingerprint
+}
+
+// IdempotencyKeyUsedError is returned by a ReceiptStore when the idempotency key
+// of a submission already recorded the outcome of an earlier request.
+type IdempotencyKeyUsedError struct {
+	Record IdempotencyRecord // Outcome of the earlier request
+}
+
+func (e *IdempotencyKeyUsedError) Error() string {
+	return fmt.Sprintf("idempotency key %s was already used for receipt %s", e.Record.Key, e.Record.ReceiptID)
+}
+
+// idempotencyKeyUsed reports whether an existing record of a submission's key is
+// still in its window
+func idempotencyKeyUsed(record IdempotencyRecord, submission Submission) bool {
+	return !record.CreatedAt.Before(submission.IdempotencySince)
+}
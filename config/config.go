@@ -0,0 +1,257 @@
+// Package config loads and validates the server settings.
+//
+// Settings are layered: built-in defaults, then an optional YAML or JSON file,
+// then RECEIPT_* environment variables, then command-line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the config file path.
+const FileEnv = "RECEIPT_CONFIG_FILE"
+
+// Config holds every server setting.
+type Config struct {
+	ListenAddr        string            `json:"listenAddr" yaml:"listenAddr"`               // Address the HTTP server listens on, e.g. ":8080"
+	Store             StoreConfig       `json:"store" yaml:"store"`                         // Receipt storage backend
+	Log               LogConfig         `json:"log" yaml:"log"`                             // Log output
+	Limits            LimitsConfig      `json:"limits" yaml:"limits"`                       // Request size limits
+	Timeouts          TimeoutsConfig    `json:"timeouts" yaml:"timeouts"`                   // HTTP timeouts
+	RulesFile         string            `json:"rulesFile" yaml:"rulesFile"`                 // Points rules file; empty for the standard rules
+	Consistency       ConsistencyConfig `json:"consistency" yaml:"consistency"`             // Cross-field receipt checks
+	IdempotencyWindow Duration          `json:"idempotencyWindow" yaml:"idempotencyWindow"` // How long an Idempotency-Key replays its response
+	AllowDuplicates   bool              `json:"allowDuplicates" yaml:"allowDuplicates"`     // Store receipts with the same content as a stored receipt instead of answering 409
+	Auth              AuthConfig        `json:"auth" yaml:"auth"`                           // Client authentication
+	Points            PointsConfig      `json:"points" yaml:"points"`                       // Loyalty points expiration
+}
+
+// StoreConfig selects the receipt storage backend.
+type StoreConfig struct {
+	Backend string `json:"backend" yaml:"backend"` // common.BackendMemory or common.BackendSQLite
+	DSN     string `json:"dsn" yaml:"dsn"`         // Database file path for SQLite
+}
+
+// LogConfig configures the log output.
+type LogConfig struct {
+	Level  string `json:"level" yaml:"level"`   // debug, info, warn or error
+	Format string `json:"format" yaml:"format"` // text or json
+}
+
+// LimitsConfig bounds the size of requests.
+type LimitsConfig struct {
+	MaxBodyBytes      int64 `json:"maxBodyBytes" yaml:"maxBodyBytes"`           // Largest request body for single-receipt endpoints
+	MaxBatchBodyBytes int64 `json:"maxBatchBodyBytes" yaml:"maxBatchBodyBytes"` // Largest request body for batch submissions
+	BatchSize         int   `json:"batchSize" yaml:"batchSize"`                 // Most receipts accepted in one batch
+}
+
+// TimeoutsConfig bounds how long the server spends on a connection or request.
+type TimeoutsConfig struct {
+	Read     Duration `json:"read" yaml:"read"`         // Reading the whole request, including the body
+	Write    Duration `json:"write" yaml:"write"`       // Writing the response
+	Idle     Duration `json:"idle" yaml:"idle"`         // Keeping an idle keep-alive connection open
+	Handler  Duration `json:"handler" yaml:"handler"`   // Processing a request; 0 disables the limit
+	Shutdown Duration `json:"shutdown" yaml:"shutdown"` // Draining in-flight requests on shutdown
+	Drain    Duration `json:"drain" yaml:"drain"`       // Failing readiness before shutdown starts, for load balancers to stop routing traffic
+}
+
+// ConsistencyConfig configures the cross-field receipt checks.
+type ConsistencyConfig struct {
+	Mode      string `json:"mode" yaml:"mode"`           // strict or lenient
+	Tolerance string `json:"tolerance" yaml:"tolerance"` // Allowed difference between the total and the item prices, e.g. "0.50"
+}
+
+// AuthConfig selects how clients authenticate. With every method off the
+// receipt endpoints are open to anyone.
+type AuthConfig struct {
+	APIKeys      bool     `json:"apiKeys" yaml:"apiKeys"`           // Require an X-API-Key issued with receiptctl apikey
+	JWKSFile     string   `json:"jwksFile" yaml:"jwksFile"`         // Accept bearer tokens signed by a key in this JWKS file
+	JWKSRefresh  Duration `json:"jwksRefresh" yaml:"jwksRefresh"`   // How often the JWKS file is checked for changes; 0 reloads only on SIGHUP
+	JWTIssuer    string   `json:"jwtIssuer" yaml:"jwtIssuer"`       // Required iss claim of bearer tokens
+	JWTAudience  string   `json:"jwtAudience" yaml:"jwtAudience"`   // Required aud claim of bearer tokens
+	JWTUserClaim string   `json:"jwtUserClaim" yaml:"jwtUserClaim"` // Claim holding the user ID, "sub" when empty
+}
+
+// PointsConfig sets when loyalty points expire.
+type PointsConfig struct {
+	ExpireAfter    Duration `json:"expireAfter" yaml:"expireAfter"`       // Age at which earned points expire; 0 keeps them forever
+	ExpiryInterval Duration `json:"expiryInterval" yaml:"expiryInterval"` // How often expired points are looked for
+	ExpiringSoon   Duration `json:"expiringSoon" yaml:"expiringSoon"`     // How far ahead the expiring points of a user are listed
+}
+
+// Duration is a time.Duration written as a string such as "5s" in config files.
+type Duration time.Duration
+
+// UnmarshalText parses a duration such as "1m30s".
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration such as "1m30s".
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the built-in settings.
+func Default() Config {
+	return Config{
+		ListenAddr: ":8080",
+		Store:      StoreConfig{Backend: common.BackendMemory},
+		Log:        LogConfig{Level: "info", Format: logger.FormatText},
+		Limits: LimitsConfig{
+			MaxBodyBytes:      1 << 20,
+			MaxBatchBodyBytes: 32 << 20,
+			BatchSize:         500,
+		},
+		Timeouts: TimeoutsConfig{
+			Read:     Duration(15 * time.Second),
+			Write:    Duration(30 * time.Second),
+			Idle:     Duration(60 * time.Second),
+			Handler:  Duration(25 * time.Second),
+			Shutdown: Duration(20 * time.Second),
+			Drain:    Duration(5 * time.Second),
+		},
+		Consistency:       ConsistencyConfig{Mode: string(validation.ModeLenient), Tolerance: "0.00"},
+		IdempotencyWindow: Duration(24 * time.Hour),
+		Auth:              AuthConfig{JWKSRefresh: Duration(time.Minute)},
+		Points: PointsConfig{
+			ExpiryInterval: Duration(time.Hour),
+			ExpiringSoon:   Duration(30 * 24 * time.Hour),
+		},
+	}
+}
+
+// LoadFile reads settings from a .yaml/.yml or .json file over cfg.
+// Settings missing from the file keep their value in cfg, and unknown keys are
+// rejected so a misspelt setting does not silently keep its default.
+func LoadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(cfg); err == io.EOF {
+			err = nil // An empty file changes nothing
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(cfg); err == nil && decoder.More() {
+			err = errors.New("unexpected data after the settings")
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting.
+func (c Config) Validate() error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if c.ListenAddr == "" {
+		check(errors.New("listen address is required"))
+	}
+	switch c.Store.Backend {
+	case "", common.BackendMemory:
+	case common.BackendSQLite:
+		if c.Store.DSN == "" {
+			check(errors.New("the sqlite store requires a DSN"))
+		}
+	default:
+		check(fmt.Errorf("unknown storage backend %q", c.Store.Backend))
+	}
+	_, err := c.LogLevel()
+	check(err)
+	_, err = logger.ParseFormat(c.Log.Format)
+	check(err)
+	if c.Limits.MaxBodyBytes <= 0 || c.Limits.MaxBatchBodyBytes <= 0 {
+		check(errors.New("body size limits must be positive"))
+	}
+	if c.Limits.BatchSize <= 0 {
+		check(errors.New("batch size must be positive"))
+	}
+	if c.Timeouts.Read < 0 || c.Timeouts.Write < 0 || c.Timeouts.Idle < 0 || c.Timeouts.Handler < 0 || c.Timeouts.Shutdown < 0 || c.Timeouts.Drain < 0 {
+		check(errors.New("timeouts must not be negative"))
+	}
+	_, err = c.ConsistencyOptions()
+	check(err)
+	if c.IdempotencyWindow <= 0 {
+		check(errors.New("idempotency window must be positive"))
+	}
+	if c.Points.ExpireAfter < 0 || c.Points.ExpiringSoon < 0 {
+		check(errors.New("points expiration settings must not be negative"))
+	}
+	if c.Points.ExpireAfter > 0 && c.Points.ExpiryInterval <= 0 {
+		check(errors.New("points expiry interval must be positive"))
+	}
+	if c.Auth.JWKSFile == "" && (c.Auth.JWTIssuer != "" || c.Auth.JWTAudience != "" || c.Auth.JWTUserClaim != "") {
+		check(errors.New("bearer token settings require a JWKS file"))
+	}
+	if c.Auth.APIKeys && (c.Store.Backend == "" || c.Store.Backend == common.BackendMemory) {
+		check(errors.New("API keys require a persistent store, as keys issued with receiptctl never reach the memory store"))
+	}
+	if c.Auth.JWKSRefresh < 0 {
+		check(errors.New("jwks refresh interval must not be negative"))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// LogLevel returns the parsed log level.
+func (c Config) LogLevel() (logger.Level, error) {
+	return logger.ParseLevel(c.Log.Level)
+}
+
+// ConsistencyOptions returns the parsed consistency check settings.
+func (c Config) ConsistencyOptions() (validation.ConsistencyOptions, error) {
+	opts := validation.DefaultConsistencyOptions
+	var err error
+	if c.Consistency.Mode != "" {
+		if opts.Mode, err = validation.ParseMode(c.Consistency.Mode); err != nil {
+			return opts, err
+		}
+	}
+	if c.Consistency.Tolerance != "" {
+		if opts.Tolerance, err = common.ParseMoney(c.Consistency.Tolerance); err != nil {
+			return opts, fmt.Errorf("consistency tolerance: %w", err)
+		}
+		if opts.Tolerance < 0 {
+			return opts, errors.New("consistency tolerance must not be negative")
+		}
+	}
+	return opts, nil
+}
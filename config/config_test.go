@@ -0,0 +1,160 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to build a getenv function from a map
+func envFrom(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid, got: %v", err)
+	}
+
+	cfg, err := Load(nil, envFrom(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if cfg.ListenAddr != ":8080" || cfg.Store.Backend != "memory" || time.Duration(cfg.IdempotencyWindow) != 24*time.Hour {
+		t.Errorf("expected the defaults, got: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte(`
+listenAddr: ":9000"
+store:
+  backend: sqlite
+  dsn: file.db
+log:
+  level: debug
+timeouts:
+  read: 5s
+`), 0o644)
+
+	env := envFrom(map[string]string{
+		FileEnv:             file,
+		"RECEIPT_STORE_DSN": "env.db",
+		"RECEIPT_LOG_LEVEL": "warn",
+	})
+	cfg, err := Load([]string{"-log-level", "error", "-write-timeout", "1m"}, env, io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	// The file overrides the defaults, the environment the file, and flags the environment
+	if cfg.ListenAddr != ":9000" || cfg.Store.Backend != "sqlite" {
+		t.Errorf("expected settings from the file, got: %+v", cfg)
+	}
+	if cfg.Store.DSN != "env.db" {
+		t.Errorf("expected the DSN from the environment, got %q", cfg.Store.DSN)
+	}
+	if cfg.Log.Level != "error" || time.Duration(cfg.Timeouts.Write) != time.Minute {
+		t.Errorf("expected settings from the flags, got: %+v", cfg)
+	}
+	if time.Duration(cfg.Timeouts.Read) != 5*time.Second || time.Duration(cfg.Timeouts.Idle) != 60*time.Second {
+		t.Errorf("expected unset timeouts to keep their defaults, got: %+v", cfg.Timeouts)
+	}
+}
+
+func TestLoadJSONFileFlag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(file, []byte(`{"limits": {"batchSize": 10}, "idempotencyWindow": "1h"}`), 0o644)
+
+	cfg, err := Load([]string{"-config", file}, envFrom(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if cfg.Limits.BatchSize != 10 || time.Duration(cfg.IdempotencyWindow) != time.Hour || cfg.Limits.MaxBodyBytes != 1<<20 {
+		t.Errorf("unexpected settings: %+v", cfg)
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": "limits:\n  batchSise: 10\n",
+		"config.json": `{"limits": {"batchSise": 10}}`,
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(content), 0o644)
+
+		cfg := Default()
+		if err := LoadFile(file, &cfg); err == nil || !strings.Contains(err.Error(), "batchSise") {
+			t.Errorf("%s: expected an error naming the unknown key, got: %v", name, err)
+		}
+	}
+
+	// An empty YAML file keeps every default
+	file := filepath.Join(dir, "empty.yaml")
+	os.WriteFile(file, nil, 0o644)
+	cfg := Default()
+	if err := LoadFile(file, &cfg); err != nil || cfg != Default() {
+		t.Errorf("expected an empty file to change nothing, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.ListenAddr = ""
+	cfg.Store = StoreConfig{Backend: "sqlite"}
+	cfg.Log.Format = "xml"
+	cfg.Limits.BatchSize = 0
+	cfg.Consistency.Tolerance = "abc"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	for _, want := range []string{"listen address", "DSN", "log format", "batch size", "tolerance"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateRejectsNegativeTolerance(t *testing.T) {
+	cfg := Default()
+	cfg.Consistency.Tolerance = "-0.50"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "tolerance must not be negative") {
+		t.Errorf("expected a negative tolerance to be rejected, got: %v", err)
+	}
+}
+
+func TestValidateAPIKeysNeedAPersistentStore(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APIKeys = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "API keys") {
+		t.Errorf("expected API keys on the memory store to be rejected, got: %v", err)
+	}
+
+	cfg.Store = StoreConfig{Backend: "sqlite", DSN: "receipts.db"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected API keys on the sqlite store to be accepted, got: %v", err)
+	}
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	if _, err := Load([]string{"-read-timeout", "soon"}, envFrom(nil), io.Discard); err == nil || !strings.Contains(err.Error(), "-read-timeout") {
+		t.Errorf("expected an error naming the flag, got: %v", err)
+	}
+	if _, err := Load(nil, envFrom(map[string]string{"RECEIPT_BATCH_LIMIT": "many"}), io.Discard); err == nil || !strings.Contains(err.Error(), "RECEIPT_BATCH_LIMIT") {
+		t.Errorf("expected an error naming the variable, got: %v", err)
+	}
+	if _, err := Load([]string{"-unknown"}, envFrom(nil), io.Discard); err == nil {
+		t.Errorf("expected an error for an unknown flag")
+	}
+	if _, err := Load([]string{"-config", "config.toml"}, envFrom(nil), io.Discard); err == nil {
+		t.Errorf("expected an error for a missing config file")
+	}
+}
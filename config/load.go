@@ -0,0 +1,150 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// setting is one value that can be overridden by an environment variable and a flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+// settings lists every overridable value, in the order shown by -h.
+var settings = []setting{
+	{"listen", "RECEIPT_LISTEN_ADDR", "address to listen on", func(c *Config, v string) error { c.ListenAddr = v; return nil }},
+	{"store", "RECEIPT_STORE", "storage backend: memory or sqlite", func(c *Config, v string) error { c.Store.Backend = v; return nil }},
+	{"dsn", "RECEIPT_STORE_DSN", "database path for the sqlite backend", func(c *Config, v string) error { c.Store.DSN = v; return nil }},
+	{"log-level", "RECEIPT_LOG_LEVEL", "log level: debug, info, warn or error", func(c *Config, v string) error { c.Log.Level = v; return nil }},
+	{"log-format", "RECEIPT_LOG_FORMAT", "log format: text or json", func(c *Config, v string) error { c.Log.Format = v; return nil }},
+	{"max-body-bytes", "RECEIPT_MAX_BODY_BYTES", "largest request body for single-receipt endpoints", intSetter(func(c *Config) *int64 { return &c.Limits.MaxBodyBytes })},
+	{"max-batch-body-bytes", "RECEIPT_MAX_BATCH_BODY_BYTES", "largest request body for batch submissions", intSetter(func(c *Config) *int64 { return &c.Limits.MaxBatchBodyBytes })},
+	{"batch-limit", "RECEIPT_BATCH_LIMIT", "most receipts accepted in one batch", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.Limits.BatchSize = n
+		return nil
+	}},
+	{"read-timeout", "RECEIPT_READ_TIMEOUT", "time allowed to read a request", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Read })},
+	{"write-timeout", "RECEIPT_WRITE_TIMEOUT", "time allowed to write a response", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Write })},
+	{"idle-timeout", "RECEIPT_IDLE_TIMEOUT", "time an idle keep-alive connection is kept", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Idle })},
+	{"handler-timeout", "RECEIPT_HANDLER_TIMEOUT", "time allowed to process a request, 0 for no limit", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Handler })},
+	{"shutdown-timeout", "RECEIPT_SHUTDOWN_TIMEOUT", "time allowed to drain in-flight requests on shutdown", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Shutdown })},
+	{"drain-timeout", "RECEIPT_DRAIN_TIMEOUT", "time readiness fails before shutdown starts", durationSetter(func(c *Config) *Duration { return &c.Timeouts.Drain })},
+	{"rules", "RECEIPT_RULES_FILE", "points rules file", func(c *Config, v string) error { c.RulesFile = v; return nil }},
+	{"consistency-mode", "RECEIPT_CONSISTENCY_MODE", "consistency checks: strict or lenient", func(c *Config, v string) error { c.Consistency.Mode = v; return nil }},
+	{"consistency-tolerance", "RECEIPT_CONSISTENCY_TOLERANCE", "allowed difference between the total and the item prices", func(c *Config, v string) error { c.Consistency.Tolerance = v; return nil }},
+	{"idempotency-window", "RECEIPT_IDEMPOTENCY_WINDOW", "how long an Idempotency-Key replays its response", durationSetter(func(c *Config) *Duration { return &c.IdempotencyWindow })},
+	{"allow-duplicates", "RECEIPT_ALLOW_DUPLICATES", "store receipts with the same content as a stored receipt: true or false", boolSetter(func(c *Config) *bool { return &c.AllowDuplicates })},
+	{"auth-api-keys", "RECEIPT_AUTH_API_KEYS", "require an X-API-Key on the receipt endpoints: true or false", boolSetter(func(c *Config) *bool { return &c.Auth.APIKeys })},
+	{"auth-jwks-file", "RECEIPT_AUTH_JWKS_FILE", "require a bearer token signed by a key in this JWKS file", func(c *Config, v string) error { c.Auth.JWKSFile = v; return nil }},
+	{"auth-jwt-issuer", "RECEIPT_AUTH_JWT_ISSUER", "required issuer of bearer tokens", func(c *Config, v string) error { c.Auth.JWTIssuer = v; return nil }},
+	{"auth-jwt-audience", "RECEIPT_AUTH_JWT_AUDIENCE", "required audience of bearer tokens", func(c *Config, v string) error { c.Auth.JWTAudience = v; return nil }},
+	{"points-expire-after", "RECEIPT_POINTS_EXPIRE_AFTER", "age at which earned points expire, 0 to keep them forever", durationSetter(func(c *Config) *Duration { return &c.Points.ExpireAfter })},
+	{"points-expiry-interval", "RECEIPT_POINTS_EXPIRY_INTERVAL", "how often expired points are looked for", durationSetter(func(c *Config) *Duration { return &c.Points.ExpiryInterval })},
+	{"points-expiring-soon", "RECEIPT_POINTS_EXPIRING_SOON", "how far ahead the expiring points of a user are listed", durationSetter(func(c *Config) *Duration { return &c.Points.ExpiringSoon })},
+	{"auth-jwt-user-claim", "RECEIPT_AUTH_JWT_USER_CLAIM", "bearer token claim holding the user ID", func(c *Config, v string) error { c.Auth.JWTUserClaim = v; return nil }},
+	{"auth-jwks-refresh", "RECEIPT_AUTH_JWKS_REFRESH", "how often the JWKS file is checked for changes, 0 to reload only on SIGHUP", durationSetter(func(c *Config) *Duration { return &c.Auth.JWKSRefresh })},
+}
+
+// Load builds the configuration from the defaults, the config file, the environment
+// and the command-line arguments, in increasing order of precedence, and validates it.
+// The config file is named by the -config flag or the RECEIPT_CONFIG_FILE variable.
+func Load(args []string, getenv func(string) string, usageOut io.Writer) (Config, error) {
+	fs := flag.NewFlagSet("receipt-api", flag.ContinueOnError)
+	fs.SetOutput(usageOut)
+	file := fs.String("config", "", "YAML or JSON config file (default $"+FileEnv+")")
+
+	// Flags are applied after the file and the environment, so only record them here
+	var overrides []func(*Config) error
+	for _, s := range settings {
+		s := s
+		fs.Func(s.flag, s.usage+" ($"+s.env+")", func(value string) error {
+			overrides = append(overrides, func(c *Config) error {
+				if err := s.set(c, value); err != nil {
+					return fmt.Errorf("invalid -%s: %w", s.flag, err)
+				}
+				return nil
+			})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := LoadEnv(*file, getenv)
+	if err != nil {
+		return Config{}, err
+	}
+	for _, override := range overrides {
+		if err := override(&cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// LoadEnv layers the config file and the RECEIPT_* environment variables over the
+// defaults, as Load does before applying flags. An empty file falls back to
+// RECEIPT_CONFIG_FILE. The result is not validated, so callers can override more
+// settings first.
+func LoadEnv(file string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+	if file == "" {
+		file = getenv(FileEnv)
+	}
+	if file != "" {
+		if err := LoadFile(file, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// intSetter returns a setter parsing an integer into the field selected by field
+func intSetter(field func(c *Config) *int64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// boolSetter returns a setter parsing a boolean into the field selected by field
+func boolSetter(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// durationSetter returns a setter parsing a duration into the field selected by field
+func durationSetter(field func(c *Config) *Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}
+}
@@ -0,0 +1,69 @@
+// Package expiry expires loyalty points that were not used within a maximum age.
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// Store records expirations in the points ledger. common.ReceiptStore satisfies it.
+type Store interface {
+	ExpirePoints(cutoff, at time.Time) ([]common.LedgerEntry, error)
+}
+
+// Job periodically expires the points earned longer than a maximum age ago.
+// Redemptions consume points first in, first out, so the oldest points held expire first.
+type Job struct {
+	store    Store
+	maxAge   time.Duration
+	interval time.Duration
+	clock    common.Clock
+	log      logger.Logger
+}
+
+// NewJob creates a job expiring points older than maxAge every interval. The clock
+// decides how old points are, so tests can control it.
+func NewJob(store Store, maxAge, interval time.Duration, clock common.Clock, log logger.Logger) *Job {
+	if clock == nil {
+		clock = common.SystemClock{}
+	}
+	if log == nil {
+		log = logger.Default
+	}
+	return &Job{store: store, maxAge: maxAge, interval: interval, clock: clock, log: log}
+}
+
+// RunOnce expires every point earned more than the maximum age ago and returns
+// the expiration entries recorded, one per user.
+func (j *Job) RunOnce() ([]common.LedgerEntry, error) {
+	now := j.clock.Now()
+	entries, err := j.store.ExpirePoints(now.Add(-j.maxAge), now)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		j.log.Info("Points expired", logger.F(logger.KeyUserID, entry.UserID), logger.F("points", -entry.Points), logger.F("balance", entry.Balance))
+	}
+	return entries, nil
+}
+
+// Run calls RunOnce immediately and then every interval until ctx is cancelled.
+// A failed run is logged and retried at the next interval.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.RunOnce(); err != nil {
+			j.log.Error("Error expiring points", logger.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package expiry
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// stepClock is a clock the test moves forward
+type stepClock struct {
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time {
+	return c.now
+}
+
+func TestJobExpiresOldPoints(t *testing.T) {
+	store := common.NewReceiptStorage()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, points := range []int64{100, 40} {
+		id := string(rune('a' + i))
+		receipt := common.Receipt{ID: id, Retailer: "Retailer " + id, PurchaseDate: "2022-12-31", PurchaseTime: "12:00", Total: "1.00", UserID: "alice"}
+		if err := store.AddSubmission(common.Submission{Receipt: receipt, Points: points, At: start.AddDate(0, 0, 10*i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := &stepClock{now: start}
+	job := NewJob(store, 30*24*time.Hour, time.Hour, clock, logger.New(log.New(io.Discard, "", 0)))
+
+	tests := []struct {
+		at      time.Time
+		expired int64
+		balance int64
+	}{
+		{start.AddDate(0, 0, 29), 0, 140},
+		{start.AddDate(0, 0, 30), 100, 40},
+		{start.AddDate(0, 0, 35), 0, 40},
+		{start.AddDate(0, 0, 40), 40, 0},
+	}
+	for _, tt := range tests {
+		clock.now = tt.at
+		entries, err := job.RunOnce()
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.at, err)
+		}
+		var expired int64
+		for _, entry := range entries {
+			expired -= entry.Points
+		}
+		if expired != tt.expired {
+			t.Errorf("%v: expected %d points to expire, got %d", tt.at, tt.expired, expired)
+		}
+		if account, _ := store.GetAccount("alice"); account.Balance != tt.balance {
+			t.Errorf("%v: expected a balance of %d, got %d", tt.at, tt.balance, account.Balance)
+		}
+	}
+
+	entries, _ := store.ListLedgerEntries("alice")
+	if last := entries[len(entries)-1]; last.Type != common.LedgerExpire || !last.CreatedAt.Equal(start.AddDate(0, 0, 40)) {
+		t.Errorf("expected an expiration entry stamped by the clock, got %+v", last)
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		NewJob(common.NewReceiptStorage(), time.Hour, time.Hour, nil, logger.New(log.New(io.Discard, "", 0))).Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return once the context is cancelled")
+	}
+}
@@ -0,0 +1,26 @@
+package logger
+
+import "context"
+
+// contextKey is the key of the fields attached to a context
+type contextKey struct{}
+
+// WithFields returns a copy of ctx carrying fields in addition to those already attached.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	existing := FieldsFromContext(ctx)
+	return context.WithValue(ctx, contextKey{}, append(append([]Field(nil), existing...), fields...))
+}
+
+// FieldsFromContext returns the fields attached to ctx.
+func FieldsFromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+// FromContext returns log adding the fields attached to ctx to every line.
+func FromContext(ctx context.Context, log Logger) Logger {
+	return log.With(FieldsFromContext(ctx)...)
+}
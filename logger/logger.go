@@ -2,21 +2,262 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Level is the minimum severity a logger writes.
+type Level int
+
+// Supported levels, from the most to the least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Supported output formats.
+const (
+	FormatText = "text" // "[INFO] message key=value" lines with a timestamp prefix
+	FormatJSON = "json" // One JSON object per line with time, level, msg and the fields
+)
+
+// Common field keys.
+const (
+	KeyRequestID = "request_id"
+	KeyRoute     = "route"
+	KeyMethod    = "method"
+	KeyReceiptID = "receipt_id"
+	KeyClientID  = "client_id"
+	KeyUserID    = "user_id"
+	KeyStatus    = "status"
+	KeySize      = "size"
+	KeyDuration  = "duration"
+	KeyError     = "error"
+)
+
+// Field is a key/value pair attached to a log line.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F creates a Field.
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates the error Field of err.
+func Err(err error) Field {
+	return Field{Key: KeyError, Value: err.Error()}
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error", case-insensitively.
+func ParseLevel(value string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", value)
+	}
+}
+
+// ParseFormat parses "text" or "json", case-insensitively.
+func ParseFormat(value string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(value)); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q, expected text or json", value)
+	}
+}
+
+// Logger is the logging dependency accepted by the API handlers.
+type Logger interface {
+	Debug(message string, fields ...Field)
+	Info(message string, fields ...Field)
+	Warn(message string, fields ...Field)
+	Error(message string, fields ...Field)
+	LogRequest(method, uri string, start time.Time, fields ...Field)
+	// With returns a Logger adding fields to every line.
+	With(fields ...Field) Logger
+}
+
+// StdLogger writes log lines through a standard library *log.Logger.
+type StdLogger struct {
+	out    *log.Logger
+	level  Level
+	format string
+	fields []Field
+}
+
+// New creates a Logger writing to the given *log.Logger.
+// A nil out uses the standard logger, like the package-level functions.
+func New(out *log.Logger) *StdLogger {
+	if out == nil {
+		out = log.Default()
+	}
+	return &StdLogger{out: out, level: LevelInfo, format: FormatText}
+}
+
+// NewWithOptions creates a Logger writing lines of the given format to w,
+// dropping messages below level.
+func NewWithOptions(w io.Writer, level Level, format string) *StdLogger {
+	flags := log.LstdFlags
+	if format == FormatJSON {
+		flags = 0
+	}
+	return &StdLogger{out: log.New(w, "", flags), level: level, format: format}
+}
+
+// Default is the Logger used when none is injected.
+var Default Logger = New(nil)
+
+// Debug logs diagnostic messages
+func (l *StdLogger) Debug(message string, fields ...Field) {
+	l.write(LevelDebug, message, fields)
+}
+
 // Info logs informational messages
-func Info(message string) {
-	log.Printf("[INFO] %s", message)
+func (l *StdLogger) Info(message string, fields ...Field) {
+	l.write(LevelInfo, message, fields)
+}
+
+// Warn logs unexpected but handled conditions
+func (l *StdLogger) Warn(message string, fields ...Field) {
+	l.write(LevelWarn, message, fields)
+}
+
+// Error logs error messages
+func (l *StdLogger) Error(message string, fields ...Field) {
+	l.write(LevelError, message, fields)
+}
+
+// LogRequest logs the HTTP method, URI, and the time taken to process the request
+func (l *StdLogger) LogRequest(method, uri string, start time.Time, fields ...Field) {
+	elapsed := time.Since(start)
+	fields = append(fields, F(KeyDuration, elapsed.String()))
+	l.write(LevelInfo, fmt.Sprintf("%s %s completed in %v", method, uri, elapsed), fields)
+}
+
+// With returns a copy of the logger adding fields to every line
+func (l *StdLogger) With(fields ...Field) Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	child := *l
+	child.fields = append(append([]Field(nil), l.fields...), fields...)
+	return &child
+}
+
+// write formats and writes one message if its level is enabled
+func (l *StdLogger) write(level Level, message string, fields []Field) {
+	if level < l.level {
+		return
+	}
+	if len(l.fields) > 0 {
+		fields = append(append([]Field(nil), l.fields...), fields...)
+	}
+	if l.format == FormatJSON {
+		l.out.Print(formatJSON(level, message, fields))
+		return
+	}
+	l.out.Print(formatText(level, message, fields))
+}
+
+// formatJSON returns a JSON object with time, level, msg and the fields, in order
+func formatJSON(level Level, message string, fields []Field) string {
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeJSON(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeJSON(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeJSON(&line, message)
+	for _, field := range fields {
+		line.WriteByte(',')
+		writeJSON(&line, field.Key)
+		line.WriteByte(':')
+		writeJSON(&line, field.Value)
+	}
+	line.WriteByte('}')
+	return line.String()
+}
+
+// writeJSON writes the JSON encoding of value, or of its string form if it has none
+func writeJSON(buf *bytes.Buffer, value any) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
+
+// formatText returns "[LEVEL] message key=value ...", quoting values that need it
+func formatText(level Level, message string, fields []Field) string {
+	var line strings.Builder
+	line.WriteString("[" + strings.ToUpper(level.String()) + "] " + message)
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		line.WriteString(" " + field.Key + "=" + value)
+	}
+	return line.String()
+}
+
+// String returns the lowercase name of the level.
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Debug logs diagnostic messages
+func Debug(message string, fields ...Field) {
+	Default.Debug(message, fields...)
+}
+
+// Info logs informational messages
+func Info(message string, fields ...Field) {
+	Default.Info(message, fields...)
+}
+
+// Warn logs unexpected but handled conditions
+func Warn(message string, fields ...Field) {
+	Default.Warn(message, fields...)
 }
 
 // Error logs error messages
-func Error(message string) {
-	log.Printf("[ERROR] %s", message)
+func Error(message string, fields ...Field) {
+	Default.Error(message, fields...)
 }
 
 // LogRequest logs the HTTP method, URI, and the time taken to process the request
-func LogRequest(method, uri string, start time.Time) {
-	log.Printf("[INFO] %s %s completed in %v", method, uri, time.Since(start))
+func LogRequest(method, uri string, start time.Time, fields ...Field) {
+	Default.LogRequest(method, uri, start, fields...)
 }
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"strings"
 	"testing"
@@ -41,3 +42,83 @@ func TestLogRequest(t *testing.T) {
 		t.Errorf("expected log to contain '[INFO] GET /test completed', got %s", buf.String())
 	}
 }
+
+func TestNewLoggerIsolated(t *testing.T) {
+	var shared, own bytes.Buffer
+	log.SetOutput(&shared)
+
+	l := New(log.New(&own, "", 0))
+	l.Info("isolated message")
+
+	if !strings.Contains(own.String(), "[INFO] isolated message") {
+		t.Errorf("expected injected logger output, got %s", own.String())
+	}
+	if shared.Len() != 0 {
+		t.Errorf("expected nothing on the standard logger, got %s", shared.String())
+	}
+}
+
+func TestLevelAndJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithOptions(&buf, LevelError, FormatJSON)
+
+	l.Info("dropped message")
+	l.Error("kept message")
+
+	output := buf.String()
+	if strings.Contains(output, "dropped message") {
+		t.Errorf("expected info messages below the level to be dropped, got %s", output)
+	}
+	if !strings.Contains(output, `"level":"error","msg":"kept message"`) {
+		t.Errorf("expected a JSON error line, got %s", output)
+	}
+}
+
+func TestParseLevelAndFormat(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != LevelWarn {
+		t.Errorf("expected warn, got %v (%v)", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+	if format, err := ParseFormat("JSON"); err != nil || format != FormatJSON {
+		t.Errorf("expected json, got %q (%v)", format, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestFieldsInTextAndJSON(t *testing.T) {
+	var text, structured bytes.Buffer
+	NewWithOptions(&text, LevelInfo, FormatText).With(F(KeyRequestID, "abc")).Warn("slow request", F(KeyStatus, 200), F("path", "/a b"))
+	NewWithOptions(&structured, LevelInfo, FormatJSON).With(F(KeyRequestID, "abc")).Warn("slow request", F(KeyStatus, 200))
+
+	if !strings.Contains(text.String(), `[WARN] slow request request_id=abc status=200 path="/a b"`) {
+		t.Errorf("expected text fields, got %s", text.String())
+	}
+	if !strings.Contains(structured.String(), `"level":"warn","msg":"slow request","request_id":"abc","status":200}`) {
+		t.Errorf("expected JSON fields, got %s", structured.String())
+	}
+}
+
+func TestDebugDroppedAtInfo(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithOptions(&buf, LevelInfo, FormatText)
+	l.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("expected debug messages to be dropped, got %s", buf.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithFields(context.Background(), F(KeyRoute, "/receipts/{id}"))
+	ctx = WithFields(ctx, F(KeyReceiptID, "42"))
+
+	FromContext(ctx, New(log.New(&buf, "", 0))).Info("found")
+
+	if !strings.Contains(buf.String(), "[INFO] found route=/receipts/{id} receipt_id=42") {
+		t.Errorf("expected context fields, got %s", buf.String())
+	}
+}
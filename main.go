@@ -1,46 +1,565 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ethirajmudhaliar/GH-risk-api/auth"
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/config"
+	"github.com/ethirajmudhaliar/GH-risk-api/expiry"
 	"github.com/ethirajmudhaliar/GH-risk-api/logger"
 	v1 "github.com/ethirajmudhaliar/GH-risk-api/receipt/v1"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
+// Build information, set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc123"
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildCommit returns the commit set at build time, or the VCS revision
+// recorded by the Go toolchain
+func buildCommit() string {
+	if commit != "" {
+		return commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// RequestIDMiddleware reuses the X-Request-ID of the request, or generates one, and
+// attaches it to the request context, the log fields and the response header
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(common.RequestIDHeader)
+		if !common.ValidRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		ctx := common.WithRequestID(r.Context(), id)
+		ctx = logger.WithFields(ctx, logger.F(logger.KeyRequestID, id))
+		w.Header().Set(common.RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // LoggingMiddleware logs details about incoming HTTP requests
 func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		logger.Info("Started " + r.Method + " " + r.RequestURI)
+	return NewLoggingMiddleware(logger.Default)(next)
+}
 
-		next.ServeHTTP(w, r)
+// NewLoggingMiddleware returns a middleware that logs requests to the given logger
+func NewLoggingMiddleware(log logger.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r = r.WithContext(logger.WithFields(r.Context(), logger.F(logger.KeyRoute, routeTemplate(r)), logger.F(logger.KeyMethod, r.Method)))
+			requestLog := logger.FromContext(r.Context(), log)
+			requestLog.Info("Started " + r.Method + " " + r.RequestURI)
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			requestLog.LogRequest(r.Method, r.RequestURI, start, logger.F(logger.KeyStatus, rec.statusCode()), logger.F(logger.KeySize, rec.size))
+		})
+	}
+}
+
+// statusRecorder captures the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// statusCode returns the recorded status, 200 when the handler wrote nothing
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// routeKey is the context key of the route template resolved by WithRoute
+type routeKey struct{}
 
-		logger.LogRequest(r.Method, r.RequestURI, start)
+// unmatchedRoute is the route of requests the router answers with 404 or 405, so
+// their paths, chosen by clients, never become label values
+const unmatchedRoute = "unmatched"
+
+// metricsMethods are the HTTP methods recorded as themselves in metrics
+var metricsMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// metricsMethod returns the method label of a request. Any method is accepted on
+// the wire, so those outside metricsMethods are recorded as "other" to keep the
+// number of time series bounded.
+func metricsMethod(method string) string {
+	if metricsMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+// WithRoute resolves the template of the route in router matching each request
+// before passing it to next. Middleware wrapping the router run before it matches
+// the request, so this is how they learn the route.
+func WithRoute(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if t, err := match.Route.GetPathTemplate(); err == nil {
+				template = t
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, template)))
 	})
 }
 
-func SetupRouter() *mux.Router {
+// routeTemplate returns the template of the route matching r, such as "/receipts/{id}"
+func routeTemplate(r *http.Request) string {
+	if template, ok := r.Context().Value(routeKey{}).(string); ok {
+		return template
+	}
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return unmatchedRoute
+}
+
+// NewMetricsMiddleware returns a middleware that records the count and latency
+// of requests by route template, method and status
+func NewMetricsMiddleware(m *v1.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			m.ObserveRequest(routeTemplate(r), metricsMethod(r.Method), rec.statusCode(), time.Since(start))
+		})
+	}
+}
+
+// newAuthenticator builds the authenticator selected by cfg, or nil when the
+// receipt endpoints are open. API keys and bearer tokens are both accepted
+// when both are configured. It also returns the key set verifying bearer
+// tokens, if any, so it can be reloaded.
+func newAuthenticator(cfg config.Config, store auth.APIKeyStore) (auth.Authenticator, *auth.JWKS, error) {
+	var chain auth.Chain
+	if cfg.Auth.APIKeys {
+		chain = append(chain, auth.NewAPIKeys(store))
+	}
+	var keys *auth.JWKS
+	if cfg.Auth.JWKSFile != "" {
+		var err error
+		if keys, err = auth.LoadJWKS(cfg.Auth.JWKSFile); err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, auth.NewJWT(keys, auth.JWTOptions{
+			Issuer:    cfg.Auth.JWTIssuer,
+			Audience:  cfg.Auth.JWTAudience,
+			UserClaim: cfg.Auth.JWTUserClaim,
+		}, common.SystemClock{}))
+	}
+
+	switch len(chain) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return chain[0], keys, nil
+	}
+	return chain, keys, nil
+}
+
+// reloadOnHangup reloads the key set whenever the process receives SIGHUP, until
+// ctx is cancelled. A key set that fails to load keeps the previous keys.
+func reloadOnHangup(ctx context.Context, keys *auth.JWKS, log logger.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		if err := keys.Reload(); err != nil {
+			log.Error("Error reloading JWKS, keeping the previous keys", logger.Err(err))
+			continue
+		}
+		log.Info("Reloaded JWKS")
+	}
+}
+
+// SetupRouter wires the receipt handlers of the given server into a router
+// applying the request settings of cfg, and wraps it in the request ID, logging,
+// metrics and timeout middleware. The receipt routes are open when authenticator
+// is nil. Handlers are counted in requests unless it is nil.
+func SetupRouter(server *v1.Server, cfg config.Config, authenticator auth.Authenticator, requests *InFlight, log logger.Logger) http.Handler {
 	router := mux.NewRouter()
 
+	// Probes for the orchestrator
+	router.HandleFunc("/healthz", server.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", server.Readyz).Methods("GET")
+	router.HandleFunc("/version", server.Version).Methods("GET")
+	router.Handle("/metrics", server.Metrics().Handler()).Methods("GET")
+
+	// Receipt routes require credentials granting their scope when authentication is on
+	protect := func(scope string, handler http.HandlerFunc) http.Handler {
+		if authenticator == nil {
+			return handler
+		}
+		return auth.Require(authenticator, scope, log, handler)
+	}
+
 	// Define the routes for the Receipt Processor API
-	router.HandleFunc("/receipts/process", v1.SubmitReceipt).Methods("POST")
-	router.HandleFunc("/receipts/{id}/points", v1.GetReceiptPoints).Methods("GET")
+	router.Handle("/receipts", protect(common.ScopeReceiptsRead, server.ListReceipts)).Methods("GET")
+	router.Handle("/receipts/process", protect(common.ScopeReceiptsWrite, server.SubmitReceipt)).Methods("POST")
+	router.Handle("/receipts/batch", protect(common.ScopeReceiptsWrite, server.SubmitBatch)).Methods("POST")
+	router.Handle("/receipts/preview", protect(common.ScopeReceiptsRead, server.PreviewReceipt)).Methods("POST")
+	router.Handle("/receipts/{id}", protect(common.ScopeReceiptsRead, server.GetReceipt)).Methods("GET")
+	router.Handle("/receipts/{id}", protect(common.ScopeReceiptsWrite, server.ReplaceReceipt)).Methods("PUT")
+	router.Handle("/receipts/{id}", protect(common.ScopeReceiptsWrite, server.PatchReceipt)).Methods("PATCH")
+	router.Handle("/receipts/{id}", protect(common.ScopeReceiptsWrite, server.DeleteReceipt)).Methods("DELETE")
+	router.Handle("/receipts/{id}/points", protect(common.ScopeReceiptsRead, server.GetReceiptPoints)).Methods("GET")
+	router.Handle("/receipts/{id}/points/breakdown", protect(common.ScopeReceiptsRead, server.GetReceiptPointsBreakdown)).Methods("GET")
+	router.Handle("/users/{id}/balance", protect(common.ScopeReceiptsRead, server.GetUserBalance)).Methods("GET")
+	router.Handle("/users/{id}/ledger", protect(common.ScopeReceiptsRead, server.GetUserLedger)).Methods("GET")
+	router.Handle("/users/{id}/expiring", protect(common.ScopeReceiptsRead, server.GetUserExpiringPoints)).Methods("GET")
+
+	// Spending and taking back points needs to know who asks, so those routes only
+	// exist when authentication is on
+	if authenticator != nil {
+		router.Handle("/users/{id}/redemptions", protect(common.ScopeReceiptsWrite, server.RedeemPoints)).Methods("POST")
+		router.Handle("/receipts/{id}/reversal", protect(common.ScopePointsAdmin, server.ReverseReceiptPoints)).Methods("POST")
+	}
 
-	// Add the logging middleware
-	router.Use(LoggingMiddleware)
+	// Count handlers innermost: the timeout middleware returns without waiting for them
+	if requests != nil {
+		router.Use(requests.Track)
+	}
+
+	// Wrap the router rather than use router.Use, so requests matching no route,
+	// answered 404 or 405 by the router itself, get the middleware too
+	var handler http.Handler = router
+	if handlerTimeout := time.Duration(cfg.Timeouts.Handler); handlerTimeout > 0 {
+		handler = NewTimeoutMiddleware(handlerTimeout)(handler)
+	}
+	handler = NewMetricsMiddleware(server.Metrics())(handler)
+	handler = NewLoggingMiddleware(log)(handler)
+	handler = RequestIDMiddleware(handler)
+	return WithRoute(router, handler)
+}
+
+// NewTimeoutMiddleware returns a middleware that answers 503 Service Unavailable
+// when a request takes longer than timeout to process
+func NewTimeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		// The timeout handler gives next a fresh header map, so set the request ID
+		// again for error responses to pick it up
+		withRequestID := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := common.RequestIDFromContext(r.Context()); id != "" {
+				w.Header().Set(common.RequestIDHeader, id)
+			}
+			next.ServeHTTP(w, r)
+		})
+		return http.TimeoutHandler(withRequestID, timeout, `{"success":false,"error":"Request timed out"}`)
+	}
+}
+
+// InFlight counts the handlers still running. Neither http.Server.Close nor the
+// timeout middleware waits for handlers to return, so shutdown waits on it before
+// closing the store they use.
+type InFlight struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	running int
+}
+
+// NewInFlight returns a counter with no handlers running.
+func NewInFlight() *InFlight {
+	f := &InFlight{}
+	f.idle = sync.NewCond(&f.mu)
+	return f
+}
+
+// Track counts next as running while it serves a request.
+func (f *InFlight) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.running++
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			if f.running--; f.running == 0 {
+				f.idle.Broadcast()
+			}
+			f.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
 
-	return router
+// Running returns the number of handlers running.
+func (f *InFlight) Running() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
+}
+
+// Wait returns once no handler is running.
+func (f *InFlight) Wait() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.running > 0 {
+		f.idle.Wait()
+	}
+}
+
+// serverOptions converts the handler settings of cfg into server options
+func serverOptions(cfg config.Config) ([]v1.Option, error) {
+	consistency, err := cfg.ConsistencyOptions()
+	if err != nil {
+		return nil, err
+	}
+	return []v1.Option{
+		v1.WithConsistency(consistency),
+		v1.WithIdempotencyWindow(time.Duration(cfg.IdempotencyWindow)),
+		v1.WithDuplicates(cfg.AllowDuplicates),
+		v1.WithBatchLimit(cfg.Limits.BatchSize),
+		v1.WithBodyLimits(cfg.Limits.MaxBodyBytes, cfg.Limits.MaxBatchBodyBytes),
+		v1.WithPointsExpiry(time.Duration(cfg.Points.ExpireAfter), time.Duration(cfg.Points.ExpiringSoon)),
+	}, nil
 }
 
 func main() {
-	router := SetupRouter()
+	// Load the settings from the defaults, RECEIPT_CONFIG_FILE or -config, RECEIPT_* variables and flags
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.Error("Error loading configuration: " + err.Error())
+		os.Exit(1)
+	}
+
+	level, _ := cfg.LogLevel()
+	log := logger.Logger(logger.NewWithOptions(os.Stderr, level, cfg.Log.Format))
+	logger.Default = log
+
+	store, err := common.OpenStore(cfg.Store.Backend, cfg.Store.DSN)
+	if err != nil {
+		log.Error("Error opening receipt store", logger.Err(err))
+		os.Exit(1)
+	}
+
+	// Load the points rules; the standard rules are used when no file is configured
+	engine, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		log.Error("Error loading points rules", logger.Err(err))
+		store.Close()
+		os.Exit(1)
+	}
+	log.Info("Loaded points rules", logger.F("rules_version", engine.Version()))
 
-	logger.Info("Starting server on port 8080")
+	opts, err := serverOptions(cfg)
+	if err != nil {
+		log.Error("Error configuring server", logger.Err(err))
+		store.Close()
+		os.Exit(1)
+	}
+	opts = append(opts, v1.WithBuildInfo(version, buildCommit()))
+	server := v1.NewServer(store, engine, log, common.SystemClock{}, opts...)
+	server.Metrics().Registry().MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	authenticator, keys, err := newAuthenticator(cfg, store)
+	if err != nil {
+		log.Error("Error configuring authentication", logger.Err(err))
+		store.Close()
+		os.Exit(1)
+	}
+	requests := NewInFlight()
+	router := SetupRouter(server, cfg, authenticator, requests, log)
 
-	err := http.ListenAndServe(":8080", router)
+	httpServer := &http.Server{
+		Handler:      router,
+		ReadTimeout:  time.Duration(cfg.Timeouts.Read),
+		WriteTimeout: time.Duration(cfg.Timeouts.Write),
+		IdleTimeout:  time.Duration(cfg.Timeouts.Idle),
+	}
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
 	if err != nil {
-		logger.Error("Error starting server: " + err.Error())
+		log.Error("Error starting server", logger.Err(err))
+		store.Close()
+		os.Exit(1)
+	}
+
+	// Stop on SIGINT or SIGTERM, letting in-flight requests finish. The signals are
+	// released after the first one, so a second one kills the process at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Pick up rotated signing keys when the file changes, or at once on SIGHUP
+	if keys != nil {
+		go reloadOnHangup(ctx, keys, log)
+		if refresh := time.Duration(cfg.Auth.JWKSRefresh); refresh > 0 {
+			go keys.Watch(ctx, refresh, log)
+		}
+	}
+
+	// Expire old points in the background; the store stays open until the job stops
+	jobDone := make(chan struct{})
+	if maxAge := time.Duration(cfg.Points.ExpireAfter); maxAge > 0 {
+		job := expiry.NewJob(store, maxAge, time.Duration(cfg.Points.ExpiryInterval), common.SystemClock{}, log)
+		go func() {
+			defer close(jobDone)
+			job.Run(ctx)
+		}()
+	} else {
+		close(jobDone)
 	}
+
+	log.Info("Starting server", logger.F("addr", listener.Addr().String()))
+	// Fail readiness first, so load balancers stop routing traffic before connections are refused
+	shutdown := shutdownPolicy{
+		drain:    func() { server.SetDraining(true) },
+		grace:    time.Duration(cfg.Timeouts.Drain),
+		timeout:  time.Duration(cfg.Timeouts.Shutdown),
+		handlers: requests,
+	}
+	if err := serve(ctx, httpServer, listener, closeAfter{store, jobDone}, shutdown, log); err != nil {
+		log.Error("Error running server", logger.Err(err))
+		os.Exit(1)
+	}
+}
+
+// closeAfter closes an io.Closer once done is closed, so background jobs finish
+// before the store they use is closed
+type closeAfter struct {
+	io.Closer
+	done <-chan struct{}
+}
+
+// Close waits for done, then closes the wrapped Closer.
+func (c closeAfter) Close() error {
+	<-c.done
+	return c.Closer.Close()
+}
+
+// shutdownPolicy controls how serve stops once its context is cancelled
+type shutdownPolicy struct {
+	drain    func()        // Called first, so readiness starts failing; may be nil
+	grace    time.Duration // Time for load balancers to stop routing traffic before connections are refused
+	timeout  time.Duration // Time in-flight requests get to finish
+	handlers *InFlight     // Handlers to wait for before closing the store, even past the timeout; may be nil
+}
+
+// serve runs httpServer on listener until ctx is cancelled. It then drains: readiness
+// fails for the grace period while requests are still served, then the server stops
+// accepting connections and waits up to the shutdown timeout for in-flight requests
+// to finish before closing the remaining connections. The store is closed once the
+// last handler returns.
+func serve(ctx context.Context, httpServer *http.Server, listener net.Listener, store io.Closer, shutdown shutdownPolicy, log logger.Logger) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// The server failed on its own; there is nothing left to drain
+	case <-ctx.Done():
+		if shutdown.drain != nil {
+			shutdown.drain()
+		}
+		if shutdown.grace > 0 {
+			log.Info("Draining, failing readiness before shutdown", logger.F("grace", shutdown.grace.String()))
+			time.Sleep(shutdown.grace)
+		}
+		log.Info("Shutting down, draining in-flight requests", logger.F("timeout", shutdown.timeout.String()))
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdown.timeout)
+		defer cancel()
+		if err = httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Warn("Shutdown deadline exceeded, closing remaining connections", logger.Err(err))
+			httpServer.Close()
+		} else {
+			log.Info("All in-flight requests completed")
+		}
+		<-serveErr
+
+		// Closing the connections does not stop their handlers, which may still use the store
+		if shutdown.handlers != nil {
+			if running := shutdown.handlers.Running(); running > 0 {
+				log.Warn("Waiting for handlers to return before closing the store", logger.F("handlers", running))
+			}
+			shutdown.handlers.Wait()
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	if closeErr := store.Close(); closeErr != nil {
+		log.Error("Error closing receipt store", logger.Err(closeErr))
+		if err == nil {
+			err = closeErr
+		}
+	} else {
+		log.Info("Receipt store closed")
+	}
+
+	log.Info("Server stopped")
+	return err
 }
@@ -2,13 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/config"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
 	v1 "github.com/ethirajmudhaliar/GH-risk-api/receipt/v1"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -33,10 +44,11 @@ func TestLoggingMiddleware(t *testing.T) {
 }
 
 func TestRoutes(t *testing.T) {
+	server := v1.NewServer(nil, nil, nil, nil)
 	router := mux.NewRouter()
 
-	router.HandleFunc("/receipts/process", v1.SubmitReceipt).Methods("POST")
-	router.HandleFunc("/receipts/{id}/points", v1.GetReceiptPoints).Methods("GET")
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}/points", server.GetReceiptPoints).Methods("GET")
 
 	req, err := http.NewRequest("GET", "/receipts/non-existent-id/points", nil)
 	if err != nil {
@@ -52,8 +64,9 @@ func TestRoutes(t *testing.T) {
 }
 
 func TestCreateRiskRoute(t *testing.T) {
+	server := v1.NewServer(nil, nil, nil, nil)
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/risks", v1.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/v1/risks", server.SubmitReceipt).Methods("POST")
 
 	req, err := http.NewRequest("POST", "/v1/risks", http.NoBody)
 	if err != nil {
@@ -69,13 +82,7 @@ func TestCreateRiskRoute(t *testing.T) {
 }
 
 func TestSetupRouter(t *testing.T) {
-	router := SetupRouter()
-
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
-	}
+	router := SetupRouter(v1.NewServer(nil, nil, nil, nil), config.Default(), nil, nil, logger.Default)
 
 	tests := []struct {
 		method      string
@@ -85,6 +92,12 @@ func TestSetupRouter(t *testing.T) {
 		description string
 	}{
 		{"GET", "/receipts/non-existent-id/points", nil, http.StatusNotFound, "Get receipt points for non-existent receipt"},
+		{"GET", "/healthz", nil, http.StatusOK, "Liveness probe"},
+		{"GET", "/readyz", nil, http.StatusOK, "Readiness probe"},
+		{"GET", "/version", nil, http.StatusOK, "Build information"},
+		{"GET", "/users/nobody/balance", nil, http.StatusNotFound, "Balance of a user without an account"},
+		{"POST", "/users/nobody/redemptions", []byte(`{"points": 10}`), http.StatusNotFound, "Redemptions need authentication"},
+		{"POST", "/receipts/non-existent-id/reversal", []byte(`{"reason": "fraud"}`), http.StatusNotFound, "Reversals need authentication"},
 		{"POST", "/receipts/process", []byte(`{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "50.00"}]}`), http.StatusCreated, "Submit a receipt"},
 	}
 
@@ -102,3 +115,263 @@ func TestSetupRouter(t *testing.T) {
 		}
 	}
 }
+
+// closeRecorder records whether the store was closed
+type closeRecorder struct {
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// Helper function to run serve with a handler that blocks until release is closed,
+// returning once a request is in flight. Requests to /ready return at once.
+func startServe(t *testing.T, shutdown shutdownPolicy, release chan struct{}) (cancel func(), requestDone, serveDone chan error, store *closeRecorder, addr string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	var once sync.Once
+	shutdown.handlers = NewInFlight()
+	httpServer := &http.Server{Handler: shutdown.handlers.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		once.Do(func() { close(started) })
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store = &closeRecorder{}
+	serveDone = make(chan error, 1)
+	go func() {
+		serveDone <- serve(ctx, httpServer, listener, store, shutdown, logger.New(log.New(io.Discard, "", 0)))
+	}()
+
+	requestDone = make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestDone <- err
+	}()
+	<-started
+	return cancel, requestDone, serveDone, store, listener.Addr().String()
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	cancel, requestDone, serveDone, store, _ := startServe(t, shutdownPolicy{timeout: 5 * time.Second}, release)
+
+	// Shut down while the request is in flight, then let it finish
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-requestDone; err != nil {
+		t.Errorf("expected the in-flight request to complete, got: %v", err)
+	}
+	if err := <-serveDone; err != nil {
+		t.Errorf("expected a clean shutdown, got: %v", err)
+	}
+	if !store.closed {
+		t.Errorf("expected the store to be closed")
+	}
+}
+
+func TestServeDrainsBeforeShutdown(t *testing.T) {
+	release := make(chan struct{})
+	var draining atomic.Bool
+	shutdown := shutdownPolicy{drain: func() { draining.Store(true) }, grace: 200 * time.Millisecond, timeout: 5 * time.Second}
+	cancel, requestDone, serveDone, _, addr := startServe(t, shutdown, release)
+
+	// During the grace period readiness fails, but new connections are still served
+	cancel()
+	for !draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	resp, err := http.Get("http://" + addr + "/ready")
+	if err != nil {
+		t.Fatalf("expected requests to be served while draining, got: %v", err)
+	}
+	resp.Body.Close()
+
+	close(release)
+	if err := <-requestDone; err != nil {
+		t.Errorf("expected the in-flight request to complete, got: %v", err)
+	}
+	if err := <-serveDone; err != nil {
+		t.Errorf("expected a clean shutdown, got: %v", err)
+	}
+}
+
+func TestServeShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	cancel, _, serveDone, store, _ := startServe(t, shutdownPolicy{timeout: 50 * time.Millisecond}, release)
+
+	// The connection is closed at the deadline, but the store stays open while the handler runs
+	cancel()
+	select {
+	case <-serveDone:
+		t.Fatal("expected serve to wait for the running handler")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-serveDone:
+		if err == nil {
+			t.Errorf("expected the shutdown deadline to be reported")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected serve to return once the handler returned")
+	}
+	if !store.closed {
+		t.Errorf("expected the store to be closed")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server := v1.NewServer(nil, nil, nil, nil)
+	router := SetupRouter(server, config.Default(), nil, nil, logger.New(log.New(io.Discard, "", 0)))
+
+	for _, url := range []string{"/receipts/missing/points", "/receipts/other/points", "/metrics", "/no/such/route"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/metrics", nil))
+	for _, method := range []string{"BREW", "WHEN"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/receipts/"+method, nil))
+	}
+
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+	expected := `
+# HELP receipt_api_http_requests_total HTTP requests handled, by route, method and status.
+# TYPE receipt_api_http_requests_total counter
+receipt_api_http_requests_total{method="DELETE",route="unmatched",status="405"} 1
+receipt_api_http_requests_total{method="GET",route="/metrics",status="200"} 1
+receipt_api_http_requests_total{method="GET",route="/receipts/{id}/points",status="404"} 2
+receipt_api_http_requests_total{method="GET",route="unmatched",status="404"} 1
+receipt_api_http_requests_total{method="other",route="unmatched",status="405"} 2
+`
+	if err := testutil.ScrapeAndCompare(httpServer.URL+"/metrics", strings.NewReader(expected), "receipt_api_http_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoggingMiddlewareLogsStatusAndSize(t *testing.T) {
+	var buf bytes.Buffer
+	router := mux.NewRouter()
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}).Methods("GET")
+	router.Use(NewLoggingMiddleware(logger.NewWithOptions(&buf, logger.LevelInfo, logger.FormatJSON)))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/7", nil))
+
+	output := buf.String()
+	for _, want := range []string{`"route":"/items/{id}"`, `"method":"GET"`, `"status":418`, `"size":15`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected log to contain %s, got %s", want, output)
+		}
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.Default()
+	cfg.Timeouts.Handler = config.Duration(time.Second)
+	server := v1.NewServer(nil, nil, logger.NewWithOptions(&buf, logger.LevelInfo, logger.FormatText), nil)
+	router := SetupRouter(server, cfg, nil, nil, logger.NewWithOptions(&buf, logger.LevelInfo, logger.FormatText))
+
+	req := httptest.NewRequest("GET", "/receipts/missing", nil)
+	req.Header.Set("X-Request-ID", "client-chosen-id")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Request-ID"); got != "client-chosen-id" {
+		t.Errorf("expected the request ID to be echoed, got %q", got)
+	}
+	if !strings.Contains(rr.Body.String(), `"requestId":"client-chosen-id"`) {
+		t.Errorf("expected the request ID in the error body, got %s", rr.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected start, handler and completion log lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=client-chosen-id") {
+			t.Errorf("expected every log line to carry the request ID, got %s", line)
+		}
+	}
+
+	// Requests matching no route are logged and get a request ID too
+	buf.Reset()
+	req = httptest.NewRequest("GET", "/no/such/route", nil)
+	req.Header.Set("X-Request-ID", "unrouted-id")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("X-Request-ID") != "unrouted-id" {
+		t.Errorf("expected a 404 echoing the request ID, got %d %q", rr.Code, rr.Header().Get("X-Request-ID"))
+	}
+	if !strings.Contains(buf.String(), "request_id=unrouted-id") || !strings.Contains(buf.String(), "route=unmatched") {
+		t.Errorf("expected the unmatched request to be logged, got %s", buf.String())
+	}
+
+	// An unusable ID is replaced with a generated one
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Request-ID", "has spaces")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if got := rr.Header().Get("X-Request-ID"); got == "" || got == "has spaces" {
+		t.Errorf("expected a generated request ID, got %q", got)
+	}
+}
+
+func TestSetupRouterWithAPIKeys(t *testing.T) {
+	store := common.NewReceiptStorage()
+	secret, key, _ := common.NewAPIKey("acme", []string{common.ScopeReceiptsRead}, time.Now())
+	store.SaveAPIKey(key)
+
+	cfg := config.Default()
+	cfg.Auth.APIKeys = true
+	authenticator, _, err := newAuthenticator(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := SetupRouter(v1.NewServer(store, nil, nil, nil), cfg, authenticator, nil, logger.New(log.New(io.Discard, "", 0)))
+
+	tests := []struct {
+		method string
+		url    string
+		key    string
+		status int
+	}{
+		{"GET", "/healthz", "", http.StatusOK},
+		{"GET", "/receipts", "", http.StatusUnauthorized},
+		{"GET", "/receipts", secret, http.StatusOK},
+		{"POST", "/receipts/process", secret, http.StatusForbidden},
+		{"POST", "/users/alice/redemptions", secret, http.StatusForbidden},
+		{"POST", "/receipts/1/reversal", secret, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.url, tt.status, rr.Code)
+		}
+	}
+}
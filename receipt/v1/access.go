@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// requestClient returns the authenticated client of the request, or "" when
+// authentication is off
+func requestClient(r *http.Request) string {
+	principal, _ := common.PrincipalFromContext(r.Context())
+	return principal.ClientID
+}
+
+// requestUser returns the authenticated end user of the request, or "" when the
+// credentials do not name one
+func requestUser(r *http.Request) string {
+	principal, _ := common.PrincipalFromContext(r.Context())
+	return principal.UserID
+}
+
+// canAccess reports whether the caller of the request may see the receipt: it must
+// belong to the caller's client and, for a caller authenticated as an end user, to
+// that user. Without authentication every receipt is visible.
+func canAccess(r *http.Request, receipt common.Receipt) bool {
+	principal, ok := common.PrincipalFromContext(r.Context())
+	if !ok {
+		return true
+	}
+	return receipt.ClientID == principal.ClientID && (principal.UserID == "" || receipt.UserID == principal.UserID)
+}
+
+// authorizeReceipt checks, for an authenticated request, that the receipt belongs
+// to its caller, as decided by canAccess. It responds with the lookup error, or 404 Not Found for another
+// client's receipt, and reports whether the request may continue.
+func (s *Server) authorizeReceipt(w http.ResponseWriter, r *http.Request, log logger.Logger, receiptID string) bool {
+	if _, ok := common.PrincipalFromContext(r.Context()); !ok {
+		return true
+	}
+	receipt, err := s.store.GetReceiptByID(receiptID)
+	if err != nil {
+		s.respondWithLookupError(w, log, err)
+		return false
+	}
+	if !canAccess(r, receipt) {
+		respondWithForeignReceipt(w, log)
+		return false
+	}
+	return true
+}
+
+// authorizeUser checks that an authenticated request only reaches the accounts it
+// owns: an end user reaches their own account, and a client without a user the
+// accounts of users it submitted receipts for. It responds with 404 Not Found for
+// any other account, and reports whether the request may continue. System accounts
+// are never exposed.
+func (s *Server) authorizeUser(w http.ResponseWriter, r *http.Request, log logger.Logger, userID string) bool {
+	if common.IsSystemAccount(userID) {
+		log.Warn("System account requested")
+		common.RespondWithError(w, http.StatusNotFound, "Account not found")
+		return false
+	}
+	principal, ok := common.PrincipalFromContext(r.Context())
+	if !ok {
+		return true
+	}
+	if principal.UserID != "" {
+		if principal.UserID != userID {
+			log.Warn("Account belongs to another user")
+			common.RespondWithError(w, http.StatusNotFound, "Account not found")
+			return false
+		}
+		return true
+	}
+
+	page, err := s.store.ListReceipts(common.ReceiptFilter{ClientID: principal.ClientID, UserID: userID, Limit: 1})
+	if err != nil {
+		log.Error("Error checking account ownership", logger.Err(err))
+		common.RespondWithError(w, http.StatusInternalServerError, "Could not read the account")
+		return false
+	}
+	if len(page.Receipts) == 0 {
+		log.Warn("Account belongs to another client")
+		common.RespondWithError(w, http.StatusNotFound, "Account not found")
+		return false
+	}
+	return true
+}
+
+// authorizeLedgerChange checks that a request changing balances is authenticated
+// and granted the points:admin scope, or, when allowUser is set, made by an end
+// user. Ledger changes are not served without authentication; this guards against
+// wiring them up by mistake.
+func authorizeLedgerChange(w http.ResponseWriter, r *http.Request, log logger.Logger, allowUser bool) bool {
+	principal, ok := common.PrincipalFromContext(r.Context())
+	if !ok {
+		log.Warn("Unauthenticated ledger change")
+		common.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+	if !principal.HasScope(common.ScopePointsAdmin) && !(allowUser && principal.UserID != "") {
+		log.Warn("Ledger change without the points:admin scope")
+		common.RespondWithError(w, http.StatusForbidden, "Credentials lack the "+common.ScopePointsAdmin+" scope")
+		return false
+	}
+	return true
+}
+
+// respondWithAccountError responds with 404 for a user without an account and 500
+// for any other error
+func respondWithAccountError(w http.ResponseWriter, log logger.Logger, err error) {
+	var notFound *common.AccountNotFoundError
+	if errors.As(err, &notFound) {
+		log.Info("Account not found")
+		common.RespondWithError(w, http.StatusNotFound, "Account not found")
+		return
+	}
+	log.Error("Error reading account", logger.Err(err))
+	common.RespondWithError(w, http.StatusInternalServerError, "Could not read the account")
+}
+
+// respondWithForeignReceipt responds to a request for another client's receipt as
+// if it did not exist
+func respondWithForeignReceipt(w http.ResponseWriter, log logger.Logger) {
+	log.Warn("Receipt belongs to another client")
+	common.RespondWithError(w, http.StatusNotFound, "Receipt not found")
+}
@@ -0,0 +1,120 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestClientsOnlySeeTheirReceipts(t *testing.T) {
+	server := newTestServer(t)
+
+	// Authenticate every request as the client and user named in the X-Client and X-User headers
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := common.Principal{ClientID: r.Header.Get("X-Client"), UserID: r.Header.Get("X-User")}
+			next.ServeHTTP(w, r.WithContext(common.WithPrincipal(r.Context(), principal)))
+		})
+	})
+	router.HandleFunc("/receipts", server.ListReceipts).Methods("GET")
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}", server.GetReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}", server.DeleteReceipt).Methods("DELETE")
+	router.HandleFunc("/receipts/{id}/points", server.GetReceiptPoints).Methods("GET")
+
+	send := func(client, method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("X-Client", client)
+		req.Header.Set("X-User", client+"-user")
+		req.Header.Set(IfMatchHeader, "*")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The same receipt submitted by two clients is stored twice
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}], "clientId": "globex"}`
+	acmeID := responseID(t, send("acme", "POST", "/receipts/process", payload))
+	globexRR := send("globex", "POST", "/receipts/process", payload)
+	if globexRR.Code != http.StatusCreated {
+		t.Fatalf("expected another client's identical receipt to be stored, got %d: %s", globexRR.Code, globexRR.Body.String())
+	}
+
+	if stored, _ := server.store.GetReceiptByID(acmeID); stored.ClientID != "acme" || stored.UserID != "acme-user" {
+		t.Errorf("expected the receipt to be tagged with the authenticated client and user, got %q and %q", stored.ClientID, stored.UserID)
+	}
+	if rr := send("acme", "GET", "/receipts/"+acmeID, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected the owner to read the receipt, got %d", rr.Code)
+	}
+	for _, request := range []struct{ method, url string }{
+		{"GET", "/receipts/" + acmeID},
+		{"GET", "/receipts/" + acmeID + "/points"},
+		{"DELETE", "/receipts/" + acmeID},
+	} {
+		if rr := send("globex", request.method, request.url, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected another client to get %d, got %d", request.method, request.url, http.StatusNotFound, rr.Code)
+		}
+	}
+
+	var listing struct {
+		Data common.ReceiptPage `json:"data"`
+	}
+	json.Unmarshal(send("acme", "GET", "/receipts", "").Body.Bytes(), &listing)
+	if len(listing.Data.Receipts) != 1 || listing.Data.Receipts[0].ID != acmeID {
+		t.Errorf("expected only acme's receipt to be listed, got %+v", listing.Data.Receipts)
+	}
+}
+
+func TestUsersOfOneClientOnlySeeTheirReceipts(t *testing.T) {
+	server := newTestServer(t)
+
+	router := mux.NewRouter()
+	router.Use(authenticateFromHeaders)
+	router.HandleFunc("/receipts", server.ListReceipts).Methods("GET")
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}", server.GetReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}", server.PatchReceipt).Methods("PATCH")
+	router.HandleFunc("/receipts/{id}", server.DeleteReceipt).Methods("DELETE")
+
+	// Both users sign in through the same app, so their tokens share a client
+	send := func(user, method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("X-Client", "mobile-app")
+		req.Header.Set("X-User", user)
+		req.Header.Set(IfMatchHeader, "*")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The same receipt submitted by two users is not a duplicate
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	aliceID := responseID(t, send("alice", "POST", "/receipts/process", payload))
+	if rr := send("bob", "POST", "/receipts/process", payload); rr.Code != http.StatusCreated {
+		t.Fatalf("expected another user's identical receipt to be stored, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, request := range []struct{ method, url, body string }{
+		{"GET", "/receipts/" + aliceID, ""},
+		{"PATCH", "/receipts/" + aliceID, `{"retailer": "Walmart"}`},
+		{"DELETE", "/receipts/" + aliceID, ""},
+	} {
+		if rr := send("bob", request.method, request.url, request.body); rr.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected another user to get %d, got %d", request.method, request.url, http.StatusNotFound, rr.Code)
+		}
+	}
+
+	var listing struct {
+		Data common.ReceiptPage `json:"data"`
+	}
+	json.Unmarshal(send("alice", "GET", "/receipts", "").Body.Bytes(), &listing)
+	if len(listing.Data.Receipts) != 1 || listing.Data.Receipts[0].ID != aliceID {
+		t.Errorf("expected only alice's receipt to be listed, got %+v", listing.Data.Receipts)
+	}
+}
@@ -0,0 +1,39 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// DeleteReceipt soft-deletes a receipt, leaving a tombstone so later requests for it
+// get 410 Gone. If-Match must carry the receipt's current ETag.
+func (s *Server) DeleteReceipt(w http.ResponseWriter, r *http.Request) {
+	// Extract the ID from the URL path
+	vars := mux.Vars(r)
+	receiptID := vars["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	if !s.authorizeReceipt(w, r, log, receiptID) {
+		return
+	}
+
+	if _, err := s.store.GetReceiptVersion(receiptID); err != nil {
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+
+	expectedVersion, ok := s.requireIfMatch(w, r, log)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteReceipt(receiptID, expectedVersion, s.clock.Now()); err != nil {
+		s.respondWithChangeError(w, log, err)
+		return
+	}
+
+	log.Info("Receipt deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
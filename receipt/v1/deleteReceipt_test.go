@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDeleteReceipt(t *testing.T) {
+	server := newTestServer(t)
+	router := newChangeRouter(server)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	id := responseID(t, sendWithIfMatch(router, "POST", "/receipts/process", payload, ""))
+
+	if rr := sendWithIfMatch(router, "DELETE", "/receipts/"+id, "", ""); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected status code %d, got %d", http.StatusPreconditionRequired, rr.Code)
+	}
+	if rr := sendWithIfMatch(router, "DELETE", "/receipts/"+id, "", `W/"1"`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected a weak ETag to fail with %d, got %d", http.StatusPreconditionFailed, rr.Code)
+	}
+
+	rr := sendWithIfMatch(router, "DELETE", "/receipts/"+id, "", `"1"`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	// The tombstone answers 410 Gone everywhere
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/receipts/" + id},
+		{"GET", "/receipts/" + id + "/points"},
+		{"PUT", "/receipts/" + id},
+		{"DELETE", "/receipts/" + id},
+	} {
+		rr := sendWithIfMatch(router, req.method, req.path, payload, "*")
+		if rr.Code != http.StatusGone {
+			t.Errorf("%s %s: expected status code %d, got %d", req.method, req.path, http.StatusGone, rr.Code)
+		}
+	}
+
+	expected := `{"success":false,"error":"Receipt has been deleted"}`
+	if rr := sendWithIfMatch(router, "GET", "/receipts/"+id, "", ""); rr.Body.String() != expected {
+		t.Errorf("expected response body '%s', got '%s'", expected, rr.Body.String())
+	}
+
+	// The same receipt can be submitted again once deleted
+	if rr := sendWithIfMatch(router, "POST", "/receipts/process", payload, ""); rr.Code != http.StatusCreated {
+		t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// Headers used for optimistic concurrency
+const (
+	ETagHeader    = "ETag"     // Current version of a receipt
+	IfMatchHeader = "If-Match" // Version a change expects the receipt to be at
+)
+
+// formatETag returns the strong entity tag for a receipt version
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// requireIfMatch returns the version expected by the If-Match header, or
+// common.AnyVersion for "*". It responds with 428 Precondition Required when the
+// header is missing and 412 Precondition Failed when it cannot match any version.
+// It reports whether the request may continue.
+func (s *Server) requireIfMatch(w http.ResponseWriter, r *http.Request, log logger.Logger) (int64, bool) {
+	value := strings.TrimSpace(r.Header.Get(IfMatchHeader))
+	if value == "" {
+		common.RespondWithError(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return 0, false
+	}
+	if value == "*" {
+		return common.AnyVersion, true
+	}
+
+	// Weak tags never match under the strong comparison If-Match requires
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version < 1 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		log.Warn("Unusable If-Match header", logger.F("if_match", value))
+		common.RespondWithError(w, http.StatusPreconditionFailed, "Receipt has been modified")
+		return 0, false
+	}
+	return version, true
+}
+
+// respondWithLookupError responds with 410 Gone for a deleted receipt and
+// 404 Not Found for any other lookup failure
+func (s *Server) respondWithLookupError(w http.ResponseWriter, log logger.Logger, err error) {
+	var deleted *common.ReceiptDeletedError
+	if errors.As(err, &deleted) {
+		log.Info("Receipt was deleted")
+		common.RespondWithError(w, http.StatusGone, "Receipt has been deleted")
+		return
+	}
+	log.Info("Receipt not found", logger.Err(err))
+	common.RespondWithError(w, http.StatusNotFound, "Receipt not found")
+}
+
+// respondWithChangeError maps the error of a conditional update or delete to a response
+func (s *Server) respondWithChangeError(w http.ResponseWriter, log logger.Logger, err error) {
+	var conflict *common.VersionConflictError
+	if errors.As(err, &conflict) {
+		log.Info("Version conflict", logger.F("current_version", conflict.Current))
+		w.Header().Set(ETagHeader, formatETag(conflict.Current))
+		common.RespondWithError(w, http.StatusPreconditionFailed, "Receipt has been modified")
+		return
+	}
+	if s.respondIfDuplicate(w, log, err) {
+		return
+	}
+	var deleted *common.ReceiptDeletedError
+	if errors.As(err, &deleted) {
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+	log.Error("Error changing receipt", logger.Err(err))
+	common.RespondWithError(w, http.StatusInternalServerError, "Could not store the receipt")
+}
@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+)
+
+// Evaluation is the outcome of EvaluateReceipt for a receipt that may be stored.
+type Evaluation struct {
+	Breakdown []common.RuleResult // Result of every points rule
+	Points    int64               // Sum of the breakdown
+	Warnings  validation.Errors   // Consistency problems tolerated in lenient mode
+}
+
+// ScoringError reports a valid receipt that the points calculator could not score,
+// for instance because of an amount too large to multiply.
+type ScoringError struct {
+	Err error
+}
+
+func (e *ScoringError) Error() string {
+	return "could not calculate points: " + e.Err.Error()
+}
+
+func (e *ScoringError) Unwrap() error {
+	return e.Err
+}
+
+// EvaluateReceipt runs a receipt through the checks and scoring every submission
+// gets, so tools storing receipts offline treat them as the API does. The fields
+// are validated, then their consistency is checked as of now, then the receipt is
+// scored with calculator. Problems with the receipt are returned as
+// validation.Errors, and a receipt that cannot be scored as a *ScoringError.
+func EvaluateReceipt(receipt common.Receipt, calculator PointsCalculator, consistency validation.ConsistencyOptions, now time.Time) (Evaluation, error) {
+	if err := validation.ValidateReceipt(
+		receipt.Retailer,
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total,
+		convertItemsToMap(receipt.Items),
+	); err != nil {
+		return Evaluation{}, err
+	}
+
+	warnings, err := validation.CheckConsistency(receipt, now, consistency)
+	if err != nil {
+		return Evaluation{Warnings: warnings}, err
+	}
+
+	breakdown, err := calculator.Breakdown(receipt)
+	if err != nil {
+		return Evaluation{Warnings: warnings}, &ScoringError{Err: err}
+	}
+	return Evaluation{Breakdown: breakdown, Points: common.SumPoints(breakdown), Warnings: warnings}, nil
+}
+
+func convertItemsToMap(items []common.Item) []map[string]string {
+	result := make([]map[string]string, len(items))
+	for i, item := range items {
+		result[i] = map[string]string{
+			"shortDescription": item.ShortDescription,
+			"price":            item.Price,
+		}
+	}
+	return result
+}
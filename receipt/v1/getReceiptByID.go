@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// GetReceipt retrieves the full stored receipt, with its points, by its ID.
+// The ETag header carries the version to send in If-Match when changing it.
+func (s *Server) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	// Extract the ID from the URL path
+	vars := mux.Vars(r)
+	receiptID := vars["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	// The receipt and its version are read together, so the ETag always matches the
+	// content returned and If-Match cannot overwrite an edit the client never saw
+	record, version, err := s.store.GetReceiptRecord(receiptID)
+	if err != nil {
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+	if !canAccess(r, record.Receipt) {
+		respondWithForeignReceipt(w, log)
+		return
+	}
+
+	log.Info("Returning receipt")
+
+	w.Header().Set(ETagHeader, formatETag(version))
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    record,
+	})
+}
@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestGetReceiptSuccess(t *testing.T) {
+	server := newTestServer(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}", server.GetReceipt).Methods("GET")
+
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	id := responseID(t, rr)
+
+	req, _ = http.NewRequest("GET", "/receipts/"+id, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var response struct {
+		Data common.ReceiptRecord `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+	if response.Data.ID != id || response.Data.Retailer != "Target" || len(response.Data.Items) != 1 {
+		t.Errorf("unexpected receipt: %+v", response.Data)
+	}
+	if response.Data.Points != 89 {
+		t.Errorf("expected 89 points, got %d", response.Data.Points)
+	}
+}
+
+func TestGetReceiptNotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest("GET", "/receipts/non-existent-id", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts/{id}", server.GetReceipt)
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	expected := `{"success":false,"error":"Receipt not found"}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected response body '%s', got '%s'", expected, rr.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// PointsBreakdown is the response payload explaining how a receipt was scored
+type PointsBreakdown struct {
+	Points int64               `json:"points"` // Total points awarded
+	Rules  []common.RuleResult `json:"rules"`  // Result of each rule, in evaluation order
+}
+
+// GetReceiptPointsBreakdown retrieves the per-rule points breakdown recorded when the receipt was submitted
+func (s *Server) GetReceiptPointsBreakdown(w http.ResponseWriter, r *http.Request) {
+	// Extract the ID from the URL path
+	vars := mux.Vars(r)
+	receiptID := vars["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	if !s.authorizeReceipt(w, r, log, receiptID) {
+		return
+	}
+
+	points, err := s.store.GetReceiptPoints(receiptID)
+	if err != nil {
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+
+	breakdown, err := s.store.GetReceiptBreakdown(receiptID)
+	if err != nil {
+		log.Error("Error retrieving points breakdown", logger.Err(err))
+		common.RespondWithError(w, http.StatusInternalServerError, "Could not retrieve the points breakdown")
+		return
+	}
+	if breakdown == nil {
+		breakdown = []common.RuleResult{}
+	}
+
+	log.Info("Returning points breakdown")
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    PointsBreakdown{Points: points, Rules: breakdown},
+	})
+}
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestGetReceiptPointsBreakdownSuccess(t *testing.T) {
+	server := newTestServer(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}/points/breakdown", server.GetReceiptPointsBreakdown).Methods("GET")
+
+	// Submit a receipt so the breakdown is recorded
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+	]}`
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var submitted struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &submitted)
+
+	req, _ = http.NewRequest("GET", "/receipts/"+submitted.Data.ID+"/points/breakdown", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	var response struct {
+		Success bool            `json:"success"`
+		Data    PointsBreakdown `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+
+	if response.Data.Points != 28 {
+		t.Errorf("expected 28 points, got %d", response.Data.Points)
+	}
+	if len(response.Data.Rules) != 7 {
+		t.Fatalf("expected 7 rule results, got %d", len(response.Data.Rules))
+	}
+	if common.SumPoints(response.Data.Rules) != response.Data.Points {
+		t.Errorf("expected rule points to add up to the total, got %+v", response.Data.Rules)
+	}
+	if rule := response.Data.Rules[0]; rule.Input != "Target" || rule.Points != 6 || !rule.Matched {
+		t.Errorf("unexpected retailer rule result: %+v", rule)
+	}
+}
+
+func TestGetReceiptPointsBreakdownNotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest("GET", "/receipts/non-existent-id/points/breakdown", nil)
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts/{id}/points/breakdown", server.GetReceiptPointsBreakdown)
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, status)
+	}
+
+	expected := `{"success":false,"error":"Receipt not found"}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected response body '%s', got '%s'", expected, rr.Body.String())
+	}
+}
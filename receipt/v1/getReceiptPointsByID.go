@@ -9,22 +9,25 @@ import (
 )
 
 // GetReceiptPoints retrieves the points awarded for a specific receipt by its ID
-func GetReceiptPoints(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetReceiptPoints(w http.ResponseWriter, r *http.Request) {
 	// Extract the ID from the URL path
 	vars := mux.Vars(r)
 	receiptID := vars["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	if !s.authorizeReceipt(w, r, log, receiptID) {
+		return
+	}
 
 	// Retrieve the points for the given receipt ID from the storage
-	points, err := common.Storage.GetReceiptPoints(receiptID)
+	points, err := s.store.GetReceiptPoints(receiptID)
 	if err != nil {
-		logger.Info("Receipt with ID not found: " + receiptID)
-		logger.Error("Error: " + err.Error())
-		common.RespondWithError(w, http.StatusNotFound, "Receipt not found")
+		s.respondWithLookupError(w, log, err)
 		return
 	}
 
 	// Log the successful retrieval
-	logger.Info("Returning points for receipt ID: " + receiptID)
+	log.Info("Returning points")
 
 	// Wrap the points in a JSONResponse and respond
 	response := common.JSONResponse{
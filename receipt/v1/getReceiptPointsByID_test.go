@@ -10,16 +10,11 @@ import (
 )
 
 func TestGetReceiptPointsSuccess(t *testing.T) {
-	// Reset the global storage
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
-	}
+	server := newTestServer(t)
 
 	// Add a receipt to the storage
 	receipt := common.Receipt{ID: "1", Retailer: "Retailer A", PurchaseDate: "2023-11-25", PurchaseTime: "12:00", Total: "100.00"}
-	common.Storage.AddReceipt(receipt, 150) // Assign 150 points to this receipt
+	server.Store().AddSubmission(common.Submission{Receipt: receipt, Points: 150}) // Assign 150 points to this receipt
 
 	// Create a request to the endpoint
 	req, err := http.NewRequest("GET", "/v1/receipts/1/points", nil)
@@ -30,7 +25,7 @@ func TestGetReceiptPointsSuccess(t *testing.T) {
 
 	// Set up the router and serve the request
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/receipts/{id}/points", GetReceiptPoints)
+	router.HandleFunc("/v1/receipts/{id}/points", server.GetReceiptPoints)
 	router.ServeHTTP(rr, req)
 
 	// Check the response status code
@@ -46,12 +41,7 @@ func TestGetReceiptPointsSuccess(t *testing.T) {
 }
 
 func TestGetReceiptPointsNotFound(t *testing.T) {
-	// Reset the global storage
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
-	}
+	server := newTestServer(t)
 
 	// Create a request to a non-existent receipt
 	req, err := http.NewRequest("GET", "/v1/receipts/non-existent-id/points", nil)
@@ -62,7 +52,7 @@ func TestGetReceiptPointsNotFound(t *testing.T) {
 
 	// Set up the router and serve the request
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/receipts/{id}/points", GetReceiptPoints)
+	router.HandleFunc("/v1/receipts/{id}/points", server.GetReceiptPoints)
 	router.ServeHTTP(rr, req)
 
 	// Check the response status code
@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// GetUserBalance retrieves the points balance of a user's account
+func (s *Server) GetUserBalance(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyUserID, userID))
+
+	if !s.authorizeUser(w, r, log, userID) {
+		return
+	}
+
+	account, err := s.store.GetAccount(userID)
+	if err != nil {
+		respondWithAccountError(w, log, err)
+		return
+	}
+
+	log.Info("Returning balance")
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    account,
+	})
+}
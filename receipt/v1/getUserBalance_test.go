@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestSubmittedReceiptsCreditTheUser(t *testing.T) {
+	server := newTestServer(t)
+
+	// Authenticate every request as the user named in the X-User header
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := common.Principal{ClientID: "app", UserID: r.Header.Get("X-User")}
+			next.ServeHTTP(w, r.WithContext(common.WithPrincipal(r.Context(), principal)))
+		})
+	})
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/users/{id}/balance", server.GetUserBalance).Methods("GET")
+	router.HandleFunc("/users/{id}/ledger", server.GetUserLedger).Methods("GET")
+
+	send := func(user, method, url, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("X-User", user)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("alice", "GET", "/users/alice/balance", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before any receipt is credited, got %d", rr.Code)
+	}
+
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}]}`
+	receiptID := responseID(t, send("alice", "POST", "/receipts/process", payload))
+	points, _ := server.Store().GetReceiptPoints(receiptID)
+
+	rr := send("alice", "GET", "/users/alice/balance", "")
+	var balance struct {
+		Data common.Account `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &balance); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the balance, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if balance.Data.UserID != "alice" || balance.Data.Balance != points {
+		t.Errorf("expected alice to have %d points, got %+v", points, balance.Data)
+	}
+
+	rr = send("alice", "GET", "/users/alice/ledger", "")
+	var ledger struct {
+		Data struct {
+			Entries []common.LedgerEntry `json:"entries"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &ledger); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the ledger, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(ledger.Data.Entries) != 1 || ledger.Data.Entries[0].ReceiptID != receiptID || ledger.Data.Entries[0].Points != points {
+		t.Errorf("expected one earn entry for the receipt, got %+v", ledger.Data.Entries)
+	}
+
+	// Another user cannot see alice's account
+	for _, url := range []string{"/users/alice/balance", "/users/alice/ledger"} {
+		if rr := send("bob", "GET", url, ""); rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected another user to get %d, got %d", url, http.StatusNotFound, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// expiringLot is a lot of points with the time it expires
+type expiringLot struct {
+	common.PointsLot
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// GetUserExpiringPoints lists the points of a user that expire within the
+// expiring-soon window, soonest first
+func (s *Server) GetUserExpiringPoints(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyUserID, userID))
+
+	if !s.authorizeUser(w, r, log, userID) {
+		return
+	}
+
+	entries, err := s.store.ListLedgerEntries(userID)
+	if err != nil {
+		respondWithAccountError(w, log, err)
+		return
+	}
+
+	// Lots are oldest first, so they also expire soonest first
+	before := s.clock.Now().Add(s.expiringSoonWindow)
+	lots := []expiringLot{}
+	var points int64
+	if s.pointsMaxAge > 0 {
+		for _, lot := range common.OpenLots(entries) {
+			expiresAt := lot.EarnedAt.Add(s.pointsMaxAge)
+			if expiresAt.After(before) {
+				break
+			}
+			lots = append(lots, expiringLot{PointsLot: lot, ExpiresAt: expiresAt})
+			points += lot.Points
+		}
+	}
+
+	log.Info("Returning expiring points", logger.F("points", points))
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"userId": userID,
+			"points": points,
+			"before": before,
+			"lots":   lots,
+		},
+	})
+}
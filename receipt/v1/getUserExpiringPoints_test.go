@@ -0,0 +1,55 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestGetUserExpiringPoints(t *testing.T) {
+	now := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	server := NewServer(nil, nil, newTestServer(t).logger, common.FixedClock{Time: now}, WithPointsExpiry(365*24*time.Hour, 30*24*time.Hour))
+
+	// Earned 350, 300 and 10 days ago; only the first expires within 30 days
+	for i, days := range []int{350, 300, 10} {
+		id := string(rune('a' + i))
+		receipt := common.Receipt{ID: id, Retailer: "Retailer " + id, PurchaseDate: "2022-12-31", PurchaseTime: "12:00", Total: "1.00", UserID: "alice"}
+		if err := server.Store().AddSubmission(common.Submission{Receipt: receipt, Points: 100, At: now.AddDate(0, 0, -days)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := server.Store().RedeemPoints(common.Redemption{UserID: "alice", Points: 40, Key: "k"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/expiring", server.GetUserExpiringPoints).Methods("GET")
+	req, _ := http.NewRequest("GET", "/users/alice/expiring", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var response struct {
+		Data struct {
+			Points int64 `json:"points"`
+			Lots   []struct {
+				ReceiptID string    `json:"receiptId"`
+				Points    int64     `json:"points"`
+				ExpiresAt time.Time `json:"expiresAt"`
+			} `json:"lots"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the expiring points, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The redemption used the oldest points first, leaving 60 of them
+	if response.Data.Points != 60 || len(response.Data.Lots) != 1 || response.Data.Lots[0].ReceiptID != "a" ||
+		!response.Data.Lots[0].ExpiresAt.Equal(now.AddDate(0, 0, -350).Add(365*24*time.Hour)) {
+		t.Errorf("unexpected expiring points %+v", response.Data)
+	}
+}
@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// GetUserLedger retrieves every change to a user's points balance, oldest first
+func (s *Server) GetUserLedger(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyUserID, userID))
+
+	if !s.authorizeUser(w, r, log, userID) {
+		return
+	}
+
+	entries, err := s.store.ListLedgerEntries(userID)
+	if err != nil {
+		respondWithAccountError(w, log, err)
+		return
+	}
+
+	log.Info("Returning ledger", logger.F("entries", len(entries)))
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    map[string]interface{}{"userId": userID, "entries": entries},
+	})
+}
@@ -0,0 +1,95 @@
+package v1
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+)
+
+// BuildInfo is the response payload describing the running build
+type BuildInfo struct {
+	Version      string `json:"version"`      // Release version, "dev" for local builds
+	Commit       string `json:"commit"`       // Source commit the binary was built from
+	GoVersion    string `json:"goVersion"`    // Go toolchain version
+	RulesVersion string `json:"rulesVersion"` // Version of the active points rules, if the calculator reports one
+}
+
+// ReadinessCheck is the response payload describing whether the server can take traffic
+type ReadinessCheck struct {
+	Store    string `json:"store"`    // "ok" or "unavailable"
+	Rules    string `json:"rules"`    // "ok" or why no points rules are loaded
+	Draining bool   `json:"draining"` // Whether the server is shutting down
+}
+
+// versioned is implemented by points calculators that know their rule set version
+type versioned interface {
+	Version() string
+}
+
+// rulesLoaded reports whether a points calculator is configured. A nil rule engine
+// stored in the interface counts as none.
+func rulesLoaded(points PointsCalculator) bool {
+	engine, isEngine := points.(*rules.Engine)
+	return points != nil && (!isEngine || engine != nil)
+}
+
+// SetDraining marks the server as shutting down, so readiness fails and the
+// orchestrator stops routing new traffic to it
+func (s *Server) SetDraining(draining bool) {
+	s.draining.Store(draining)
+}
+
+// Healthz reports that the process is alive
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    map[string]string{"status": "ok"},
+	})
+}
+
+// Readyz reports whether the server can take traffic: the store is reachable,
+// the points rules are loaded and the server is not draining
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	check := ReadinessCheck{Store: "ok", Rules: "ok", Draining: s.draining.Load()}
+	log := s.requestLogger(r)
+	if err := s.store.Ping(); err != nil {
+		// The probe is unauthenticated, so the detail only goes to the log
+		log.Error("Store is unreachable", logger.Err(err))
+		check.Store = "unavailable"
+	}
+	if !rulesLoaded(s.points) {
+		check.Rules = "no points rules loaded"
+	}
+
+	if check.Store != "ok" || check.Rules != "ok" || check.Draining {
+		log.Warn("Readiness check failed", logger.F("store", check.Store), logger.F("rules", check.Rules), logger.F("draining", check.Draining))
+		common.RespondWithJSON(w, http.StatusServiceUnavailable, common.JSONResponse{
+			Success: false,
+			Data:    check,
+			Error:   "Not ready",
+		})
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    check,
+	})
+}
+
+// Version reports the running build and the active points rules version
+func (s *Server) Version(w http.ResponseWriter, r *http.Request) {
+	info := s.build
+	info.GoVersion = runtime.Version()
+	if rules, ok := s.points.(versioned); ok {
+		info.RulesVersion = rules.Version()
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    info,
+	})
+}
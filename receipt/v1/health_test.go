@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+)
+
+func TestHealthz(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	server.Healthz(rr, req)
+
+	expected := `{"success":true,"data":{"status":"ok"}}`
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("expected %d %s, got %d %s", http.StatusOK, expected, rr.Code, rr.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	path := t.TempDir() + "/receipts.db"
+	store, err := common.NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("could not open sqlite storage: %v", err)
+	}
+	server := NewServer(store, nil, newTestServer(t).logger, nil)
+
+	readyz := func() (int, ReadinessCheck) {
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		rr := httptest.NewRecorder()
+		server.Readyz(rr, req)
+		var response struct {
+			Data ReadinessCheck `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr.Code, response.Data
+	}
+
+	if code, check := readyz(); code != http.StatusOK || check.Store != "ok" || check.Rules != "ok" {
+		t.Errorf("expected the server to be ready, got %d %+v", code, check)
+	}
+
+	// Readiness fails while draining
+	server.SetDraining(true)
+	if code, check := readyz(); code != http.StatusServiceUnavailable || !check.Draining {
+		t.Errorf("expected the draining server not to be ready, got %d %+v", code, check)
+	}
+	server.SetDraining(false)
+
+	// Readiness fails once the store is unreachable
+	store.Close()
+	if code, check := readyz(); code != http.StatusServiceUnavailable || check.Store != "unavailable" {
+		t.Errorf("expected the server without a store not to be ready, got %d %+v", code, check)
+	}
+}
+
+func TestReadyzRules(t *testing.T) {
+	readyz := func(points PointsCalculator) (int, ReadinessCheck) {
+		server := NewServer(nil, points, newTestServer(t).logger, nil)
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		rr := httptest.NewRecorder()
+		server.Readyz(rr, req)
+		var response struct {
+			Data ReadinessCheck `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr.Code, response.Data
+	}
+
+	// Rules without a version are identified by their content, and are ready
+	engine, err := rules.Build(rules.Config{Rules: []rules.RuleConfig{{Type: rules.TypeOddDay, Points: 6}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, check := readyz(engine); code != http.StatusOK || check.Rules != "ok" {
+		t.Errorf("expected the server with unversioned rules to be ready, got %d %+v", code, check)
+	}
+
+	var missing *rules.Engine
+	if code, check := readyz(missing); code != http.StatusServiceUnavailable || check.Rules == "ok" {
+		t.Errorf("expected the server without rules not to be ready, got %d %+v", code, check)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	server := NewServer(nil, nil, newTestServer(t).logger, nil, WithBuildInfo("1.2.3", "abc123"))
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+	server.Version(rr, req)
+
+	var response struct {
+		Data BuildInfo `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	expected := BuildInfo{Version: "1.2.3", Commit: "abc123", GoVersion: runtime.Version(), RulesVersion: "default"}
+	if rr.Code != http.StatusOK || response.Data != expected {
+		t.Errorf("expected %+v, got %d %+v", expected, rr.Code, response.Data)
+	}
+}
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+)
+
+// ListReceipts returns a page of stored receipts, optionally filtered by retailer,
+// purchase date, total and points, following the cursor from a previous page
+func (s *Server) ListReceipts(w http.ResponseWriter, r *http.Request) {
+	log := s.requestLogger(r)
+	filter, errs := parseReceiptFilter(r.URL.Query())
+	if len(errs) > 0 {
+		log.Warn("Invalid receipt listing query", logger.Err(errs))
+		common.RespondWithErrors(w, http.StatusBadRequest, "Invalid query parameters", errs)
+		return
+	}
+
+	filter.ClientID = requestClient(r)
+	filter.UserID = requestUser(r)
+	page, err := s.store.ListReceipts(filter)
+	if err != nil {
+		log.Error("Error listing receipts", logger.Err(err))
+		common.RespondWithError(w, http.StatusInternalServerError, "Could not list receipts")
+		return
+	}
+
+	log.Info("Returning receipts", logger.F("count", len(page.Receipts)))
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// parseReceiptFilter converts the listing query parameters into a filter,
+// collecting a structured error for every invalid parameter
+func parseReceiptFilter(query url.Values) (common.ReceiptFilter, validation.Errors) {
+	var errs validation.Errors
+	invalid := func(name, message string) {
+		errs = append(errs, common.ErrorDetail{Path: "/" + name, Code: validation.CodeInvalidFormat, Message: message})
+	}
+
+	filter := common.ReceiptFilter{
+		Retailer: query.Get("retailer"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	// Parameters are checked in a fixed order, so errors are always listed the same way
+	for _, param := range []struct {
+		name   string
+		target *string
+	}{{"purchaseDateFrom", &filter.DateFrom}, {"purchaseDateTo", &filter.DateTo}} {
+		if value := query.Get(param.name); value != "" {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				invalid(param.name, param.name+" must be a date in YYYY-MM-DD format")
+				continue
+			}
+			*param.target = value
+		}
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **common.Money
+	}{{"minTotal", &filter.MinTotal}, {"maxTotal", &filter.MaxTotal}} {
+		if value := query.Get(param.name); value != "" {
+			amount, err := common.ParseMoney(value)
+			if err != nil {
+				invalid(param.name, param.name+" must be an amount such as 12.34")
+				continue
+			}
+			*param.target = &amount
+		}
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **int64
+	}{{"minPoints", &filter.MinPoints}, {"maxPoints", &filter.MaxPoints}} {
+		if value := query.Get(param.name); value != "" {
+			points, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				invalid(param.name, param.name+" must be a whole number")
+				continue
+			}
+			*param.target = &points
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > common.MaxPageSize {
+			invalid("limit", "limit must be between 1 and "+strconv.Itoa(common.MaxPageSize))
+		} else {
+			filter.Limit = limit
+		}
+	}
+
+	if _, err := common.DecodeCursor(filter.Cursor); err != nil {
+		invalid("cursor", "cursor is not valid")
+	}
+
+	return filter, errs
+}
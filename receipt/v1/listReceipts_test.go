@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+func TestListReceipts(t *testing.T) {
+	server := newTestServer(t)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts", server.ListReceipts).Methods("GET")
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+
+	for _, payload := range []string{
+		`{"retailer": "Target", "purchaseDate": "2023-11-20", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+		`{"retailer": "Walgreens", "purchaseDate": "2023-11-21", "purchaseTime": "12:00", "total": "20.00", "items": [{"shortDescription": "Item B", "price": "20.00"}]}`,
+		`{"retailer": "Target", "purchaseDate": "2023-11-22", "purchaseTime": "12:00", "total": "30.00", "items": [{"shortDescription": "Item C", "price": "30.00"}]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	}
+
+	list := func(query string) common.ReceiptPage {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/receipts"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d: %s", query, http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			Data common.ReceiptPage `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	page := list("?retailer=target&minTotal=15")
+	if len(page.Receipts) != 1 || page.Receipts[0].Total != "30.00" || page.Receipts[0].Points == 0 {
+		t.Errorf("expected only the 30.00 Target receipt with its points, got: %+v", page.Receipts)
+	}
+
+	page = list("?limit=2")
+	if len(page.Receipts) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected a first page of 2 with a cursor, got: %+v", page)
+	}
+	page = list("?limit=2&cursor=" + page.NextCursor)
+	if len(page.Receipts) != 1 || page.Receipts[0].Total != "30.00" || page.NextCursor != "" {
+		t.Errorf("expected a final page with the last receipt, got: %+v", page)
+	}
+}
+
+func TestListReceiptsInvalidQuery(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest("GET", "/receipts?cursor=%21&minTotal=abc&limit=0&purchaseDateFrom=2023-13-01", nil)
+	rr := httptest.NewRecorder()
+	server.ListReceipts(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	var response common.JSONResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	var paths []string
+	for _, detail := range response.Errors {
+		paths = append(paths, detail.Path)
+	}
+	// Errors are listed in a fixed order, whatever the order of the query
+	if got := strings.Join(paths, " "); got != "/purchaseDateFrom /minTotal /limit /cursor" {
+		t.Errorf("expected errors for every invalid parameter in a fixed order, got: %s", got)
+	}
+}
+
+func TestListReceiptsStoreFailure(t *testing.T) {
+	server := NewServer(unavailableStore{common.NewReceiptStorage()}, DefaultPointsCalculator, logger.New(log.New(io.Discard, "", 0)), nil)
+
+	rr := httptest.NewRecorder()
+	server.ListReceipts(rr, httptest.NewRequest("GET", "/receipts", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	// The store's error stays in the log
+	if strings.Contains(rr.Body.String(), "database is locked") {
+		t.Errorf("expected the store error to be kept out of the response, got: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// pointsBuckets are the upper bounds of the points awarded histogram
+var pointsBuckets = []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500}
+
+// Metrics holds the metrics recorded by the receipt API
+type Metrics struct {
+	registry           *prometheus.Registry
+	requests           *prometheus.CounterVec
+	latency            *prometheus.HistogramVec
+	validationFailures *prometheus.CounterVec
+	receiptsStored     prometheus.Counter
+	points             prometheus.Histogram
+	ruleMatches        *prometheus.CounterVec
+}
+
+// NewMetrics registers the receipt API metrics in registry
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "receipt_api_http_requests_total",
+			Help: "HTTP requests handled, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "receipt_api_http_request_duration_seconds",
+			Help:    "HTTP request latency, by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "receipt_api_validation_failures_total",
+			Help: "Receipt validation problems, by error code.",
+		}, []string{"reason"}),
+		receiptsStored: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "receipt_api_receipts_stored_total",
+			Help: "Receipts stored.",
+		}),
+		points: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "receipt_api_points_awarded",
+			Help:    "Points awarded per stored receipt.",
+			Buckets: pointsBuckets,
+		}),
+		ruleMatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "receipt_api_rule_matches_total",
+			Help: "Points rule matches on stored receipts, by rule.",
+		}, []string{"rule"}),
+	}
+	registry.MustRegister(m.requests, m.latency, m.validationFailures, m.receiptsStored, m.points, m.ruleMatches)
+	return m
+}
+
+// Registry returns the registry the metrics are exposed from
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a handled HTTP request. The route is the route template,
+// such as "/receipts/{id}", so receipt IDs do not create new series.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.latency.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// recordValidationFailure counts every problem of a failed validation by its code
+func (m *Metrics) recordValidationFailure(err error) {
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		m.validationFailures.WithLabelValues("other").Inc()
+		return
+	}
+	for _, detail := range errs {
+		m.validationFailures.WithLabelValues(detail.Code).Inc()
+	}
+}
+
+// recordStored counts a newly stored receipt, and records the points awarded to it
+// and the rules it matched. Updated receipts are not recorded again.
+func (m *Metrics) recordStored(breakdown []common.RuleResult) {
+	m.receiptsStored.Inc()
+	m.points.Observe(float64(common.SumPoints(breakdown)))
+	for _, result := range breakdown {
+		if result.Matched {
+			m.ruleMatches.WithLabelValues(result.Rule).Inc()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsRecordSubmissions(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	server := newTestServer(t)
+	WithMetrics(m)(server)
+
+	payloads := []string{
+		`{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`,
+		`{"retailer": "", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`,
+	}
+	for _, payload := range payloads {
+		req := httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+		server.SubmitReceipt(httptest.NewRecorder(), req)
+	}
+	server.Metrics().ObserveRequest("/receipts/process", "POST", http.StatusCreated, 30*time.Millisecond)
+
+	if got := testutil.ToFloat64(m.receiptsStored); got != 1 {
+		t.Errorf("expected 1 stored receipt, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.validationFailures.WithLabelValues("required")); got != 1 {
+		t.Errorf("expected 1 required failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ruleMatches.WithLabelValues("round_dollar")); got != 1 {
+		t.Errorf("expected 1 round_dollar match, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("/receipts/process", "POST", "201")); got != 1 {
+		t.Errorf("expected 1 request, got %v", got)
+	}
+
+	expected := `
+# HELP receipt_api_points_awarded Points awarded per stored receipt.
+# TYPE receipt_api_points_awarded histogram
+receipt_api_points_awarded_bucket{le="0"} 0
+receipt_api_points_awarded_bucket{le="10"} 0
+receipt_api_points_awarded_bucket{le="25"} 0
+receipt_api_points_awarded_bucket{le="50"} 0
+receipt_api_points_awarded_bucket{le="75"} 0
+receipt_api_points_awarded_bucket{le="100"} 0
+receipt_api_points_awarded_bucket{le="150"} 1
+receipt_api_points_awarded_bucket{le="200"} 1
+receipt_api_points_awarded_bucket{le="300"} 1
+receipt_api_points_awarded_bucket{le="500"} 1
+receipt_api_points_awarded_bucket{le="+Inf"} 1
+receipt_api_points_awarded_sum 110
+receipt_api_points_awarded_count 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "receipt_api_points_awarded"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetricsSkipUpdatedReceipts(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	server := newTestServer(t)
+	WithMetrics(m)(server)
+	router := newChangeRouter(server)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	id := responseID(t, sendWithIfMatch(router, "POST", "/receipts/process", payload, ""))
+	replacement := `{"retailer": "Walgreens", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.25", "items": [{"shortDescription": "Item B", "price": "10.25"}]}`
+	if rr := sendWithIfMatch(router, "PUT", "/receipts/"+id, replacement, `"1"`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// Re-scoring an updated receipt is not a new award
+	if got := testutil.ToFloat64(m.receiptsStored); got != 1 {
+		t.Errorf("expected 1 stored receipt, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ruleMatches.WithLabelValues("retailer_alphanumeric")); got != 1 {
+		t.Errorf("expected the retailer rule to be counted once, got %v", got)
+	}
+}
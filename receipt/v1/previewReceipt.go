@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// PreviewReceipt runs the SubmitReceipt validation and points calculation without
+// storing anything, and responds with the score the receipt would get
+func (s *Server) PreviewReceipt(w http.ResponseWriter, r *http.Request) {
+	var receipt common.Receipt
+	log := s.requestLogger(r)
+
+	// Parse the JSON body
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		s.respondWithDecodeError(w, log, err)
+		return
+	}
+
+	evaluation, ok := s.evaluateReceipt(w, log, receipt)
+	if !ok {
+		return
+	}
+
+	log.Info("Returning points preview", logger.F("points", evaluation.Points))
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    PointsBreakdown{Points: evaluation.Points, Rules: evaluation.Breakdown},
+	})
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+func TestPreviewReceipt(t *testing.T) {
+	server := newTestServer(t)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "35.35", "items": [
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+	]}`
+	req, _ := http.NewRequest("POST", "/receipts/preview", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	server.PreviewReceipt(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var response struct {
+		Data PointsBreakdown `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Data.Points != 28 || len(response.Data.Rules) != 7 {
+		t.Errorf("expected 28 points from 7 rules, got: %+v", response.Data)
+	}
+
+	// Nothing is stored, so previewing twice is not a duplicate
+	if _, err := server.Store().GetAllReceipts(); err == nil {
+		t.Errorf("expected the preview not to store the receipt")
+	}
+}
+
+func TestPreviewReceiptInvalid(t *testing.T) {
+	server := newTestServer(t)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "total": "abc", "items": [{"shortDescription": "Item", "price": "1.00"}]}`
+	req, _ := http.NewRequest("POST", "/receipts/preview", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	server.PreviewReceipt(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var response common.JSONResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if len(response.Errors) != 1 || response.Errors[0].Path != "/total" {
+		t.Errorf("expected an error for /total, got: %+v", response.Errors)
+	}
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// redemptionRequest is the body of a points redemption
+type redemptionRequest struct {
+	Points int64  `json:"points"` // Points to spend
+	Reason string `json:"reason"` // What they are spent on, recorded in the ledger
+}
+
+// RedeemPoints spends points from a user's account. Only the user, or a client
+// granted the points:admin scope acting for one of its users, may redeem. The
+// Idempotency-Key header is required, so a retried redemption never spends twice.
+func (s *Server) RedeemPoints(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyUserID, userID))
+
+	if !authorizeLedgerChange(w, r, log, true) || !s.authorizeUser(w, r, log, userID) {
+		return
+	}
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		common.RespondWithError(w, http.StatusBadRequest, "Idempotency-Key is required")
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		common.RespondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	var request redemptionRequest
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.respondWithDecodeError(w, log, err)
+		return
+	}
+	if request.Points <= 0 {
+		common.RespondWithError(w, http.StatusBadRequest, "points must be a positive integer")
+		return
+	}
+
+	redemption := common.Redemption{UserID: userID, Points: request.Points, Key: key, Reason: request.Reason}
+	entry, replayed, err := s.store.RedeemPoints(redemption, s.clock.Now())
+	if err != nil {
+		respondWithRedemptionError(w, log, err)
+		return
+	}
+
+	if replayed {
+		log.Info("Replaying redemption", logger.F("idempotency_key", key))
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	} else {
+		log.Info("Points redeemed", logger.F("points", request.Points), logger.F("balance", entry.Balance))
+	}
+	common.RespondWithJSON(w, http.StatusCreated, common.JSONResponse{
+		Success: true,
+		Data:    entry,
+	})
+}
+
+// respondWithRedemptionError responds with 409 Conflict when the balance is too low,
+// 422 when the idempotency key was used for another redemption, and as for any
+// account error otherwise
+func respondWithRedemptionError(w http.ResponseWriter, log logger.Logger, err error) {
+	var insufficient *common.InsufficientPointsError
+	if errors.As(err, &insufficient) {
+		log.Info("Insufficient points", logger.F("balance", insufficient.Balance), logger.F("requested", insufficient.Requested))
+		common.RespondWithJSON(w, http.StatusConflict, common.JSONResponse{
+			Success: false,
+			Data:    map[string]int64{"balance": insufficient.Balance},
+			Error:   "Insufficient points",
+		})
+		return
+	}
+	var conflict *common.RedemptionConflictError
+	if errors.As(err, &conflict) {
+		log.Warn("Idempotency-Key reused with a different redemption", logger.F("idempotency_key", conflict.Key))
+		common.RespondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different redemption")
+		return
+	}
+	respondWithAccountError(w, log, err)
+}
@@ -0,0 +1,89 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestRedeemPoints(t *testing.T) {
+	server := newTestServer(t)
+	receipt := common.Receipt{ID: "1", Retailer: "Retailer A", PurchaseDate: "2023-11-25", PurchaseTime: "12:00", Total: "100.00", ClientID: "acme", UserID: "alice"}
+	if err := server.Store().AddSubmission(common.Submission{Receipt: receipt, Points: 100, At: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(authenticateFromHeaders)
+	router.HandleFunc("/users/{id}/redemptions", server.RedeemPoints).Methods("POST")
+	redeem := func(caller [3]string, user, key, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/users/"+user+"/redemptions", bytes.NewBufferString(body))
+		req.Header.Set("X-Client", caller[0])
+		req.Header.Set("X-User", caller[1])
+		req.Header.Set("X-Scopes", caller[2])
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	alice := [3]string{"acme", "alice", common.ScopeReceiptsWrite}
+
+	rr := redeem(alice, "alice", "order-1", `{"points": 60, "reason": "Gift card"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data common.LedgerEntry `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Data.Type != common.LedgerRedeem || response.Data.Points != -60 || response.Data.Balance != 40 || response.Data.Reason != "Gift card" {
+		t.Errorf("unexpected redemption entry %+v", response.Data)
+	}
+
+	// A retry replays the redemption instead of spending again
+	rr = redeem(alice, "alice", "order-1", `{"points": 60, "reason": "Gift card"}`)
+	if rr.Code != http.StatusCreated || rr.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected a replayed redemption, got %d with headers %v", rr.Code, rr.Header())
+	}
+	if account, _ := server.Store().GetAccount("alice"); account.Balance != 40 {
+		t.Errorf("expected a balance of 40 after the retry, got %d", account.Balance)
+	}
+
+	tests := []struct {
+		description string
+		caller      [3]string
+		user        string
+		key         string
+		body        string
+		status      int
+	}{
+		{"more than the balance", alice, "alice", "order-2", `{"points": 41}`, http.StatusConflict},
+		{"key reused", alice, "alice", "order-1", `{"points": 10}`, http.StatusUnprocessableEntity},
+		{"no key", alice, "alice", "", `{"points": 10}`, http.StatusBadRequest},
+		{"no points", alice, "alice", "order-3", `{"points": 0}`, http.StatusBadRequest},
+		{"malformed body", alice, "alice", "order-3", `{"points": "ten"}`, http.StatusBadRequest},
+		{"another user", [3]string{"acme", "bob", common.ScopeReceiptsWrite}, "alice", "order-3", `{"points": 10}`, http.StatusNotFound},
+		{"client without a user", [3]string{"acme", "", common.ScopeReceiptsWrite}, "alice", "order-3", `{"points": 10}`, http.StatusForbidden},
+		{"admin of another client", [3]string{"globex", "", common.ScopePointsAdmin}, "alice", "order-3", `{"points": 10}`, http.StatusNotFound},
+		{"admin of the user's client", [3]string{"acme", "", common.ScopePointsAdmin}, "alice", "order-3", `{"points": 10}`, http.StatusCreated},
+		{"unauthenticated", [3]string{}, "alice", "order-4", `{"points": 10}`, http.StatusUnauthorized},
+		{"no account", [3]string{"acme", "bob", common.ScopeReceiptsWrite}, "bob", "order-1", `{"points": 10}`, http.StatusNotFound},
+		{"system account", alice, common.AccountIssued, "order-1", `{"points": 10}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rr := redeem(tt.caller, tt.user, tt.key, tt.body); rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.description, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+	if account, _ := server.Store().GetAccount("alice"); account.Balance != 30 {
+		t.Errorf("expected only the admin redemption to spend, got a balance of %d", account.Balance)
+	}
+}
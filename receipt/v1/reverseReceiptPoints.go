@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// reversalRequest is the body of a points reversal
+type reversalRequest struct {
+	Reason string `json:"reason"` // Why the points are taken back, e.g. "fraud"
+}
+
+// ReverseReceiptPoints takes back the points a receipt credited to its user, for
+// example when the receipt turns out to be fraudulent. Points already spent are
+// recorded as the reversal's shortfall; repeating a reversal takes back what it can
+// of the shortfall, or returns the last reversal.
+func (s *Server) ReverseReceiptPoints(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	if !authorizeLedgerChange(w, r, log, false) || !s.authorizeReceipt(w, r, log, receiptID) {
+		return
+	}
+
+	var request reversalRequest
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.respondWithDecodeError(w, log, err)
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		common.RespondWithError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+
+	entry, err := s.store.ReverseReceiptCredit(receiptID, request.Reason, s.clock.Now())
+	if err != nil {
+		var noCredit *common.CreditNotFoundError
+		if errors.As(err, &noCredit) {
+			log.Info("Receipt credited no points")
+			common.RespondWithError(w, http.StatusConflict, "Receipt credited no points")
+			return
+		}
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+
+	log.Info("Receipt points reversed", logger.F(logger.KeyUserID, entry.UserID), logger.F("points", -entry.Points))
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    entry,
+	})
+}
@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+func TestReverseReceiptPoints(t *testing.T) {
+	server := newTestServer(t)
+	credited := common.Receipt{ID: "1", Retailer: "Retailer A", PurchaseDate: "2023-11-25", PurchaseTime: "12:00", Total: "100.00", ClientID: "acme", UserID: "alice"}
+	anonymous := common.Receipt{ID: "2", Retailer: "Retailer B", PurchaseDate: "2023-11-25", PurchaseTime: "12:00", Total: "100.00", ClientID: "acme"}
+	server.Store().AddSubmission(common.Submission{Receipt: credited, Points: 75, At: time.Now()})
+	server.Store().AddSubmission(common.Submission{Receipt: anonymous, Points: 75, At: time.Now()})
+
+	router := mux.NewRouter()
+	router.Use(authenticateFromHeaders)
+	router.HandleFunc("/receipts/{id}/reversal", server.ReverseReceiptPoints).Methods("POST")
+
+	admin := [2]string{"acme", common.ScopePointsAdmin}
+	tests := []struct {
+		description string
+		caller      [2]string
+		id          string
+		body        string
+		status      int
+	}{
+		{"unauthenticated", [2]string{}, "1", `{"reason": "fraud"}`, http.StatusUnauthorized},
+		{"without points:admin", [2]string{"acme", common.ScopeReceiptsWrite}, "1", `{"reason": "fraud"}`, http.StatusForbidden},
+		{"another client", [2]string{"globex", common.ScopePointsAdmin}, "1", `{"reason": "fraud"}`, http.StatusNotFound},
+		{"no reason", admin, "1", `{}`, http.StatusBadRequest},
+		{"fraudulent receipt", admin, "1", `{"reason": "fraud"}`, http.StatusOK},
+		{"reversed again", admin, "1", `{"reason": "fraud"}`, http.StatusOK},
+		{"receipt credited nobody", admin, "2", `{"reason": "fraud"}`, http.StatusConflict},
+		{"unknown receipt", admin, "3", `{"reason": "fraud"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/receipts/"+tt.id+"/reversal", bytes.NewBufferString(tt.body))
+		req.Header.Set("X-Client", tt.caller[0])
+		req.Header.Set("X-Scopes", tt.caller[1])
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.description, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	account, _ := server.Store().GetAccount("alice")
+	entries, _ := server.Store().ListLedgerEntries("alice")
+	if account.Balance != 0 || len(entries) != 2 || entries[1].Reason != "fraud" {
+		t.Errorf("expected one reversal bringing alice to 0, got balance %d and entries %+v", account.Balance, entries)
+	}
+}
@@ -0,0 +1,196 @@
+package v1
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/ethirajmudhaliar/GH-risk-api/rules"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PointsCalculator computes the points awarded for a receipt.
+// Errors report receipt values the calculator cannot interpret, such as malformed amounts.
+type PointsCalculator interface {
+	CalculatePoints(receipt common.Receipt) (int64, error)
+	Breakdown(receipt common.Receipt) ([]common.RuleResult, error)
+}
+
+// PointsCalculatorFunc adapts a plain function to the PointsCalculator interface.
+type PointsCalculatorFunc func(receipt common.Receipt) (int64, error)
+
+// CalculatePoints calls f(receipt).
+func (f PointsCalculatorFunc) CalculatePoints(receipt common.Receipt) (int64, error) {
+	return f(receipt)
+}
+
+// Breakdown reports the points of f(receipt) as a single rule result.
+func (f PointsCalculatorFunc) Breakdown(receipt common.Receipt) ([]common.RuleResult, error) {
+	points, err := f(receipt)
+	if err != nil {
+		return nil, err
+	}
+	return []common.RuleResult{{Rule: "custom", Matched: points != 0, Points: points}}, nil
+}
+
+// DefaultPointsCalculator applies the standard receipt points rules.
+var DefaultPointsCalculator PointsCalculator = rules.Default()
+
+// Server holds the dependencies shared by the receipt handlers.
+type Server struct {
+	store       common.ReceiptStore
+	points      PointsCalculator
+	logger      logger.Logger
+	clock       common.Clock
+	consistency validation.ConsistencyOptions
+
+	idempotencyWindow time.Duration
+	allowDuplicates   bool
+	batchLimit        int
+	maxBodyBytes      int64
+	maxBatchBodyBytes int64
+
+	pointsMaxAge       time.Duration
+	expiringSoonWindow time.Duration
+
+	build    BuildInfo
+	draining atomic.Bool
+	metrics  *Metrics
+}
+
+// DefaultIdempotencyWindow is how long an Idempotency-Key replays its original response.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// DefaultBatchLimit is the maximum number of receipts accepted in one batch submission.
+const DefaultBatchLimit = 500
+
+// Default request body limits, in bytes
+const (
+	DefaultMaxBodyBytes      = 1 << 20  // Single-receipt endpoints
+	DefaultMaxBatchBodyBytes = 32 << 20 // Batch submissions
+)
+
+// DefaultExpiringSoonWindow is how far ahead GET /users/{id}/expiring looks.
+const DefaultExpiringSoonWindow = 30 * 24 * time.Hour
+
+// Option configures optional Server settings.
+type Option func(*Server)
+
+// WithConsistency sets the cross-field consistency checks applied to submitted receipts.
+func WithConsistency(opts validation.ConsistencyOptions) Option {
+	return func(s *Server) {
+		s.consistency = opts
+	}
+}
+
+// WithIdempotencyWindow sets how long an Idempotency-Key replays its original response.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(s *Server) {
+		s.idempotencyWindow = window
+	}
+}
+
+// WithDuplicates sets whether a submitted receipt with the same content as a stored
+// receipt is stored too, rather than refused with 409 Conflict.
+func WithDuplicates(allow bool) Option {
+	return func(s *Server) {
+		s.allowDuplicates = allow
+	}
+}
+
+// WithBatchLimit sets the maximum number of receipts accepted in one batch submission.
+func WithBatchLimit(limit int) Option {
+	return func(s *Server) {
+		s.batchLimit = limit
+	}
+}
+
+// WithBodyLimits sets the largest request body accepted by the single-receipt
+// endpoints and by batch submissions, in bytes.
+func WithBodyLimits(maxBodyBytes, maxBatchBodyBytes int64) Option {
+	return func(s *Server) {
+		s.maxBodyBytes = maxBodyBytes
+		s.maxBatchBodyBytes = maxBatchBodyBytes
+	}
+}
+
+// WithBuildInfo sets the version and commit reported by the version endpoint.
+func WithBuildInfo(version, commit string) Option {
+	return func(s *Server) {
+		s.build.Version = version
+		s.build.Commit = commit
+	}
+}
+
+// WithPointsExpiry sets how long earned points last, and how far ahead
+// GetUserExpiringPoints looks. Points never expire with a zero maxAge.
+func WithPointsExpiry(maxAge, soonWindow time.Duration) Option {
+	return func(s *Server) {
+		s.pointsMaxAge = maxAge
+		s.expiringSoonWindow = soonWindow
+	}
+}
+
+// WithMetrics sets the metrics the server records to.
+func WithMetrics(m *Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// NewServer creates a Server from its dependencies.
+// Nil dependencies fall back to a fresh in-memory store, the default points
+// calculator, the default logger and the system clock.
+func NewServer(store common.ReceiptStore, points PointsCalculator, log logger.Logger, clock common.Clock, opts ...Option) *Server {
+	if store == nil {
+		store = common.NewReceiptStorage()
+	}
+	if points == nil {
+		points = DefaultPointsCalculator
+	}
+	if log == nil {
+		log = logger.Default
+	}
+	if clock == nil {
+		clock = common.SystemClock{}
+	}
+	s := &Server{
+		store:       store,
+		points:      points,
+		logger:      log,
+		clock:       clock,
+		consistency: validation.DefaultConsistencyOptions,
+
+		idempotencyWindow: DefaultIdempotencyWindow,
+		batchLimit:        DefaultBatchLimit,
+		maxBodyBytes:      DefaultMaxBodyBytes,
+		maxBatchBodyBytes: DefaultMaxBatchBodyBytes,
+
+		expiringSoonWindow: DefaultExpiringSoonWindow,
+
+		build:   BuildInfo{Version: "dev", Commit: "unknown"},
+		metrics: NewMetrics(prometheus.NewRegistry()),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// requestLogger returns the server logger adding the fields attached to the request context.
+func (s *Server) requestLogger(r *http.Request) logger.Logger {
+	return logger.FromContext(r.Context(), s.logger)
+}
+
+// Metrics returns the metrics recorded by the server.
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// Store returns the receipt store used by the server.
+func (s *Server) Store() common.ReceiptStore {
+	return s.store
+}
@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// Helper middleware authenticating each request as the client, user and scopes
+// named in its X-Client, X-User and X-Scopes headers; requests without X-Client
+// stay unauthenticated
+func authenticateFromHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client := r.Header.Get("X-Client"); client != "" {
+			principal := common.Principal{ClientID: client, UserID: r.Header.Get("X-User"), Scopes: strings.Fields(r.Header.Get("X-Scopes"))}
+			r = r.WithContext(common.WithPrincipal(r.Context(), principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Helper function to build an isolated server with a fresh in-memory store
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	return NewServer(
+		common.NewReceiptStorage(),
+		DefaultPointsCalculator,
+		logger.New(log.New(io.Discard, "", 0)),
+		common.FixedClock{Time: time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)},
+	)
+}
+
+func TestServersAreIsolated(t *testing.T) {
+	first := newTestServer(t)
+	second := newTestServer(t)
+
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "50.00"}]}`
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	first.SubmitReceipt(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if _, err := first.Store().GetAllReceipts(); err != nil {
+		t.Errorf("expected the receipt in the first server's store, got: %v", err)
+	}
+	if _, err := second.Store().GetAllReceipts(); err == nil {
+		t.Errorf("expected the second server's store to be empty")
+	}
+}
+
+func TestServerUsesInjectedCalculator(t *testing.T) {
+	server := NewServer(nil, PointsCalculatorFunc(func(common.Receipt) (int64, error) { return 42, nil }), logger.New(log.New(io.Discard, "", 0)), nil)
+
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "50.00"}]}`
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	server.SubmitReceipt(rr, req)
+
+	receipts, err := server.Store().GetAllReceipts()
+	if err != nil {
+		t.Fatalf("expected a stored receipt, got: %v", err)
+	}
+	points, _ := server.Store().GetReceiptPoints(receipts[0].ID)
+	if points != 42 {
+		t.Errorf("expected points from injected calculator 42, got %d", points)
+	}
+}
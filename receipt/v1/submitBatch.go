@@ -0,0 +1,183 @@
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// BatchResult is the outcome of one receipt in a batch submission
+type BatchResult struct {
+	Index  int                  `json:"index"`            // Position of the receipt in the batch, from 0
+	Line   int                  `json:"line,omitempty"`   // Line number of the receipt in an NDJSON batch, from 1
+	Status int                  `json:"status"`           // HTTP status the receipt would get from POST /receipts/process
+	ID     string               `json:"id,omitempty"`     // ID of the stored receipt, or of the existing one for a duplicate
+	Error  string               `json:"error,omitempty"`  // Why the receipt was rejected
+	Errors []common.ErrorDetail `json:"errors,omitempty"` // Every validation problem of a rejected receipt
+}
+
+// BatchResponse is the response payload of a batch submission
+type BatchResponse struct {
+	Accepted int           `json:"accepted"` // Number of receipts stored
+	Rejected int           `json:"rejected"` // Number of receipts rejected
+	Results  []BatchResult `json:"results"`  // Outcome of each receipt, in batch order
+}
+
+// batchEntry is one receipt read from a batch, or the error that prevented reading it
+type batchEntry struct {
+	line    int
+	receipt common.Receipt
+	err     error
+}
+
+// errBatchTooLarge is returned when a batch holds more receipts than the limit
+var errBatchTooLarge = errors.New("batch too large")
+
+// SubmitBatch handles the submission of many receipts at once, as a JSON array or as
+// NDJSON (one receipt per line). Each receipt goes through the same validation, scoring
+// and storage as SubmitReceipt; receipts that fail are reported without affecting the rest.
+func (s *Server) SubmitBatch(w http.ResponseWriter, r *http.Request) {
+	log := s.requestLogger(r)
+	entries, err := s.readBatch(http.MaxBytesReader(w, r.Body, s.maxBatchBodyBytes))
+	if errors.Is(err, errBatchTooLarge) {
+		log.Warn("Batch exceeds the receipt limit", logger.F("limit", s.batchLimit))
+		common.RespondWithError(w, http.StatusRequestEntityTooLarge, "Batch exceeds the limit of "+strconv.Itoa(s.batchLimit)+" receipts")
+		return
+	}
+	if err != nil {
+		s.respondWithDecodeError(w, log, err)
+		return
+	}
+	if len(entries) == 0 {
+		common.RespondWithError(w, http.StatusBadRequest, "Batch contains no receipts")
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchResult, len(entries))}
+	for i, entry := range entries {
+		result := s.submitBatchEntry(log.With(logger.F("index", i)), requestClient(r), requestUser(r), entry)
+		result.Index = i
+		result.Line = entry.line
+		if result.Status == http.StatusCreated {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+		response.Results[i] = result
+	}
+
+	log.Info("Batch processed", logger.F("accepted", response.Accepted), logger.F("rejected", response.Rejected))
+
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: response.Rejected == 0,
+		Data:    response,
+	})
+}
+
+// submitBatchEntry runs one receipt of a batch through the SubmitReceipt pipeline
+func (s *Server) submitBatchEntry(log logger.Logger, clientID, userID string, entry batchEntry) BatchResult {
+	var tooLarge *http.MaxBytesError
+	if errors.As(entry.err, &tooLarge) {
+		return BatchResult{Status: http.StatusRequestEntityTooLarge, Error: "Receipt exceeds " + strconv.FormatInt(tooLarge.Limit, 10) + " bytes"}
+	}
+	if entry.err != nil {
+		return BatchResult{Status: http.StatusBadRequest, Error: "Invalid request payload"}
+	}
+
+	receipt := entry.receipt
+	receipt.ID = "" // Assigned by the server
+	receipt.ClientID = clientID
+	receipt.UserID = userID
+	outcome := s.submit(log, receipt, "")
+	return BatchResult{Status: outcome.status, ID: outcome.id, Error: outcome.message, Errors: outcome.errors}
+}
+
+// readBatch reads the receipts of a batch. A body starting with '[' is a JSON array,
+// anything else is NDJSON. A malformed NDJSON line only fails its own entry, while a
+// malformed JSON array fails the whole batch.
+func (s *Server) readBatch(body io.Reader) ([]batchEntry, error) {
+	reader := bufio.NewReader(body)
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first == '[' {
+		return s.readJSONBatch(reader)
+	}
+	return s.readNDJSONBatch(reader)
+}
+
+// readJSONBatch decodes a JSON array of receipts one element at a time
+func (s *Server) readJSONBatch(reader io.Reader) ([]batchEntry, error) {
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	var entries []batchEntry
+	for decoder.More() {
+		if len(entries) == s.batchLimit {
+			return nil, errBatchTooLarge
+		}
+		var receipt common.Receipt
+		if err := decoder.Decode(&receipt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, batchEntry{receipt: receipt})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readNDJSONBatch decodes one receipt per non-blank line. A line longer than the
+// single-receipt body limit fails its own entry with an *http.MaxBytesError.
+func (s *Server) readNDJSONBatch(reader *bufio.Reader) ([]batchEntry, error) {
+	var entries []batchEntry
+	for line := 1; ; line++ {
+		text, tooLong, err := common.ReadLine(reader, s.maxBodyBytes)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		text = bytes.TrimSpace(text)
+		if len(text) > 0 || tooLong {
+			if len(entries) == s.batchLimit {
+				return nil, errBatchTooLarge
+			}
+			entry := batchEntry{line: line}
+			if tooLong {
+				entry.err = &http.MaxBytesError{Limit: s.maxBodyBytes}
+			} else {
+				entry.err = json.Unmarshal(text, &entry.receipt)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte without consuming it
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+)
+
+// Helper function to submit a batch and decode its results
+func submitBatch(t *testing.T, server *Server, body string) (*httptest.ResponseRecorder, BatchResponse) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/receipts/batch", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	server.SubmitBatch(rr, req)
+
+	var response struct {
+		Data BatchResponse `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return rr, response.Data
+}
+
+func TestSubmitBatchJSONArray(t *testing.T) {
+	server := newTestServer(t)
+
+	body := `[
+		{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]},
+		{"retailer": "", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "abc", "items": [{"shortDescription": "Item A", "price": "10.00"}]},
+		{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}
+	]`
+	rr, batch := submitBatch(t, server, body)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if batch.Accepted != 1 || batch.Rejected != 2 || len(batch.Results) != 3 {
+		t.Fatalf("expected 1 accepted and 2 rejected, got: %+v", batch)
+	}
+
+	first, invalid, duplicate := batch.Results[0], batch.Results[1], batch.Results[2]
+	if first.Status != http.StatusCreated || first.ID == "" {
+		t.Errorf("expected the first receipt to be stored, got: %+v", first)
+	}
+	if points, err := server.Store().GetReceiptPoints(first.ID); err != nil || points == 0 {
+		t.Errorf("expected the stored receipt to be scored, got %d (%v)", points, err)
+	}
+	if invalid.Index != 1 || invalid.Status != http.StatusBadRequest || len(invalid.Errors) != 2 {
+		t.Errorf("expected both validation errors of the second receipt, got: %+v", invalid)
+	}
+	if duplicate.Status != http.StatusConflict || duplicate.ID != first.ID {
+		t.Errorf("expected the third receipt to duplicate the first, got: %+v", duplicate)
+	}
+}
+
+func TestSubmitBatchNDJSON(t *testing.T) {
+	server := newTestServer(t)
+
+	body := strings.Join([]string{
+		`{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+		``,
+		`{"retailer": "Target", "purchaseDate"`,
+		`{"retailer": "Walgreens", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "5.00", "items": [{"shortDescription": "Item B", "price": "5.00"}]}`,
+	}, "\n")
+	rr, batch := submitBatch(t, server, body)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if batch.Accepted != 2 || batch.Rejected != 1 {
+		t.Fatalf("expected 2 accepted and 1 rejected, got: %+v", batch)
+	}
+	if malformed := batch.Results[1]; malformed.Line != 3 || malformed.Status != http.StatusBadRequest {
+		t.Errorf("expected the malformed line 3 to be rejected, got: %+v", malformed)
+	}
+	if last := batch.Results[2]; last.Index != 2 || last.Line != 4 || last.Status != http.StatusCreated {
+		t.Errorf("expected the receipt on line 4 to be stored, got: %+v", last)
+	}
+}
+
+func TestSubmitBatchNDJSONLineTooLong(t *testing.T) {
+	server := NewServer(nil, nil, logger.New(log.New(io.Discard, "", 0)), nil, WithBodyLimits(256, 1<<20))
+
+	receipt := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	long := `{"retailer": "` + strings.Repeat("A", 8192) + `", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "5.00", "items": [{"shortDescription": "Item B", "price": "5.00"}]}`
+	rr, batch := submitBatch(t, server, strings.Join([]string{long, receipt}, "\n"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if batch.Accepted != 1 || batch.Rejected != 1 {
+		t.Fatalf("expected 1 accepted and 1 rejected, got: %+v", batch)
+	}
+	if first := batch.Results[0]; first.Line != 1 || first.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the long line to be rejected on its own, got: %+v", first)
+	}
+	if second := batch.Results[1]; second.Line != 2 || second.Status != http.StatusCreated {
+		t.Errorf("expected the receipt after the long line to be stored, got: %+v", second)
+	}
+}
+
+func TestSubmitBatchUsesSubmitPipeline(t *testing.T) {
+	server := newTestServer(t)
+
+	// Scoring failures and missing fields are reported as SubmitReceipt reports them
+	body := `[
+		{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "50000000000000.00", "items": [{"shortDescription": "abc", "price": "50000000000000.00"}]},
+		{"purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}
+	]`
+	_, batch := submitBatch(t, server, body)
+
+	if len(batch.Results) != 2 {
+		t.Fatalf("expected 2 results, got: %+v", batch)
+	}
+	if unscored := batch.Results[0]; unscored.Status != http.StatusBadRequest || !strings.HasPrefix(unscored.Error, "Could not calculate points") {
+		t.Errorf("expected the first receipt to fail scoring, got: %+v", unscored)
+	}
+	if missing := batch.Results[1]; missing.Status != http.StatusBadRequest || missing.Error != "Missing required fields" {
+		t.Errorf("expected the second receipt to miss its retailer, got: %+v", missing)
+	}
+}
+
+func TestSubmitBatchLimit(t *testing.T) {
+	server := NewServer(nil, nil, logger.New(log.New(io.Discard, "", 0)), nil, WithBatchLimit(1))
+
+	receipt := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	rr, _ := submitBatch(t, server, "["+receipt+","+receipt+"]")
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if _, err := server.Store().GetAllReceipts(); err == nil {
+		t.Errorf("expected nothing to be stored from a rejected batch")
+	}
+}
+
+func TestSubmitBatchInvalid(t *testing.T) {
+	server := newTestServer(t)
+
+	for _, body := range []string{"", "   ", `[{"retailer": }]`, `[]`} {
+		rr, _ := submitBatch(t, server, body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	var response common.JSONResponse
+	rr, _ := submitBatch(t, server, `[]`)
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Error != "Batch contains no receipts" {
+		t.Errorf("unexpected error: %q", response.Error)
+	}
+}
@@ -2,10 +2,10 @@ package v1
 
 import (
 	"encoding/json"
-	"math"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/ethirajmudhaliar/GH-risk-api/common"
 	"github.com/ethirajmudhaliar/GH-risk-api/logger"
@@ -13,168 +13,252 @@ import (
 	"github.com/google/uuid"
 )
 
+// Headers used for idempotent submissions
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"     // Client-chosen key identifying a submission across retries
+	IdempotentReplayedHeader = "Idempotent-Replayed" // Set on responses replayed from an earlier request
+
+	maxIdempotencyKeyLength = 255
+)
+
 // SubmitReceipt handles the submission of a receipt for processing
-func SubmitReceipt(w http.ResponseWriter, r *http.Request) {
+func (s *Server) SubmitReceipt(w http.ResponseWriter, r *http.Request) {
 	var newReceipt common.Receipt
+	log := s.requestLogger(r)
 
 	// Parse the JSON body
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
 	err := json.NewDecoder(r.Body).Decode(&newReceipt)
 	if err != nil {
-		logger.Error("Error decoding request body: " + err.Error())
-		common.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		s.respondWithDecodeError(w, log, err)
 		return
 	}
 
-	// Validate required fields in the receipt
-	if newReceipt.Retailer == "" || newReceipt.PurchaseDate == "" || newReceipt.PurchaseTime == "" || newReceipt.Total == "" || len(newReceipt.Items) == 0 {
-		logger.Error("Missing required fields in receipt submission")
-		common.RespondWithError(w, http.StatusBadRequest, "Missing required fields")
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		common.RespondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
 		return
 	}
-
-	// Validate receipt fields using the validation package
-	if err := validation.ValidateReceipt(
-		newReceipt.Retailer,
-		newReceipt.PurchaseDate,
-		newReceipt.PurchaseTime,
-		newReceipt.Total,
-		convertItemsToMap(newReceipt.Items),
-	); err != nil {
-		logger.Error("Validation error: " + err.Error())
-		common.RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	// Generate a new UUID for the receipt ID
-	newReceipt.ID = generateUniqueID()
-
-	// Calculate points (replace with your logic)
-	points := calculatePoints(newReceipt)
-
-	// Add the new receipt to the in-memory storage
-	if err := common.Storage.AddReceipt(newReceipt, points); err != nil {
-		logger.Error("Error adding receipt to storage: " + err.Error())
-		common.RespondWithError(w, http.StatusInternalServerError, "Could not store the receipt")
-		return
+	if idempotencyKey != "" {
+		idempotencyKey = scopedIdempotencyKey(r, idempotencyKey)
 	}
 
-	logger.Info("Receipt submitted successfully with ID: " + newReceipt.ID)
+	newReceipt.ID = "" // Assigned by the server
+	newReceipt.ClientID = requestClient(r)
+	newReceipt.UserID = requestUser(r)
+	respondWithOutcome(w, s.submit(log, newReceipt, idempotencyKey))
+}
 
-	// Respond with the newly created receipt ID
-	response := common.JSONResponse{
-		Success: true,
-		Data:    map[string]string{"id": newReceipt.ID},
-	}
-	common.RespondWithJSON(w, http.StatusCreated, response)
+// Import stores a receipt exported from another store, such as by receiptctl,
+// through the same validation, scoring and duplicate policy as SubmitReceipt. The
+// receipt keeps its ID, client and user; an empty ID gets a new one. It returns the
+// receipt ID, or the error that rejected the receipt: validation.Errors, a
+// *ScoringError, a *common.DuplicateReceiptError or a store error.
+func (s *Server) Import(receipt common.Receipt) (string, error) {
+	outcome := s.submit(s.logger, receipt, "")
+	return outcome.id, outcome.err
 }
 
-// calculatePoints is a placeholder function to calculate receipt points
+// submitOutcome is the result of running one receipt through the submission pipeline
+type submitOutcome struct {
+	status   int               // HTTP status of the outcome
+	id       string            // Stored receipt, original of a replay, or existing duplicate
+	message  string            // Why the receipt was rejected
+	errors   validation.Errors // Every validation problem of a rejected receipt
+	replayed bool              // Whether the outcome is replayed from an earlier request with the same Idempotency-Key
+	err      error             // Why the receipt was rejected, before it is turned into a response
+}
 
-func calculatePoints(receipt common.Receipt) int64 {
-	points := int64(0)
+// submit validates, scores and stores a receipt, as SubmitReceipt, every entry of
+// SubmitBatch and Import do. A receipt without an ID gets a new one. A non-empty idempotencyKey, already scoped to the caller, is recorded
+// with the receipt so a retry replays the outcome instead of storing a second copy.
+func (s *Server) submit(log logger.Logger, receipt common.Receipt, idempotencyKey string) submitOutcome {
+	evaluation, err := s.evaluate(log, receipt)
+	if err != nil {
+		return rejectedOutcome(err)
+	}
 
-	// Rule 1: 1 point for each alphanumeric character in the retailer name
-	for _, char := range receipt.Retailer {
-		if isAlphanumeric(char) {
-			points++
+	// Generate a new UUID for the receipt ID
+	if receipt.ID == "" {
+		if receipt.ID, err = s.generateUniqueID(); err != nil {
+			log.Error("Error generating a receipt ID", logger.Err(err))
+			return submitOutcome{status: http.StatusInternalServerError, message: "Could not store the receipt", err: err}
 		}
 	}
+	log = log.With(logger.F(logger.KeyReceiptID, receipt.ID))
 
-	// Rule 2: 50 points if the total is a round dollar amount
-	if isRoundDollar(receipt.Total) {
-		points += 50
+	// Reserve the Idempotency-Key together with the receipt, so a retry racing this
+	// request replays its outcome instead of storing a second copy
+	now := s.clock.Now()
+	submission := common.Submission{Receipt: receipt, Points: evaluation.Points, Breakdown: evaluation.Breakdown, At: now, AllowDuplicates: s.allowDuplicates}
+	fingerprint := common.Fingerprint(receipt)
+	if idempotencyKey != "" {
+		submission.Idempotency = common.IdempotencyRecord{
+			Key:                idempotencyKey,
+			ReceiptID:          receipt.ID,
+			Status:             http.StatusCreated,
+			RequestFingerprint: fingerprint,
+			CreatedAt:          now,
+		}
+		submission.IdempotencySince = now.Add(-s.idempotencyWindow)
 	}
 
-	// Rule 3: 25 points if the total is a multiple of 0.25
-	if isMultipleOf(receipt.Total, 0.25) {
-		points += 25
+	// Add the new receipt to the configured storage
+	if err := s.store.AddSubmission(submission); err != nil {
+		return storeFailureOutcome(log, err, fingerprint)
 	}
 
-	// Rule 4: 5 points for every two items on the receipt
-	points += int64(len(receipt.Items) / 2 * 5)
+	log.Info("Receipt submitted", logger.F("points", evaluation.Points))
+	s.metrics.recordStored(evaluation.Breakdown)
+	return submitOutcome{status: http.StatusCreated, id: receipt.ID}
+}
 
-	// Rule 5: Points for items with description length as multiple of 3
-	for _, item := range receipt.Items {
-		descLength := len(strings.TrimSpace(item.ShortDescription))
-		if descLength%3 == 0 {
-			itemPrice := parsePrice(item.Price)
-			points += int64(math.Ceil(itemPrice * 0.2))
-		}
+// rejectedOutcome describes a receipt that failed validation or could not be scored
+func rejectedOutcome(err error) submitOutcome {
+	var scoringErr *ScoringError
+	if errors.As(err, &scoringErr) {
+		return submitOutcome{status: http.StatusBadRequest, message: "Could not calculate points: " + scoringErr.Err.Error(), err: err}
 	}
-
-	// Rule 6: 6 points if the purchase day is odd
-	if isOddDay(receipt.PurchaseDate) {
-		points += 6
+	errs, ok := err.(validation.Errors)
+	if !ok {
+		return submitOutcome{status: http.StatusBadRequest, message: err.Error(), err: err}
 	}
-
-	// Rule 7: 10 points if the purchase time is between 2:00 PM and 4:00 PM
-	if isAfternoon(receipt.PurchaseTime) {
-		points += 10
+	message := "Validation failed"
+	if errs.HasCode(validation.CodeRequired) {
+		message = "Missing required fields"
 	}
-
-	return points
+	return submitOutcome{status: http.StatusBadRequest, message: message, errors: errs, err: err}
 }
 
-// Helper function to check if a character is alphanumeric
-func isAlphanumeric(char rune) bool {
-	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+// storeFailureOutcome describes a receipt the store refused. An Idempotency-Key
+// already used for the same receipt replays the original outcome, and one used for a
+// different receipt is rejected with 422.
+func storeFailureOutcome(log logger.Logger, err error, fingerprint string) submitOutcome {
+	var usedErr *common.IdempotencyKeyUsedError
+	if errors.As(err, &usedErr) {
+		record := usedErr.Record
+		if record.RequestFingerprint != fingerprint {
+			log.Warn("Idempotency-Key reused with a different receipt", logger.F("idempotency_key", record.Key))
+			return submitOutcome{status: http.StatusUnprocessableEntity, message: "Idempotency-Key was already used for a different receipt", err: err}
+		}
+		log.Info("Replaying idempotent submission", logger.F("original_id", record.ReceiptID))
+		return submitOutcome{status: record.Status, id: record.ReceiptID, replayed: true}
+	}
+	var dupErr *common.DuplicateReceiptError
+	if errors.As(err, &dupErr) {
+		log.Info("Duplicate receipt submission", logger.F("existing_id", dupErr.ExistingID))
+		return submitOutcome{status: http.StatusConflict, id: dupErr.ExistingID, message: "Duplicate receipt", err: err}
+	}
+	log.Error("Error adding receipt to storage", logger.Err(err))
+	return submitOutcome{status: http.StatusInternalServerError, message: "Could not store the receipt", err: err}
 }
 
-// Helper function to check if the total is a round dollar amount
-func isRoundDollar(total string) bool {
-	price := parsePrice(total)
-	return price == float64(int(price))
+// respondWithOutcome sends the response of a single receipt submission
+func respondWithOutcome(w http.ResponseWriter, outcome submitOutcome) {
+	if outcome.replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	switch {
+	case outcome.message == "":
+		common.RespondWithJSON(w, outcome.status, common.JSONResponse{
+			Success: true,
+			Data:    map[string]string{"id": outcome.id},
+		})
+	case outcome.id != "":
+		common.RespondWithJSON(w, outcome.status, common.JSONResponse{
+			Success: false,
+			Data:    map[string]string{"id": outcome.id},
+			Error:   outcome.message,
+		})
+	case len(outcome.errors) > 0:
+		common.RespondWithErrors(w, outcome.status, outcome.message, outcome.errors)
+	default:
+		common.RespondWithError(w, outcome.status, outcome.message)
+	}
 }
 
-// Helper function to check if the total is a multiple of a given factor
-func isMultipleOf(total string, factor float64) bool {
-	price := parsePrice(total)
-	return math.Mod(price, factor) == 0
+// scopedIdempotencyKey returns the key an Idempotency-Key is stored under, so that
+// clients and their users cannot replay each other's submissions. The client and
+// user are length-prefixed, so the keys of different callers never collide.
+func scopedIdempotencyKey(r *http.Request, key string) string {
+	principal, ok := common.PrincipalFromContext(r.Context())
+	if !ok {
+		return key
+	}
+	return fmt.Sprintf("%d:%s%d:%s%s", len(principal.ClientID), principal.ClientID, len(principal.UserID), principal.UserID, key)
 }
 
-// Helper function to parse a price string into a float
-func parsePrice(price string) float64 {
-	parsedPrice, _ := strconv.ParseFloat(price, 64)
-	return parsedPrice
+// evaluateReceipt validates and scores a receipt like EvaluateReceipt, responding
+// with every problem found. It reports whether the receipt may be stored.
+func (s *Server) evaluateReceipt(w http.ResponseWriter, log logger.Logger, receipt common.Receipt) (Evaluation, bool) {
+	evaluation, err := s.evaluate(log, receipt)
+	if err != nil {
+		respondWithOutcome(w, rejectedOutcome(err))
+		return Evaluation{}, false
+	}
+	return evaluation, true
 }
 
-// Helper function to check if the purchase day is odd
-func isOddDay(date string) bool {
-	parts := strings.Split(date, "-")
-	if len(parts) < 3 {
-		return false
+// evaluate validates and scores a receipt with EvaluateReceipt, logging its
+// consistency warnings and counting its validation failures
+func (s *Server) evaluate(log logger.Logger, receipt common.Receipt) (Evaluation, error) {
+	evaluation, err := EvaluateReceipt(receipt, s.points, s.consistency, s.clock.Now())
+	for _, warning := range evaluation.Warnings {
+		log.Warn("Consistency warning", logger.F("path", warning.Path), logger.F("code", warning.Code), logger.F("detail", warning.Message))
+	}
+	var scoringErr *ScoringError
+	switch {
+	case errors.As(err, &scoringErr):
+		log.Error("Error calculating points", logger.Err(scoringErr.Err))
+	case err != nil:
+		log.Warn("Validation error", logger.Err(err))
+		s.metrics.recordValidationFailure(err)
 	}
-	day, _ := strconv.Atoi(parts[2])
-	return day%2 != 0
+	return evaluation, err
 }
 
-// Helper function to check if the purchase time is between 2:00 PM and 4:00 PM
-func isAfternoon(time string) bool {
-	parts := strings.Split(time, ":")
-	if len(parts) < 2 {
+// respondIfDuplicate responds with 409 Conflict, pointing at the existing receipt,
+// if err reports a duplicate. It reports whether it responded.
+func (s *Server) respondIfDuplicate(w http.ResponseWriter, log logger.Logger, err error) bool {
+	var dupErr *common.DuplicateReceiptError
+	if !errors.As(err, &dupErr) {
 		return false
 	}
-	hour, _ := strconv.Atoi(parts[0])
-	return hour >= 14 && hour < 16
+	log.Info("Duplicate receipt submission", logger.F("existing_id", dupErr.ExistingID))
+	common.RespondWithJSON(w, http.StatusConflict, common.JSONResponse{
+		Success: false,
+		Data:    map[string]string{"id": dupErr.ExistingID},
+		Error:   "Duplicate receipt",
+	})
+	return true
 }
 
-func convertItemsToMap(items []common.Item) []map[string]string {
-	result := make([]map[string]string, len(items))
-	for i, item := range items {
-		result[i] = map[string]string{
-			"shortDescription": item.ShortDescription,
-			"price":            item.Price,
-		}
+// respondWithDecodeError responds with 413 when the request body exceeded its limit,
+// and 400 for any other malformed body
+func (s *Server) respondWithDecodeError(w http.ResponseWriter, log logger.Logger, err error) {
+	log.Warn("Error decoding request body", logger.Err(err))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		common.RespondWithError(w, http.StatusRequestEntityTooLarge, "Request body exceeds "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
 	}
-	return result
+	common.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 }
 
-// Helper function to generate a unique ID
-func generateUniqueID() string {
+// generateUniqueID returns a new receipt ID the store has never seen. Deleted
+// receipts keep their ID, so only a not-found lookup means an ID is free; any other
+// lookup failure is returned rather than risking a reused ID.
+func (s *Server) generateUniqueID() (string, error) {
 	for {
 		id := uuid.New().String()
-		if _, exists := common.Storage.Receipts[id]; !exists {
-			return id
+		_, err := s.store.GetReceiptByID(id)
+		var notFound *common.ReceiptNotFoundError
+		var deleted *common.ReceiptDeletedError
+		switch {
+		case errors.As(err, &notFound):
+			return id, nil
+		case err != nil && !errors.As(err, &deleted):
+			return "", err
 		}
 	}
 }
@@ -3,22 +3,23 @@ package v1
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/ethirajmudhaliar/GH-risk-api/validation"
 	"github.com/gorilla/mux"
 )
 
 func TestSubmitReceiptSuccess(t *testing.T) {
-	// Reset the global storage
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
-	}
+	server := newTestServer(t)
 
 	payload := `{
 		"retailer": "Retailer A",
@@ -37,7 +38,7 @@ func TestSubmitReceiptSuccess(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(SubmitReceipt)
+	handler := http.HandlerFunc(server.SubmitReceipt)
 
 	handler.ServeHTTP(rr, req)
 
@@ -65,12 +66,38 @@ func TestSubmitReceiptSuccess(t *testing.T) {
 	}
 }
 
-func TestSubmitReceiptMissingFields(t *testing.T) {
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
+// unavailableStore fails every receipt lookup, as a database that went away would
+type unavailableStore struct {
+	common.ReceiptStore
+}
+
+func (unavailableStore) GetReceiptByID(string) (common.Receipt, error) {
+	return common.Receipt{}, errors.New("database is locked")
+}
+
+func (unavailableStore) ListReceipts(common.ReceiptFilter) (common.ReceiptPage, error) {
+	return common.ReceiptPage{}, errors.New("database is locked")
+}
+
+func TestSubmitReceiptLookupFailure(t *testing.T) {
+	store := unavailableStore{common.NewReceiptStorage()}
+	server := NewServer(store, DefaultPointsCalculator, logger.New(log.New(io.Discard, "", 0)), nil)
+
+	// A failed lookup does not prove an ID unused, so nothing is stored
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	rr := httptest.NewRecorder()
+	server.SubmitReceipt(rr, httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload)))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if _, err := store.GetAllReceipts(); err == nil {
+		t.Errorf("expected nothing to be stored")
 	}
+}
+
+func TestSubmitReceiptMissingFields(t *testing.T) {
+	server := newTestServer(t)
 
 	payload := `{"retailer": "Retailer A"}`
 	req, err := http.NewRequest("POST", "/v1/receipts/process", bytes.NewBuffer([]byte(payload)))
@@ -79,7 +106,7 @@ func TestSubmitReceiptMissingFields(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(SubmitReceipt)
+	handler := http.HandlerFunc(server.SubmitReceipt)
 
 	handler.ServeHTTP(rr, req)
 
@@ -103,11 +130,7 @@ func TestSubmitReceiptMissingFields(t *testing.T) {
 }
 
 func TestSubmitReceiptInvalidPrice(t *testing.T) {
-	common.Storage = common.ReceiptStorage{
-		Receipts: make(map[string]common.Receipt),
-		Points:   make(map[string]int64),
-		Order:    []string{},
-	}
+	server := newTestServer(t)
 
 	payload := `{
 		"retailer": "Retailer A",
@@ -126,7 +149,7 @@ func TestSubmitReceiptInvalidPrice(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(SubmitReceipt)
+	handler := http.HandlerFunc(server.SubmitReceipt)
 
 	handler.ServeHTTP(rr, req)
 
@@ -149,6 +172,8 @@ func TestSubmitReceiptInvalidPrice(t *testing.T) {
 }
 
 func TestSubmitReceiptInvalidPayload(t *testing.T) {
+	server := newTestServer(t)
+
 	req, err := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte("invalid-json")))
 	if err != nil {
 		t.Fatal(err)
@@ -156,7 +181,7 @@ func TestSubmitReceiptInvalidPayload(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
-	router.HandleFunc("/receipts/process", SubmitReceipt)
+	router.HandleFunc("/receipts/process", server.SubmitReceipt)
 	router.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusBadRequest {
@@ -170,6 +195,8 @@ func TestSubmitReceiptInvalidPayload(t *testing.T) {
 }
 
 func TestSubmitReceiptLargePayload(t *testing.T) {
+	server := newTestServer(t)
+
 	// Create a receipt with 1000 items
 	items := make([]map[string]string, 1000)
 	for i := 0; i < 1000; i++ {
@@ -195,7 +222,7 @@ func TestSubmitReceiptLargePayload(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
-	router.HandleFunc("/receipts/process", SubmitReceipt)
+	router.HandleFunc("/receipts/process", server.SubmitReceipt)
 	router.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusCreated {
@@ -204,6 +231,8 @@ func TestSubmitReceiptLargePayload(t *testing.T) {
 }
 
 func TestSubmitReceiptMissingFields1(t *testing.T) {
+	server := newTestServer(t)
+
 	payload := `{"retailer": "Retailer A"}`
 	req, err := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(payload)))
 	if err != nil {
@@ -212,15 +241,250 @@ func TestSubmitReceiptMissingFields1(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
-	router.HandleFunc("/receipts/process", SubmitReceipt)
+	router.HandleFunc("/receipts/process", server.SubmitReceipt)
 	router.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusBadRequest {
 		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
 	}
 
-	expected := `{"success":false,"error":"Missing required fields"}`
+	expected := `{"success":false,"error":"Missing required fields","errors":[` +
+		`{"path":"/purchaseDate","code":"required","message":"purchase date is required"},` +
+		`{"path":"/purchaseTime","code":"required","message":"purchase time is required"},` +
+		`{"path":"/total","code":"required","message":"total amount is required"},` +
+		`{"path":"/items","code":"required","message":"at least one item is required"}]}`
 	if rr.Body.String() != expected {
 		t.Errorf("expected response '%s', got '%s'", expected, rr.Body.String())
 	}
 }
+
+func TestSubmitReceiptConsistencyStrict(t *testing.T) {
+	server := NewServer(nil, nil, newTestServer(t).logger, common.FixedClock{Time: time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)},
+		WithConsistency(validation.ConsistencyOptions{Mode: validation.ModeStrict}))
+
+	tests := []struct {
+		payload string
+		path    string
+		message string
+	}{
+		{
+			`{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "9999.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+			"/total",
+			"items sum to 10.00 but the total is 9999.00",
+		},
+		{
+			`{"retailer": "Retailer A", "purchaseDate": "2023-02-30", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+			"/purchaseDate",
+			"purchase date 2023-02-30 is not a valid calendar date",
+		},
+		{
+			`{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "25:99", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+			"/purchaseTime",
+			"purchase time 25:99 is not a valid 24-hour time",
+		},
+		{
+			`{"retailer": "Retailer A", "purchaseDate": "2024-01-01", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`,
+			"/purchaseDate",
+			"purchase date 2024-01-01 is in the future",
+		},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(tt.payload))
+		rr := httptest.NewRecorder()
+		server.SubmitReceipt(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", tt.message, http.StatusBadRequest, rr.Code)
+		}
+		var response common.JSONResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if len(response.Errors) != 1 || response.Errors[0].Path != tt.path || response.Errors[0].Message != tt.message {
+			t.Errorf("expected error '%s' at %s, got %+v", tt.message, tt.path, response.Errors)
+		}
+	}
+}
+
+func TestSubmitReceiptReportsAllErrors(t *testing.T) {
+	server := newTestServer(t)
+
+	payload := `{
+		"retailer": "Retailer A!",
+		"purchaseDate": "2023-11-25",
+		"purchaseTime": "12:00",
+		"total": "100",
+		"items": [
+			{"shortDescription": "Item A", "price": "50.00"},
+			{"shortDescription": "Item B", "price": "50.00"},
+			{"shortDescription": "Item C", "price": "50.00"},
+			{"shortDescription": "Item D", "price": "5"}
+		]
+	}`
+
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	server.SubmitReceipt(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	var response common.JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+
+	if response.Error != "Validation failed" {
+		t.Errorf("expected error 'Validation failed', got '%s'", response.Error)
+	}
+	expectedPaths := []string{"/retailer", "/total", "/items/3/price"}
+	if len(response.Errors) != len(expectedPaths) {
+		t.Fatalf("expected %d errors, got %+v", len(expectedPaths), response.Errors)
+	}
+	for i, path := range expectedPaths {
+		if response.Errors[i].Path != path || response.Errors[i].Code != "invalid_format" {
+			t.Errorf("expected invalid_format error at %s, got %+v", path, response.Errors[i])
+		}
+	}
+}
+
+// Helper function to submit a receipt payload with an optional Idempotency-Key
+func submitWithKey(server *Server, payload, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	server.SubmitReceipt(rr, req)
+	return rr
+}
+
+// Helper function to extract the receipt ID from a submission response
+func responseID(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+	return response.Data.ID
+}
+
+func TestSubmitReceiptDuplicate(t *testing.T) {
+	server := newTestServer(t)
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`
+
+	first := submitWithKey(server, payload, "")
+	second := submitWithKey(server, payload, "")
+
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, first.Code)
+	}
+	if second.Code != http.StatusConflict {
+		t.Errorf("expected status code %d for a duplicate, got %d", http.StatusConflict, second.Code)
+	}
+	if responseID(t, second) != responseID(t, first) {
+		t.Errorf("expected the duplicate response to reference the original receipt")
+	}
+
+	receipts, _ := server.Store().GetAllReceipts()
+	if len(receipts) != 1 {
+		t.Errorf("expected a single stored receipt, got %d", len(receipts))
+	}
+}
+
+func TestSubmitReceiptAllowDuplicates(t *testing.T) {
+	server := NewServer(nil, nil, newTestServer(t).logger, nil, WithDuplicates(true))
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`
+
+	first := submitWithKey(server, payload, "")
+	second := submitWithKey(server, payload, "")
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("expected both copies to be stored, got %d and %d", first.Code, second.Code)
+	}
+	if responseID(t, second) == responseID(t, first) {
+		t.Errorf("expected the copies to get their own IDs")
+	}
+
+	// A retry with the same Idempotency-Key still replays rather than storing another copy
+	keyed := submitWithKey(server, payload, "key-1")
+	if retry := submitWithKey(server, payload, "key-1"); responseID(t, retry) != responseID(t, keyed) {
+		t.Errorf("expected the retry to return the original receipt ID")
+	}
+	if receipts, _ := server.Store().GetAllReceipts(); len(receipts) != 3 {
+		t.Errorf("expected 3 stored receipts, got %d", len(receipts))
+	}
+}
+
+func TestSubmitReceiptIdempotencyKey(t *testing.T) {
+	store := common.NewReceiptStorage()
+	quiet := newTestServer(t).logger
+	start := time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+	server := NewServer(store, nil, quiet, common.FixedClock{Time: start}, WithIdempotencyWindow(time.Hour))
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`
+
+	first := submitWithKey(server, payload, "key-1")
+	retry := submitWithKey(server, payload, "key-1")
+
+	if retry.Code != http.StatusCreated {
+		t.Errorf("expected the retry to replay status code %d, got %d", http.StatusCreated, retry.Code)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the retry to be marked as replayed")
+	}
+	if responseID(t, retry) != responseID(t, first) {
+		t.Errorf("expected the retry to return the original receipt ID")
+	}
+
+	// Reusing the key for different content is rejected
+	other := `{"retailer": "Retailer B", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`
+	if rr := submitWithKey(server, other, "key-1"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d for key reuse, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	// After the window the key no longer replays, and the content is detected as a duplicate
+	later := NewServer(store, nil, quiet, common.FixedClock{Time: start.Add(2 * time.Hour)}, WithIdempotencyWindow(time.Hour))
+	if rr := submitWithKey(later, payload, "key-1"); rr.Code != http.StatusConflict {
+		t.Errorf("expected status code %d after the window, got %d", http.StatusConflict, rr.Code)
+	}
+}
+
+func TestSubmitReceiptBodyTooLarge(t *testing.T) {
+	server := NewServer(nil, nil, newTestServer(t).logger, nil, WithBodyLimits(64, 64))
+
+	payload := `{"retailer": "Retailer A", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "100.00", "items": [{"shortDescription": "Item A", "price": "100.00"}]}`
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	server.SubmitReceipt(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+func TestScopedIdempotencyKeysNeverCollide(t *testing.T) {
+	scoped := func(client, user, key string) string {
+		req, _ := http.NewRequest("POST", "/receipts/process", nil)
+		req = req.WithContext(common.WithPrincipal(req.Context(), common.Principal{ClientID: client, UserID: user}))
+		return scopedIdempotencyKey(req, key)
+	}
+
+	keys := map[string]string{}
+	for _, caller := range [][3]string{
+		{"acme", "", "a:b"},
+		{"acme:a", "", "b"},
+		{"acme", "a", "b"},
+		{"acme", "a:b", ""},
+		{"acme", "alice", "order-1"},
+		{"acme", "bob", "order-1"},
+	} {
+		key := scoped(caller[0], caller[1], caller[2])
+		if other, exists := keys[key]; exists {
+			t.Errorf("%v and %s share the stored key %q", caller, other, key)
+		}
+		keys[key] = fmt.Sprint(caller)
+	}
+}
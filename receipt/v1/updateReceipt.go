@@ -0,0 +1,148 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/ethirajmudhaliar/GH-risk-api/logger"
+	"github.com/gorilla/mux"
+)
+
+// receiptPatch is a JSON merge patch of a receipt. Omitted fields are left unchanged,
+// null ones are removed, and items, when present, replace the whole item list.
+type receiptPatch struct {
+	Retailer     *string        `json:"retailer"`
+	PurchaseDate *string        `json:"purchaseDate"`
+	PurchaseTime *string        `json:"purchaseTime"`
+	Total        *string        `json:"total"`
+	Items        *[]common.Item `json:"items"`
+}
+
+// UnmarshalJSON decodes a merge patch. A null member removes its field, as RFC 7396
+// specifies, so the patched receipt is missing it and fails validation instead of
+// being left unchanged.
+func (p *receiptPatch) UnmarshalJSON(data []byte) error {
+	type fields receiptPatch // Without the UnmarshalJSON method
+	if err := json.Unmarshal(data, (*fields)(p)); err != nil {
+		return err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	removals := map[string]func(){
+		"retailer":     func() { p.Retailer = new(string) },
+		"purchasedate": func() { p.PurchaseDate = new(string) },
+		"purchasetime": func() { p.PurchaseTime = new(string) },
+		"total":        func() { p.Total = new(string) },
+		"items":        func() { p.Items = &[]common.Item{} },
+	}
+	for name, value := range members {
+		remove, ok := removals[strings.ToLower(name)]
+		if ok && string(value) == "null" {
+			remove()
+		}
+	}
+	return nil
+}
+
+// apply returns the receipt with the patched fields replaced
+func (p receiptPatch) apply(receipt common.Receipt) common.Receipt {
+	if p.Retailer != nil {
+		receipt.Retailer = *p.Retailer
+	}
+	if p.PurchaseDate != nil {
+		receipt.PurchaseDate = *p.PurchaseDate
+	}
+	if p.PurchaseTime != nil {
+		receipt.PurchaseTime = *p.PurchaseTime
+	}
+	if p.Total != nil {
+		receipt.Total = *p.Total
+	}
+	if p.Items != nil {
+		receipt.Items = *p.Items
+	}
+	return receipt
+}
+
+// ReplaceReceipt handles PUT requests replacing the whole content of a receipt.
+// The receipt is validated and scored again; If-Match must carry its current ETag.
+func (s *Server) ReplaceReceipt(w http.ResponseWriter, r *http.Request) {
+	s.changeReceipt(w, r, func(common.Receipt) (common.Receipt, error) {
+		var replacement common.Receipt
+		err := json.NewDecoder(r.Body).Decode(&replacement)
+		return replacement, err
+	})
+}
+
+// PatchReceipt handles PATCH requests changing some fields of a receipt with a
+// JSON merge patch. The result is validated and scored again; If-Match must carry
+// its current ETag.
+func (s *Server) PatchReceipt(w http.ResponseWriter, r *http.Request) {
+	s.changeReceipt(w, r, func(current common.Receipt) (common.Receipt, error) {
+		var patch receiptPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			return common.Receipt{}, err
+		}
+		return patch.apply(current), nil
+	})
+}
+
+// changeReceipt runs the shared update pipeline: look up the receipt, build its new
+// content from the request, validate and score it, and store it if its version still
+// matches If-Match. It responds with the updated receipt and its new ETag.
+func (s *Server) changeReceipt(w http.ResponseWriter, r *http.Request, build func(current common.Receipt) (common.Receipt, error)) {
+	// Extract the ID from the URL path
+	vars := mux.Vars(r)
+	receiptID := vars["id"]
+	log := s.requestLogger(r).With(logger.F(logger.KeyReceiptID, receiptID))
+
+	current, err := s.store.GetReceiptByID(receiptID)
+	if err != nil {
+		s.respondWithLookupError(w, log, err)
+		return
+	}
+	if !canAccess(r, current) {
+		respondWithForeignReceipt(w, log)
+		return
+	}
+
+	expectedVersion, ok := s.requireIfMatch(w, r, log)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	updated, err := build(current)
+	if err != nil {
+		s.respondWithDecodeError(w, log, err)
+		return
+	}
+	updated.ID = receiptID
+	updated.ClientID = current.ClientID
+	updated.UserID = current.UserID
+
+	evaluation, ok := s.evaluateReceipt(w, log, updated)
+	if !ok {
+		return
+	}
+	breakdown, points := evaluation.Breakdown, evaluation.Points
+
+	version, err := s.store.ReplaceReceipt(receiptID, updated, points, breakdown, expectedVersion, s.clock.Now())
+	if err != nil {
+		s.respondWithChangeError(w, log, err)
+		return
+	}
+
+	log.Info("Receipt updated", logger.F("version", version), logger.F("points", points))
+
+	w.Header().Set(ETagHeader, formatETag(version))
+	common.RespondWithJSON(w, http.StatusOK, common.JSONResponse{
+		Success: true,
+		Data:    common.ReceiptRecord{Receipt: updated, Points: points},
+	})
+}
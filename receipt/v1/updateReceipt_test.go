@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"github.com/gorilla/mux"
+)
+
+// Helper function to build a router for the receipt change endpoints
+func newChangeRouter(server *Server) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/receipts/process", server.SubmitReceipt).Methods("POST")
+	router.HandleFunc("/receipts/{id}", server.GetReceipt).Methods("GET")
+	router.HandleFunc("/receipts/{id}", server.ReplaceReceipt).Methods("PUT")
+	router.HandleFunc("/receipts/{id}", server.PatchReceipt).Methods("PATCH")
+	router.HandleFunc("/receipts/{id}", server.DeleteReceipt).Methods("DELETE")
+	router.HandleFunc("/receipts/{id}/points", server.GetReceiptPoints).Methods("GET")
+	return router
+}
+
+// Helper function to send a request with an optional If-Match header
+func sendWithIfMatch(router http.Handler, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if ifMatch != "" {
+		req.Header.Set(IfMatchHeader, ifMatch)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestReplaceReceipt(t *testing.T) {
+	server := newTestServer(t)
+	router := newChangeRouter(server)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	id := responseID(t, sendWithIfMatch(router, "POST", "/receipts/process", payload, ""))
+
+	rr := sendWithIfMatch(router, "GET", "/receipts/"+id, "", "")
+	etag := rr.Header().Get(ETagHeader)
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	replacement := `{"retailer": "Walgreens", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.25", "items": [{"shortDescription": "Item B", "price": "10.25"}]}`
+
+	// Changes without If-Match are refused so concurrent editors can't clobber each other
+	if rr := sendWithIfMatch(router, "PUT", "/receipts/"+id, replacement, ""); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected status code %d, got %d", http.StatusPreconditionRequired, rr.Code)
+	}
+
+	rr = sendWithIfMatch(router, "PUT", "/receipts/"+id, replacement, etag)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get(ETagHeader) != `"2"` {
+		t.Errorf("expected ETag \"2\", got %q", rr.Header().Get(ETagHeader))
+	}
+
+	var response struct {
+		Data common.ReceiptRecord `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	// 9 for the retailer, 25 for the multiple of 0.25, 3 for the item and 6 for the odd day
+	if response.Data.ID != id || response.Data.Retailer != "Walgreens" || response.Data.Points != 43 {
+		t.Errorf("expected the re-scored receipt, got: %+v", response.Data)
+	}
+
+	// The old ETag is now stale
+	rr = sendWithIfMatch(router, "PUT", "/receipts/"+id, payload, etag)
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get(ETagHeader) != `"2"` {
+		t.Errorf("expected status code %d with the current ETag, got %d (%q)", http.StatusPreconditionFailed, rr.Code, rr.Header().Get(ETagHeader))
+	}
+}
+
+func TestPatchReceipt(t *testing.T) {
+	server := newTestServer(t)
+	router := newChangeRouter(server)
+
+	payload := `{"retailer": "Target", "purchaseDate": "2023-11-25", "purchaseTime": "12:00", "total": "10.00", "items": [{"shortDescription": "Item A", "price": "10.00"}]}`
+	id := responseID(t, sendWithIfMatch(router, "POST", "/receipts/process", payload, ""))
+
+	rr := sendWithIfMatch(router, "PATCH", "/receipts/"+id, `{"retailer": "M&M Corner Market"}`, `"1"`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	stored, _ := server.Store().GetReceiptByID(id)
+	if stored.Retailer != "M&M Corner Market" || stored.Total != "10.00" || len(stored.Items) != 1 {
+		t.Errorf("expected only the retailer to change, got: %+v", stored)
+	}
+	points, _ := server.Store().GetReceiptPoints(id)
+	if points != 97 {
+		t.Errorf("expected the receipt to be re-scored to 97 points, got %d", points)
+	}
+
+	// The patched receipt is validated again
+	rr = sendWithIfMatch(router, "PATCH", "/receipts/"+id, `{"total": "abc"}`, "*")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var response common.JSONResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if len(response.Errors) == 0 || response.Errors[0].Path != "/total" {
+		t.Errorf("expected an error for /total, got: %+v", response.Errors)
+	}
+
+	// A null member removes the field, which the receipt requires
+	rr = sendWithIfMatch(router, "PATCH", "/receipts/"+id, `{"items": null}`, "*")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	response = common.JSONResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if len(response.Errors) == 0 || response.Errors[0].Path != "/items" {
+		t.Errorf("expected an error for /items, got: %+v", response.Errors)
+	}
+	if stored, _ := server.Store().GetReceiptByID(id); len(stored.Items) != 1 {
+		t.Errorf("expected the items to be kept, got: %+v", stored.Items)
+	}
+}
+
+func TestChangeReceiptNotFound(t *testing.T) {
+	router := newChangeRouter(newTestServer(t))
+
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		rr := sendWithIfMatch(router, method, "/receipts/non-existent-id", `{}`, "*")
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status code %d, got %d", method, http.StatusNotFound, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package rules
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative rule file format, in YAML or JSON.
+type Config struct {
+	Version string       `json:"version" yaml:"version"` // Identifies the active rule set, e.g. "2024-01-promo"; defaults to a hash of the rules
+	Rules   []RuleConfig `json:"rules" yaml:"rules"`     // Rules applied in order
+}
+
+// RuleConfig configures a single rule. Only the parameters relevant to Type are used.
+type RuleConfig struct {
+	Type       string  `json:"type" yaml:"type"`                                 // One of the Type* constants
+	Name       string  `json:"name,omitempty" yaml:"name,omitempty"`             // Defaults to Type
+	Enabled    *bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`       // Defaults to true
+	Points     int64   `json:"points,omitempty" yaml:"points,omitempty"`         // Points awarded on a match (per character for retailer_alphanumeric, per group for item_pairs)
+	Multiple   float64 `json:"multiple,omitempty" yaml:"multiple,omitempty"`     // total_multiple amount or description_length divisor
+	GroupSize  int     `json:"groupSize,omitempty" yaml:"groupSize,omitempty"`   // item_pairs group size
+	Multiplier float64 `json:"multiplier,omitempty" yaml:"multiplier,omitempty"` // description_length price multiplier
+	Start      string  `json:"start,omitempty" yaml:"start,omitempty"`           // time_window start, HH:mm inclusive
+	End        string  `json:"end,omitempty" yaml:"end,omitempty"`               // time_window end, HH:mm exclusive
+}
+
+// DefaultConfig returns the standard receipt points rules.
+func DefaultConfig() Config {
+	return Config{
+		Version: "default",
+		Rules: []RuleConfig{
+			{Type: TypeRetailerAlphanumeric, Points: 1},
+			{Type: TypeRoundDollar, Points: 50},
+			{Type: TypeTotalMultiple, Points: 25, Multiple: 0.25},
+			{Type: TypeItemPairs, Points: 5, GroupSize: 2},
+			{Type: TypeDescriptionLength, Multiple: 3, Multiplier: 0.2},
+			{Type: TypeOddDay, Points: 6},
+			{Type: TypeTimeWindow, Points: 10, Start: "14:00", End: "16:00"},
+		},
+	}
+}
+
+// LoadFile reads a rule configuration from a .yaml/.yml or .json file. Unknown
+// fields are rejected, so a misspelt parameter cannot silently fall back to zero.
+func LoadFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading rule file: %w", err)
+	}
+
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&cfg); err == io.EOF {
+			err = nil // An empty file has no rules
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&cfg); err == nil && decoder.More() {
+			err = errors.New("unexpected data after the rules")
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported rule file extension %q, expected .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("parsing rule file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Build validates the configuration and creates the rule engine. A configuration
+// without a version is identified by a hash of its content instead, so every engine
+// reports which rules it applies. Enabled rules must have distinct names, as the
+// breakdown of a receipt reports each rule by name.
+func Build(cfg Config) (*Engine, error) {
+	version := cfg.Version
+	if version == "" {
+		version = contentVersion(cfg)
+	}
+	engine := &Engine{version: version}
+	names := make(map[string]int)
+	for i, rc := range cfg.Rules {
+		if rc.Enabled != nil && !*rc.Enabled {
+			continue
+		}
+		rule, err := buildRule(rc)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, rc.Type, err)
+		}
+		if first, ok := names[rule.Name()]; ok {
+			return nil, fmt.Errorf("rule %d (%s): name %q is already used by rule %d", i+1, rc.Type, rule.Name(), first)
+		}
+		names[rule.Name()] = i + 1
+		engine.rules = append(engine.rules, rule)
+	}
+	return engine, nil
+}
+
+// contentVersion identifies an unversioned configuration by the SHA-256 of its JSON
+// encoding, e.g. "sha256:3f1c9a0b52de"
+func contentVersion(cfg Config) string {
+	data, _ := json.Marshal(cfg) // Plain data, which always encodes
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// Load reads the rule file at path and builds its engine.
+// An empty path builds the default rules.
+func Load(path string) (*Engine, error) {
+	if path == "" {
+		return Build(DefaultConfig())
+	}
+	cfg, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Build(cfg)
+}
+
+// Default builds the engine for the standard rules.
+func Default() *Engine {
+	engine, err := Build(DefaultConfig())
+	if err != nil {
+		panic("default rules are invalid: " + err.Error())
+	}
+	return engine
+}
+
+// buildRule converts one rule configuration into a Rule.
+func buildRule(rc RuleConfig) (Rule, error) {
+	name := rc.Name
+	if name == "" {
+		name = rc.Type
+	}
+	if rc.Points < 0 {
+		return nil, fmt.Errorf("points must not be negative")
+	}
+
+	switch rc.Type {
+	case TypeRetailerAlphanumeric:
+		return RetailerAlphanumericRule{RuleName: name, PointsPerChar: rc.Points}, nil
+	case TypeRoundDollar:
+		return RoundDollarRule{RuleName: name, Award: rc.Points}, nil
+	case TypeTotalMultiple:
+		multiple, ok := exactFraction(rc.Multiple, 100)
+		if !ok || multiple <= 0 {
+			return nil, fmt.Errorf("multiple must be a positive amount with at most two decimal places")
+		}
+		return TotalMultipleRule{RuleName: name, Award: rc.Points, Multiple: common.Money(multiple)}, nil
+	case TypeItemPairs:
+		if rc.GroupSize <= 0 {
+			return nil, fmt.Errorf("groupSize must be positive")
+		}
+		return ItemPairsRule{RuleName: name, Award: rc.Points, GroupSize: rc.GroupSize}, nil
+	case TypeDescriptionLength:
+		if rc.Multiple < 1 || rc.Multiple != float64(int(rc.Multiple)) {
+			return nil, fmt.Errorf("multiple must be a positive whole number")
+		}
+		basisPoints, ok := exactFraction(rc.Multiplier, 10000)
+		if !ok || basisPoints < 0 {
+			return nil, fmt.Errorf("multiplier must be a non-negative number with at most four decimal places")
+		}
+		return DescriptionLengthRule{RuleName: name, Multiple: int(rc.Multiple), MultiplierBasisPoints: basisPoints}, nil
+	case TypeOddDay:
+		return OddDayRule{RuleName: name, Award: rc.Points}, nil
+	case TypeTimeWindow:
+		start, ok := parseClock(rc.Start)
+		if !ok {
+			return nil, fmt.Errorf("invalid start time %q, expected HH:mm", rc.Start)
+		}
+		end, ok := parseClock(rc.End)
+		if !ok {
+			return nil, fmt.Errorf("invalid end time %q, expected HH:mm", rc.End)
+		}
+		if end <= start {
+			return nil, fmt.Errorf("end time must be after start time")
+		}
+		return TimeWindowRule{RuleName: name, Award: rc.Points, Start: start, End: end}, nil
+	default:
+		return nil, fmt.Errorf("unknown rule type")
+	}
+}
+
+// exactFraction converts value to an integer count of 1/scale units, reporting
+// whether the value is representable at that precision (e.g. 0.25 at scale 100 is 25).
+func exactFraction(value float64, scale int64) (int64, bool) {
+	scaled := math.Round(value * float64(scale))
+	if math.Abs(scaled-value*float64(scale)) > 1e-6 {
+		return 0, false
+	}
+	return int64(scaled), true
+}
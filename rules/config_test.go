@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaultYAMLMatchesDefaultRules(t *testing.T) {
+	engine, err := Load("default.yaml")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(engine.Rules()) != 7 {
+		t.Errorf("expected 7 rules, got %d", len(engine.Rules()))
+	}
+	if points, _ := engine.CalculatePoints(targetReceipt); points != 28 {
+		t.Errorf("expected 28 points, got %d", points)
+	}
+	if points, _ := engine.CalculatePoints(cornerMarketReceipt); points != 109 {
+		t.Errorf("expected 109 points, got %d", points)
+	}
+}
+
+func TestLoadJSONWithDisabledRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	content := `{
+		"version": "promo-1",
+		"rules": [
+			{"type": "round_dollar", "points": 100},
+			{"type": "odd_day", "points": 6, "enabled": false}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if engine.Version() != "promo-1" {
+		t.Errorf("expected version 'promo-1', got '%s'", engine.Version())
+	}
+	if len(engine.Rules()) != 1 {
+		t.Fatalf("expected the disabled rule to be skipped, got %d rules", len(engine.Rules()))
+	}
+	if points, _ := engine.CalculatePoints(cornerMarketReceipt); points != 100 {
+		t.Errorf("expected 100 points, got %d", points)
+	}
+}
+
+func TestBuildInvalidRules(t *testing.T) {
+	tests := []struct {
+		description string
+		rule        RuleConfig
+	}{
+		{"unknown type", RuleConfig{Type: "lucky_number"}},
+		{"zero multiple", RuleConfig{Type: TypeTotalMultiple, Points: 25}},
+		{"sub-cent multiple", RuleConfig{Type: TypeTotalMultiple, Points: 25, Multiple: 0.001}},
+		{"zero group size", RuleConfig{Type: TypeItemPairs, Points: 5}},
+		{"fractional description multiple", RuleConfig{Type: TypeDescriptionLength, Multiple: 2.5}},
+		{"bad window start", RuleConfig{Type: TypeTimeWindow, Start: "2pm", End: "16:00"}},
+		{"window start minutes out of range", RuleConfig{Type: TypeTimeWindow, Start: "13:60", End: "16:00"}},
+		{"window end hour out of range", RuleConfig{Type: TypeTimeWindow, Start: "14:00", End: "25:00"}},
+		{"inverted window", RuleConfig{Type: TypeTimeWindow, Start: "16:00", End: "14:00"}},
+		{"negative points", RuleConfig{Type: TypeRoundDollar, Points: -50}},
+	}
+
+	for _, tt := range tests {
+		if _, err := Build(Config{Rules: []RuleConfig{tt.rule}}); err == nil {
+			t.Errorf("%s: expected an error, got none", tt.description)
+		}
+	}
+}
+
+func TestBuildDuplicateRuleNames(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		description string
+		rules       []RuleConfig
+		valid       bool
+	}{
+		{"same type, default names", []RuleConfig{{Type: TypeOddDay, Points: 6}, {Type: TypeOddDay, Points: 3}}, false},
+		{"explicit name of another type", []RuleConfig{{Type: TypeOddDay, Points: 6}, {Type: TypeRoundDollar, Name: TypeOddDay, Points: 50}}, false},
+		{"same type, distinct names", []RuleConfig{{Type: TypeOddDay, Points: 6}, {Type: TypeOddDay, Name: "odd_day_bonus", Points: 3}}, true},
+		{"duplicate is disabled", []RuleConfig{{Type: TypeOddDay, Points: 6}, {Type: TypeOddDay, Points: 3, Enabled: &disabled}}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := Build(Config{Rules: tt.rules})
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected no error, got: %v", tt.description, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error, got none", tt.description)
+		}
+	}
+}
+
+func TestLoadFileRejectsUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rules.yaml": "rules:\n  - type: round_dollar\n    point: 50\n",
+		"rules.json": `{"rules": [{"type": "round_dollar", "point": 50}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "point") {
+			t.Errorf("%s: expected an error naming the unknown field, got: %v", name, err)
+		}
+	}
+}
+
+func TestLoadUnsupportedExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	os.WriteFile(path, []byte("rules: []"), 0o600)
+
+	if _, err := Load(path); err == nil {
+		t.Errorf("expected error for unsupported extension")
+	}
+}
+
+func TestBuildDefaultsVersionToContentHash(t *testing.T) {
+	cfg := Config{Rules: []RuleConfig{{Type: TypeOddDay, Points: 6}}}
+	first, err := Build(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first.Version(), "sha256:") {
+		t.Errorf("expected a content hash version, got %q", first.Version())
+	}
+	same, _ := Build(cfg)
+	cfg.Rules[0].Points = 7
+	changed, _ := Build(cfg)
+	if same.Version() != first.Version() || changed.Version() == first.Version() {
+		t.Errorf("expected the version to follow the rules, got %q, %q and %q", first.Version(), same.Version(), changed.Version())
+	}
+}
@@ -0,0 +1,45 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// Engine applies a set of rules to receipts.
+type Engine struct {
+	version string
+	rules   []Rule
+}
+
+// Version returns the version of the rule configuration the engine was built from.
+func (e *Engine) Version() string {
+	return e.version
+}
+
+// Rules returns the enabled rules in evaluation order.
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Breakdown evaluates every enabled rule against the receipt, in order.
+func (e *Engine) Breakdown(receipt common.Receipt) ([]common.RuleResult, error) {
+	breakdown := make([]common.RuleResult, 0, len(e.rules))
+	for _, rule := range e.rules {
+		result, err := rule.Evaluate(receipt)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name(), err)
+		}
+		breakdown = append(breakdown, result)
+	}
+	return breakdown, nil
+}
+
+// CalculatePoints returns the total points awarded to the receipt by every enabled rule.
+func (e *Engine) CalculatePoints(receipt common.Receipt) (int64, error) {
+	breakdown, err := e.Breakdown(receipt)
+	if err != nil {
+		return 0, err
+	}
+	return common.SumPoints(breakdown), nil
+}
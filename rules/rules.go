@@ -0,0 +1,236 @@
+// Package rules implements the configurable points rules applied to receipts.
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// Supported rule types.
+const (
+	TypeRetailerAlphanumeric = "retailer_alphanumeric" // Points per alphanumeric character in the retailer name
+	TypeRoundDollar          = "round_dollar"          // Points if the total has no cents
+	TypeTotalMultiple        = "total_multiple"        // Points if the total is a multiple of a given amount
+	TypeItemPairs            = "item_pairs"            // Points for every group of items
+	TypeDescriptionLength    = "description_length"    // Price-based points for items whose trimmed description length is a multiple
+	TypeOddDay               = "odd_day"               // Points if the purchase day is odd
+	TypeTimeWindow           = "time_window"           // Points if the purchase time falls inside a window
+)
+
+// Rule awards points for a single aspect of a receipt.
+// Evaluate returns an error when the receipt holds a value the rule cannot interpret, such as a malformed amount.
+type Rule interface {
+	Name() string
+	Evaluate(receipt common.Receipt) (common.RuleResult, error)
+}
+
+// RetailerAlphanumericRule awards points for each alphanumeric character in the retailer name.
+type RetailerAlphanumericRule struct {
+	RuleName      string
+	PointsPerChar int64
+}
+
+// Name returns the rule name.
+func (r RetailerAlphanumericRule) Name() string { return r.RuleName }
+
+// Evaluate awards PointsPerChar for every alphanumeric character.
+func (r RetailerAlphanumericRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	points := int64(0)
+	for _, char := range receipt.Retailer {
+		if isAlphanumeric(char) {
+			points += r.PointsPerChar
+		}
+	}
+	return result(r.RuleName, receipt.Retailer, points), nil
+}
+
+// RoundDollarRule awards points if the total is a round dollar amount.
+type RoundDollarRule struct {
+	RuleName string
+	Award    int64
+}
+
+// Name returns the rule name.
+func (r RoundDollarRule) Name() string { return r.RuleName }
+
+// Evaluate awards Award if the total has no cents.
+func (r RoundDollarRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	total, err := common.ParseMoney(receipt.Total)
+	if err != nil {
+		return common.RuleResult{}, fmt.Errorf("total: %w", err)
+	}
+	if total.IsWholeDollar() {
+		return matched(r.RuleName, receipt.Total, r.Award), nil
+	}
+	return result(r.RuleName, receipt.Total, 0), nil
+}
+
+// TotalMultipleRule awards points if the total is a multiple of Multiple.
+type TotalMultipleRule struct {
+	RuleName string
+	Award    int64
+	Multiple common.Money
+}
+
+// Name returns the rule name.
+func (r TotalMultipleRule) Name() string { return r.RuleName }
+
+// Evaluate awards Award if the total is a multiple of Multiple.
+func (r TotalMultipleRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	total, err := common.ParseMoney(receipt.Total)
+	if err != nil {
+		return common.RuleResult{}, fmt.Errorf("total: %w", err)
+	}
+	if total.IsMultipleOf(r.Multiple) {
+		return matched(r.RuleName, receipt.Total, r.Award), nil
+	}
+	return result(r.RuleName, receipt.Total, 0), nil
+}
+
+// ItemPairsRule awards points for every GroupSize items on the receipt.
+type ItemPairsRule struct {
+	RuleName  string
+	Award     int64
+	GroupSize int
+}
+
+// Name returns the rule name.
+func (r ItemPairsRule) Name() string { return r.RuleName }
+
+// Evaluate awards Award for every complete group of items.
+func (r ItemPairsRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	groups := len(receipt.Items) / r.GroupSize
+	return result(r.RuleName, fmt.Sprintf("%d items", len(receipt.Items)), int64(groups)*r.Award), nil
+}
+
+// DescriptionLengthRule awards ceil(price * multiplier) points for each item
+// whose trimmed description length is a multiple of Multiple. The multiplier is
+// held in basis points (0.2 is 2000) so the calculation stays exact.
+type DescriptionLengthRule struct {
+	RuleName              string
+	Multiple              int
+	MultiplierBasisPoints int64
+}
+
+// Name returns the rule name.
+func (r DescriptionLengthRule) Name() string { return r.RuleName }
+
+// Evaluate awards the price-based points of every matching item.
+// The input lists the items whose description length matched.
+func (r DescriptionLengthRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	points := int64(0)
+	var inputs []string
+	for i, item := range receipt.Items {
+		description := strings.TrimSpace(item.ShortDescription)
+		if len(description)%r.Multiple == 0 {
+			price, err := common.ParseMoney(item.Price)
+			if err != nil {
+				return common.RuleResult{}, fmt.Errorf("item %d price: %w", i, err)
+			}
+			// cents * basis points / (100 cents * 10000 basis points), rounded up
+			cents := price.Cents()
+			if r.MultiplierBasisPoints != 0 && (cents > math.MaxInt64/r.MultiplierBasisPoints || cents < -math.MaxInt64/r.MultiplierBasisPoints) {
+				return common.RuleResult{}, fmt.Errorf("item %d price %s is too large to score", i, item.Price)
+			}
+			itemPoints := ceilDiv(cents*r.MultiplierBasisPoints, 100*10000)
+			if (itemPoints > 0 && points > math.MaxInt64-itemPoints) || (itemPoints < 0 && points < math.MinInt64-itemPoints) {
+				return common.RuleResult{}, fmt.Errorf("item %d price %s is too large to score", i, item.Price)
+			}
+			points += itemPoints
+			inputs = append(inputs, fmt.Sprintf("%q (%d chars) at %s", description, len(description), item.Price))
+		}
+	}
+	return common.RuleResult{Rule: r.RuleName, Matched: len(inputs) > 0, Input: strings.Join(inputs, "; "), Points: points}, nil
+}
+
+// OddDayRule awards points if the purchase day is odd.
+type OddDayRule struct {
+	RuleName string
+	Award    int64
+}
+
+// Name returns the rule name.
+func (r OddDayRule) Name() string { return r.RuleName }
+
+// Evaluate awards Award if the day of the purchase date is odd.
+func (r OddDayRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	parts := strings.Split(receipt.PurchaseDate, "-")
+	if len(parts) < 3 {
+		return result(r.RuleName, receipt.PurchaseDate, 0), nil
+	}
+	day, _ := strconv.Atoi(parts[2])
+	if day%2 != 0 {
+		return matched(r.RuleName, receipt.PurchaseDate, r.Award), nil
+	}
+	return result(r.RuleName, receipt.PurchaseDate, 0), nil
+}
+
+// TimeWindowRule awards points if the purchase time is in [Start, End), in minutes after midnight.
+type TimeWindowRule struct {
+	RuleName string
+	Award    int64
+	Start    int
+	End      int
+}
+
+// Name returns the rule name.
+func (r TimeWindowRule) Name() string { return r.RuleName }
+
+// Evaluate awards Award if the purchase time falls inside the window.
+func (r TimeWindowRule) Evaluate(receipt common.Receipt) (common.RuleResult, error) {
+	minutes, ok := parseClock(receipt.PurchaseTime)
+	if ok && minutes >= r.Start && minutes < r.End {
+		return matched(r.RuleName, receipt.PurchaseTime, r.Award), nil
+	}
+	return result(r.RuleName, receipt.PurchaseTime, 0), nil
+}
+
+// Helper function to build a result that matched when it awarded points
+func result(name, input string, points int64) common.RuleResult {
+	return common.RuleResult{Rule: name, Matched: points > 0, Input: input, Points: points}
+}
+
+// Helper function to build a result for a rule whose condition held,
+// even if it is configured to award zero points
+func matched(name, input string, points int64) common.RuleResult {
+	return common.RuleResult{Rule: name, Matched: true, Input: input, Points: points}
+}
+
+// Helper function to check if a character is alphanumeric
+func isAlphanumeric(char rune) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+// Helper function to divide integers rounding towards positive infinity
+func ceilDiv(numerator, denominator int64) int64 {
+	quotient := numerator / denominator
+	if numerator%denominator != 0 && (numerator > 0) == (denominator > 0) {
+		quotient++
+	}
+	return quotient
+}
+
+// Helper function to convert an HH:mm time into minutes after midnight. Hours must
+// be 0-23 and minutes 0-59, so an out-of-range time cannot land inside a window.
+func parseClock(value string) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
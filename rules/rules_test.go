@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// Sample receipts with well-known scores under the standard rules
+var (
+	targetReceipt = common.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Total:        "35.35",
+		Items: []common.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+	}
+	cornerMarketReceipt = common.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+		Items: []common.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+	}
+)
+
+func TestDefaultRules(t *testing.T) {
+	engine := Default()
+
+	if points, _ := engine.CalculatePoints(targetReceipt); points != 28 {
+		t.Errorf("expected 28 points for Target receipt, got %d", points)
+	}
+	if points, _ := engine.CalculatePoints(cornerMarketReceipt); points != 109 {
+		t.Errorf("expected 109 points for M&M Corner Market receipt, got %d", points)
+	}
+}
+
+func TestTimeWindowRule(t *testing.T) {
+	rule := TimeWindowRule{RuleName: "afternoon", Award: 10, Start: 14 * 60, End: 16 * 60}
+
+	tests := []struct {
+		time   string
+		points int64
+	}{
+		{"13:59", 0},
+		{"14:00", 10},
+		{"15:59", 10},
+		{"16:00", 0},
+		{"bad", 0},
+		{"13:75", 0}, // Would be 14:15 if the minutes were not range-checked
+		{"14:-1", 0},
+	}
+	for _, tt := range tests {
+		if result, _ := rule.Evaluate(common.Receipt{PurchaseTime: tt.time}); result.Points != tt.points {
+			t.Errorf("%s: expected %d points, got %d", tt.time, tt.points, result.Points)
+		}
+	}
+}
+
+func TestItemPairsRule(t *testing.T) {
+	rule := ItemPairsRule{RuleName: "groups", Award: 5, GroupSize: 3}
+	receipt := common.Receipt{Items: make([]common.Item, 7)}
+
+	if result, _ := rule.Evaluate(receipt); result.Points != 10 {
+		t.Errorf("expected 10 points for two groups of three, got %d", result.Points)
+	}
+}
+
+func TestEngineBreakdown(t *testing.T) {
+	breakdown, err := Default().Breakdown(cornerMarketReceipt)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	expected := []struct {
+		rule    string
+		matched bool
+		points  int64
+	}{
+		{TypeRetailerAlphanumeric, true, 14},
+		{TypeRoundDollar, true, 50},
+		{TypeTotalMultiple, true, 25},
+		{TypeItemPairs, true, 10},
+		{TypeDescriptionLength, false, 0},
+		{TypeOddDay, false, 0},
+		{TypeTimeWindow, true, 10},
+	}
+
+	if len(breakdown) != len(expected) {
+		t.Fatalf("expected %d rule results, got %d", len(expected), len(breakdown))
+	}
+	for i, want := range expected {
+		got := breakdown[i]
+		if got.Rule != want.rule || got.Matched != want.matched || got.Points != want.points {
+			t.Errorf("rule %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if breakdown[6].Input != "14:33" {
+		t.Errorf("expected time window input '14:33', got '%s'", breakdown[6].Input)
+	}
+}
+
+func TestDescriptionLengthRuleIsExact(t *testing.T) {
+	rule := DescriptionLengthRule{RuleName: "description", Multiple: 3, MultiplierBasisPoints: 2000}
+
+	// 15.00 * 0.2 is 3.0000000000000004 in float64, which used to round up to 4
+	receipt := common.Receipt{Items: []common.Item{{ShortDescription: "Tea", Price: "15.00"}}}
+	if result, _ := rule.Evaluate(receipt); result.Points != 3 {
+		t.Errorf("expected 3 points for 15.00, got %d", result.Points)
+	}
+
+	receipt = common.Receipt{Items: []common.Item{{ShortDescription: "Tea", Price: "12.25"}}}
+	if result, _ := rule.Evaluate(receipt); result.Points != 3 {
+		t.Errorf("expected 3 points for 12.25, got %d", result.Points)
+	}
+}
+
+func TestDescriptionLengthRuleOverflow(t *testing.T) {
+	rule := DescriptionLengthRule{RuleName: "description", Multiple: 3, MultiplierBasisPoints: 10000}
+
+	// The largest price whose cents times the multiplier fit in an int64
+	receipt := common.Receipt{Items: []common.Item{{ShortDescription: "Tea", Price: "9223372036854.77"}}}
+	result, err := rule.Evaluate(receipt)
+	if err != nil || result.Points != 9223372036855 {
+		t.Errorf("expected 9223372036855 points at the boundary, got %d (%v)", result.Points, err)
+	}
+
+	for _, price := range []string{"9223372036854.78", "-9223372036854.78"} {
+		receipt = common.Receipt{Items: []common.Item{{ShortDescription: "Tea", Price: price}}}
+		if _, err := rule.Evaluate(receipt); err == nil {
+			t.Errorf("expected an error for %s overflowing the multiplier, got none", price)
+		}
+	}
+}
+
+func TestMalformedAmountIsReported(t *testing.T) {
+	receipt := cornerMarketReceipt
+	receipt.Total = "9.0O"
+
+	if _, err := Default().CalculatePoints(receipt); err == nil {
+		t.Errorf("expected an error for a malformed total, got none")
+	}
+
+	receipt = targetReceipt
+	receipt.Items = []common.Item{{ShortDescription: "Tea", Price: "abc"}}
+	if _, err := Default().Breakdown(receipt); err == nil {
+		t.Errorf("expected an error for a malformed item price, got none")
+	}
+}
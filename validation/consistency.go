@@ -0,0 +1,96 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// Mode controls how strictly cross-field consistency problems are enforced.
+type Mode string
+
+const (
+	// ModeStrict rejects every consistency problem.
+	ModeStrict Mode = "strict"
+	// ModeLenient rejects only impossible dates and times; item sum mismatches
+	// and future purchase dates are reported as warnings.
+	ModeLenient Mode = "lenient"
+)
+
+// ParseMode converts a configuration value into a Mode.
+func ParseMode(value string) (Mode, error) {
+	switch Mode(value) {
+	case ModeStrict, ModeLenient:
+		return Mode(value), nil
+	default:
+		return "", fmt.Errorf("unknown consistency mode %q, expected %q or %q", value, ModeStrict, ModeLenient)
+	}
+}
+
+// ConsistencyOptions configures CheckConsistency.
+type ConsistencyOptions struct {
+	Mode      Mode         // Strict or lenient enforcement
+	Tolerance common.Money // Allowed difference between the item sum and the total, e.g. for tax or discount lines
+}
+
+// DefaultConsistencyOptions are lenient with no tolerance.
+var DefaultConsistencyOptions = ConsistencyOptions{Mode: ModeLenient}
+
+// CheckConsistency validates relationships between receipt fields that the format checks in
+// ValidateReceipt cannot see: real calendar dates, valid 24-hour times, purchase dates not
+// after now, and items that add up to the total within the configured tolerance.
+// It returns the problems that were downgraded to warnings, and an Errors value for the
+// problems that are enforced.
+func CheckConsistency(receipt common.Receipt, now time.Time, opts ConsistencyOptions) (Errors, error) {
+	var errs, warnings Errors
+	report := func(path, code, message string) {
+		if opts.Mode == ModeStrict {
+			errs.add(path, code, message)
+		} else {
+			warnings.add(path, code, message)
+		}
+	}
+
+	// Validate the purchase date is a real calendar date that is not in the future;
+	// receipts carry no time zone, so only whole days after today count
+	purchaseDate, err := time.ParseInLocation("2006-01-02", receipt.PurchaseDate, now.Location())
+	if err != nil {
+		errs.add("/purchaseDate", CodeInvalidDate, fmt.Sprintf("purchase date %s is not a valid calendar date", receipt.PurchaseDate))
+	} else {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if purchaseDate.After(today) {
+			report("/purchaseDate", CodeFutureDate, fmt.Sprintf("purchase date %s is in the future", receipt.PurchaseDate))
+		}
+	}
+
+	// Validate the purchase time is a valid 24-hour time
+	if _, err := time.Parse("15:04", receipt.PurchaseTime); err != nil {
+		errs.add("/purchaseTime", CodeInvalidTime, fmt.Sprintf("purchase time %s is not a valid 24-hour time", receipt.PurchaseTime))
+	}
+
+	// Validate the items add up to the total
+	total, err := common.ParseMoney(receipt.Total)
+	if err != nil {
+		errs.add("/total", CodeInvalidAmount, "invalid total amount: "+err.Error())
+		return warnings, errs.err()
+	}
+	sum := common.Money(0)
+	for i, item := range receipt.Items {
+		price, err := common.ParseMoney(item.Price)
+		if err != nil {
+			errs.add(fmt.Sprintf("/items/%d/price", i), CodeInvalidAmount, "invalid price for an item: "+err.Error())
+			return warnings, errs.err()
+		}
+		sum += price
+	}
+	difference := sum - total
+	if difference < 0 {
+		difference = -difference
+	}
+	if difference > opts.Tolerance {
+		report("/total", CodeTotalMismatch, fmt.Sprintf("items sum to %s but the total is %s", sum, total))
+	}
+
+	return warnings, errs.err()
+}
@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+var consistencyNow = time.Date(2023, 11, 26, 12, 0, 0, 0, time.UTC)
+
+// Helper function to build a receipt whose items add up to its total
+func consistentReceipt() common.Receipt {
+	return common.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2023-11-25",
+		PurchaseTime: "13:45",
+		Total:        "12.34",
+		Items: []common.Item{
+			{ShortDescription: "Apples", Price: "5.00"},
+			{ShortDescription: "Bananas", Price: "7.34"},
+		},
+	}
+}
+
+func TestCheckConsistencyValid(t *testing.T) {
+	warnings, err := CheckConsistency(consistentReceipt(), consistencyNow, ConsistencyOptions{Mode: ModeStrict})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected no problems, got error %v and warnings %v", err, warnings)
+	}
+}
+
+func TestCheckConsistencyImpossibleValues(t *testing.T) {
+	badDate := consistentReceipt()
+	badDate.PurchaseDate = "2023-02-30"
+	badTime := consistentReceipt()
+	badTime.PurchaseTime = "25:99"
+
+	for _, receipt := range []common.Receipt{badDate, badTime} {
+		// Impossible values are rejected in both modes
+		for _, mode := range []Mode{ModeStrict, ModeLenient} {
+			if _, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: mode}); err == nil {
+				t.Errorf("%s mode: expected error for %s %s, got none", mode, receipt.PurchaseDate, receipt.PurchaseTime)
+			}
+		}
+	}
+}
+
+func TestCheckConsistencyItemSum(t *testing.T) {
+	receipt := consistentReceipt()
+	receipt.Total = "12.84"
+
+	if _, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeStrict}); err == nil {
+		t.Errorf("expected error when items do not add up to the total")
+	}
+
+	// A 0.50 tax line is within a 1.00 tolerance
+	tolerance, _ := common.ParseMoney("1.00")
+	if _, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeStrict, Tolerance: tolerance}); err != nil {
+		t.Errorf("expected no error within tolerance, got: %v", err)
+	}
+
+	warnings, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeLenient})
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("expected a single warning in lenient mode, got error %v and warnings %v", err, warnings)
+	}
+}
+
+func TestCheckConsistencyFutureDate(t *testing.T) {
+	receipt := consistentReceipt()
+	receipt.PurchaseDate = "2023-11-27"
+
+	if _, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeStrict}); err == nil {
+		t.Errorf("expected error for a future purchase date")
+	}
+
+	receipt.PurchaseDate = "2023-11-26"
+	if _, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeStrict}); err != nil {
+		t.Errorf("expected today's date to be accepted, got: %v", err)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if mode, err := ParseMode("strict"); err != nil || mode != ModeStrict {
+		t.Errorf("expected strict mode, got %q (%v)", mode, err)
+	}
+	if _, err := ParseMode("paranoid"); err == nil {
+		t.Errorf("expected error for unknown mode")
+	}
+}
+
+func TestCheckConsistencyCollectsAllErrors(t *testing.T) {
+	receipt := consistentReceipt()
+	receipt.PurchaseDate = "2023-02-30"
+	receipt.PurchaseTime = "25:99"
+	receipt.Total = "99.00"
+
+	_, err := CheckConsistency(receipt, consistencyNow, ConsistencyOptions{Mode: ModeStrict})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected three errors, got %v", err)
+	}
+	if !errs.HasCode(CodeInvalidDate) || !errs.HasCode(CodeInvalidTime) || !errs.HasCode(CodeTotalMismatch) {
+		t.Errorf("unexpected error codes: %+v", errs)
+	}
+}
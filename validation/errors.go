@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
+)
+
+// Error codes reported in validation errors.
+const (
+	CodeRequired      = "required"       // A required field is missing or empty
+	CodeInvalidFormat = "invalid_format" // A field does not match its expected format
+	CodeInvalidAmount = "invalid_amount" // An amount cannot be represented exactly
+	CodeInvalidDate   = "invalid_date"   // A date is not a real calendar date
+	CodeInvalidTime   = "invalid_time"   // A time is not a valid 24-hour time
+	CodeFutureDate    = "future_date"    // A purchase date lies in the future
+	CodeTotalMismatch = "total_mismatch" // Item prices do not add up to the total
+)
+
+// Errors collects every problem found while validating a receipt.
+type Errors []common.ErrorDetail
+
+// Error joins the messages of all problems.
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, detail := range e {
+		messages[i] = detail.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// HasCode reports whether any problem has the given code.
+func (e Errors) HasCode(code string) bool {
+	for _, detail := range e {
+		if detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a problem at the given JSON pointer path.
+func (e *Errors) add(path, code, message string) {
+	*e = append(*e, common.ErrorDetail{Path: path, Code: code, Message: message})
+}
+
+// err returns the collected problems as an error, or nil if there are none.
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -1,8 +1,10 @@
 package validation
 
 import (
-	"errors"
+	"fmt"
 	"regexp"
+
+	"github.com/ethirajmudhaliar/GH-risk-api/common"
 )
 
 // Regular expressions for validation
@@ -14,45 +16,68 @@ var (
 	shortDescriptionRegex = regexp.MustCompile(`^[\w\s\-\']+$`)       // Matches valid item descriptions
 )
 
-// ValidateReceipt validates the fields of a receipt
+// ValidateReceipt validates the fields of a receipt.
+// Every problem is collected; the returned error is an Errors value listing each
+// one with the JSON pointer path of the offending field.
 func ValidateReceipt(retailer string, purchaseDate string, purchaseTime string, total string, items []map[string]string) error {
+	var errs Errors
+
 	// Validate retailer
-	if retailer == "" || !retailerRegex.MatchString(retailer) {
-		return errors.New("invalid retailer name")
+	if retailer == "" {
+		errs.add("/retailer", CodeRequired, "retailer is required")
+	} else if !retailerRegex.MatchString(retailer) {
+		errs.add("/retailer", CodeInvalidFormat, "invalid retailer name")
 	}
 
 	// Validate purchase date
-	if purchaseDate == "" || !dateRegex.MatchString(purchaseDate) {
-		return errors.New("invalid purchase date format, expected YYYY-MM-DD")
+	if purchaseDate == "" {
+		errs.add("/purchaseDate", CodeRequired, "purchase date is required")
+	} else if !dateRegex.MatchString(purchaseDate) {
+		errs.add("/purchaseDate", CodeInvalidFormat, "invalid purchase date format, expected YYYY-MM-DD")
 	}
 
 	// Validate purchase time
-	if purchaseTime == "" || !timeRegex.MatchString(purchaseTime) {
-		return errors.New("invalid purchase time format, expected HH:mm")
+	if purchaseTime == "" {
+		errs.add("/purchaseTime", CodeRequired, "purchase time is required")
+	} else if !timeRegex.MatchString(purchaseTime) {
+		errs.add("/purchaseTime", CodeInvalidFormat, "invalid purchase time format, expected HH:mm")
 	}
 
 	// Validate total amount
-	if total == "" || !priceRegex.MatchString(total) {
-		return errors.New("invalid total amount format, expected a decimal with two places")
-	}
+	validateAmount(&errs, "/total", "total amount", total)
 
 	// Validate items
 	if len(items) == 0 {
-		return errors.New("at least one item is required")
+		errs.add("/items", CodeRequired, "at least one item is required")
 	}
 
-	for _, item := range items {
+	for i, item := range items {
+		path := fmt.Sprintf("/items/%d", i)
 		shortDescription := item["shortDescription"]
-		price := item["price"]
 
-		if shortDescription == "" || !shortDescriptionRegex.MatchString(shortDescription) {
-			return errors.New("invalid short description for an item")
+		if shortDescription == "" {
+			errs.add(path+"/shortDescription", CodeRequired, "short description is required for an item")
+		} else if !shortDescriptionRegex.MatchString(shortDescription) {
+			errs.add(path+"/shortDescription", CodeInvalidFormat, "invalid short description for an item")
 		}
 
-		if price == "" || !priceRegex.MatchString(price) {
-			return errors.New("invalid price for an item, expected a decimal with two places")
-		}
+		validateAmount(&errs, path+"/price", "price for an item", item["price"])
 	}
 
-	return nil
+	return errs.err()
+}
+
+// validateAmount checks that an amount is a decimal with two places that fits in Money.
+func validateAmount(errs *Errors, path, name, value string) {
+	if value == "" {
+		errs.add(path, CodeRequired, name+" is required")
+		return
+	}
+	if !priceRegex.MatchString(value) {
+		errs.add(path, CodeInvalidFormat, "invalid "+name+" format, expected a decimal with two places")
+		return
+	}
+	if _, err := common.ParseMoney(value); err != nil {
+		errs.add(path, CodeInvalidAmount, "invalid "+name+": "+err.Error())
+	}
 }
@@ -43,3 +43,39 @@ func TestValidateReceiptInvalidPrice(t *testing.T) {
 		t.Errorf("expected error for invalid item price format, but got none")
 	}
 }
+
+func TestValidateReceiptAmountOutOfRange(t *testing.T) {
+	err := ValidateReceipt("M&M Corner Market", "2023-11-25", "13:45", "99999999999999999999.00", []map[string]string{
+		{"shortDescription": "Apples", "price": "5.00"},
+	})
+	if err == nil {
+		t.Errorf("expected error for an out of range total, but got none")
+	}
+}
+
+func TestValidateReceiptCollectsAllErrors(t *testing.T) {
+	err := ValidateReceipt("", "2023/11/25", "13:45", "12.34", []map[string]string{
+		{"shortDescription": "Apples", "price": "5.00"},
+		{"shortDescription": "", "price": "5"},
+	})
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected validation Errors, got %T: %v", err, err)
+	}
+
+	expected := []struct{ path, code string }{
+		{"/retailer", CodeRequired},
+		{"/purchaseDate", CodeInvalidFormat},
+		{"/items/1/shortDescription", CodeRequired},
+		{"/items/1/price", CodeInvalidFormat},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %+v", len(expected), errs)
+	}
+	for i, want := range expected {
+		if errs[i].Path != want.path || errs[i].Code != want.code {
+			t.Errorf("error %d: expected %s at %s, got %+v", i, want.code, want.path, errs[i])
+		}
+	}
+}